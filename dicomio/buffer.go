@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 
 	"golang.org/x/text/encoding"
 )
@@ -37,8 +38,15 @@ type Encoder struct {
 	// of Encoder to see the current transfer syntax.
 	implicit IsImplicitVR
 
+	// For encoding utf-8 strings into the character set of the DICOM file.
+	// If nil, strings are written as is.
+	charset *encoding.Encoder
+
 	// Stack of old transfer syntaxes. Used by {Push,Pop}TransferSyntax.
 	oldTransferSyntaxes []transferSyntaxStackEntry
+
+	// For encoding fixed-size values without allocating.
+	scratch [8]byte
 }
 
 // NewBytesEncoder creates a new Encoder that writes to an in-memory buffer. The
@@ -86,6 +94,32 @@ func NewEncoder(out io.Writer, bo binary.ByteOrder, implicit IsImplicitVR) *Enco
 	}
 }
 
+// SetCharset sets the encoder used by EncodeString. nil, the default, means
+// strings are written as is.
+func (e *Encoder) SetCharset(cs *encoding.Encoder) {
+	e.charset = cs
+}
+
+// Charset returns the encoder set by SetCharset.
+func (e *Encoder) Charset() *encoding.Encoder {
+	return e.charset
+}
+
+// EncodeString converts a utf-8 string into the character set set by
+// SetCharset. It reports an error if v has characters that the character set
+// can't represent.
+func (e *Encoder) EncodeString(v string) string {
+	if e.charset == nil {
+		return v
+	}
+	s, err := e.charset.String(v)
+	if err != nil {
+		e.SetErrorf("dicomio.EncodeString: %q: %v", v, err)
+		return v
+	}
+	return s
+}
+
 // TransferSyntax returns the current transfer syntax.
 func (e *Encoder) TransferSyntax() (binary.ByteOrder, IsImplicitVR) {
 	return e.bo, e.implicit
@@ -142,43 +176,55 @@ func (e *Encoder) Bytes() []byte {
 }
 
 func (e *Encoder) WriteByte(v byte) {
-	binary.Write(e.out, e.bo, &v)
+	e.scratch[0] = v
+	e.out.Write(e.scratch[:1])
 }
 
 func (e *Encoder) WriteUInt16(v uint16) {
-	binary.Write(e.out, e.bo, &v)
+	e.bo.PutUint16(e.scratch[:2], v)
+	e.out.Write(e.scratch[:2])
 }
 
 func (e *Encoder) WriteUInt32(v uint32) {
-	binary.Write(e.out, e.bo, &v)
+	e.bo.PutUint32(e.scratch[:4], v)
+	e.out.Write(e.scratch[:4])
 }
 
 func (e *Encoder) WriteInt16(v int16) {
-	binary.Write(e.out, e.bo, &v)
+	e.WriteUInt16(uint16(v))
 }
 
 func (e *Encoder) WriteInt32(v int32) {
-	binary.Write(e.out, e.bo, &v)
+	e.WriteUInt32(uint32(v))
 }
 
 func (e *Encoder) WriteFloat32(v float32) {
-	binary.Write(e.out, e.bo, &v)
+	e.WriteUInt32(math.Float32bits(v))
 }
 
 func (e *Encoder) WriteFloat64(v float64) {
-	binary.Write(e.out, e.bo, &v)
+	e.bo.PutUint64(e.scratch[:8], math.Float64bits(v))
+	e.out.Write(e.scratch[:8])
 }
 
 // WriteString writes the string, withoutout any length prefix or padding.
 func (e *Encoder) WriteString(v string) {
-	e.out.Write([]byte(v))
+	io.WriteString(e.out, v)
 }
 
+// zeros is the source of WriteZeros.
+var zeros [256]byte
+
 // WriteZeros encodes an array of zero bytes.
 func (e *Encoder) WriteZeros(len int) {
-	// TODO(saito) reuse the buffer!
-	zeros := make([]byte, len)
-	e.out.Write(zeros)
+	for len > 0 {
+		n := len
+		if n > cap(zeros) {
+			n = cap(zeros)
+		}
+		e.out.Write(zeros[:n])
+		len -= n
+	}
 }
 
 // Copy the given data to the output.
@@ -186,6 +232,15 @@ func (e *Encoder) WriteBytes(v []byte) {
 	e.out.Write(v)
 }
 
+// WriteFrom copies exactly n bytes from r to the output. It sets an error if
+// r yields fewer than n bytes.
+func (e *Encoder) WriteFrom(r io.Reader, n int64) {
+	copied, err := io.CopyN(e.out, r, n)
+	if err != nil {
+		e.SetErrorf("dicomio.WriteFrom: copied %d of %d bytes: %v", copied, n, err)
+	}
+}
+
 // IsImplicitVR defines whether a 2-character VR tag is emit with each data
 // element.
 type IsImplicitVR int
@@ -227,6 +282,10 @@ type Decoder struct {
 	// Stack of old limits. Used by {Push,Pop}Limit.
 	// INVARIANT: oldLimits[] store values in decreasing order.
 	stateStack []stackEntry
+
+	// Bytes read since StartRecording. Used by {Start,Stop}Recording.
+	recording bool
+	recorded  []byte
 }
 
 // NewDecoder creates a decoder object that reads up to "limit" bytes from "in".
@@ -384,9 +443,28 @@ func (d *Decoder) Read(p []byte) (int, error) {
 	if n >= 0 {
 		d.pos += int64(n)
 	}
+	if d.recording && n > 0 {
+		d.recorded = append(d.recorded, p[:n]...)
+	}
 	return n, err
 }
 
+// StartRecording makes the decoder keep a copy of the bytes it reads, until
+// StopRecording is called.
+func (d *Decoder) StartRecording() {
+	d.recording = true
+	d.recorded = nil
+}
+
+// StopRecording returns the bytes read since StartRecording, and stops
+// recording.
+func (d *Decoder) StopRecording() []byte {
+	recorded := d.recorded
+	d.recording = false
+	d.recorded = nil
+	return recorded
+}
+
 // Len returns the number of bytes yet consumed.
 func (d *Decoder) Len() int64 {
 	return d.limit - d.pos
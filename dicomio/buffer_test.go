@@ -46,6 +46,17 @@ func TestSkip(t *testing.T) {
 	require.Equal(t, "defghijk", d.ReadString(8))
 }
 
+func TestRecording(t *testing.T) {
+	d := dicomio.NewBytesDecoder([]byte("abcdefghijk"), binary.BigEndian, dicomio.UnknownVR)
+	d.Skip(2)
+	d.StartRecording()
+	require.Equal(t, "cd", d.ReadString(2))
+	d.Skip(3)
+	require.Equal(t, []byte("cdefg"), d.StopRecording())
+	require.Equal(t, "hi", d.ReadString(2))
+	require.Nil(t, d.StopRecording())
+}
+
 func TestPartialData(t *testing.T) {
 	e := dicomio.NewBytesEncoder(binary.BigEndian, dicomio.UnknownVR)
 	e.WriteByte(10)
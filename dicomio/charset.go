@@ -92,17 +92,12 @@ func ParseSpecificCharacterSet(encodingNames []string) (CodingSystem, error) {
 	for _, name := range encodingNames {
 		var c *encoding.Decoder
 		dicomlog.Vprintf(2, "dicom.ParseSpecificCharacterSet: Using coding system %s", name)
-		if htmlName, ok := htmlEncodingNames[name]; !ok {
-			// TODO(saito) Support more encodings.
-			return CodingSystem{}, fmt.Errorf("dicom.ParseSpecificCharacterSet: Unknown character set '%s'. Assuming utf-8", name)
-		} else {
-			if htmlName != "" {
-				d, err := htmlindex.Get(htmlName)
-				if err != nil {
-					panic(fmt.Sprintf("Encoding name %s (for %s) not found", name, htmlName))
-				}
-				c = d.NewDecoder()
-			}
+		d, err := findEncoding(name)
+		if err != nil {
+			return CodingSystem{}, err
+		}
+		if d != nil {
+			c = d.NewDecoder()
 		}
 		decoders = append(decoders, c)
 	}
@@ -117,3 +112,40 @@ func ParseSpecificCharacterSet(encodingNames []string) (CodingSystem, error) {
 	}
 	return CodingSystem{decoders[0], decoders[1], decoders[2]}, nil
 }
+
+// ParseSpecificCharacterSetEncoder is the inverse of ParseSpecificCharacterSet.
+// It returns the golang encoder for the character set that
+// ParseSpecificCharacterSet uses to decode strings (CodingSystem.Ideographic),
+// or nil for the default (7bit ASCII) encoding.
+func ParseSpecificCharacterSetEncoder(encodingNames []string) (*encoding.Encoder, error) {
+	if len(encodingNames) == 0 {
+		return nil, nil
+	}
+	name := encodingNames[0]
+	if len(encodingNames) > 1 {
+		name = encodingNames[1]
+	}
+	d, err := findEncoding(name)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	return d.NewEncoder(), nil
+}
+
+// findEncoding returns the golang encoding for the DICOM character set name,
+// or nil for 7bit ascii.
+func findEncoding(name string) (encoding.Encoding, error) {
+	htmlName, ok := htmlEncodingNames[name]
+	if !ok {
+		// TODO(saito) Support more encodings.
+		return nil, fmt.Errorf("dicom.ParseSpecificCharacterSet: Unknown character set '%s'. Assuming utf-8", name)
+	}
+	if htmlName == "" {
+		return nil, nil
+	}
+	d, err := htmlindex.Get(htmlName)
+	if err != nil {
+		panic(fmt.Sprintf("Encoding name %s (for %s) not found", name, htmlName))
+	}
+	return d, nil
+}
@@ -15,6 +15,13 @@ var StandardTransferSyntaxes = []string{
 	dicomuid.DeflatedExplicitVRLittleEndian,
 }
 
+// Transfer syntaxes that aren't encoded in Explicit VR Little Endian, besides
+// the standard ones.
+const (
+	papyrus3ImplicitVRLittleEndian = "1.2.840.10008.1.20"
+	jpipReferencedDeflate          = "1.2.840.10008.1.2.4.95"
+)
+
 // CanonicalTransferSyntaxUID return the canonical transfer syntax UID (e.g.,
 // dicomuid.ExplicitVRLittleEndian or dicomuid.ImplicitVRLittleEndian), given an
 // UID that represents any transfer syntax.  Returns an error if the uid is not
@@ -31,6 +38,13 @@ func CanonicalTransferSyntaxUID(uid string) (string, error) {
 		dicomuid.ExplicitVRBigEndian,
 		dicomuid.DeflatedExplicitVRLittleEndian:
 		return uid, nil
+	case papyrus3ImplicitVRLittleEndian:
+		// Retired, but still found in old files.
+		return dicomuid.ImplicitVRLittleEndian, nil
+	case jpipReferencedDeflate:
+		// The dataset is deflated like that of Deflated Explicit VR Little
+		// Endian (P3.5 A.7).
+		return dicomuid.DeflatedExplicitVRLittleEndian, nil
 	default:
 		e, err := dicomuid.Lookup(uid)
 		if err != nil {
@@ -48,7 +62,8 @@ func CanonicalTransferSyntaxUID(uid string) (string, error) {
 // and implicitVR/explicitVR type.  TrasnferSyntaxUID can be any UID that refers to
 // a transfer syntax. It can be, e.g., 1.2.840.10008.1.2 (it will return
 // LittleEndian, ImplicitVR) or 1.2.840.10008.1.2.4.54 (it will return
-// (LittleEndian, ExplicitVR).
+// (LittleEndian, ExplicitVR). Like CanonicalTransferSyntaxUID, it returns an
+// error for a UID that isn't a transfer syntax of the DICOM standard.
 func ParseTransferSyntaxUID(uid string) (bo binary.ByteOrder, implicit IsImplicitVR, err error) {
 	canonical, err := CanonicalTransferSyntaxUID(uid)
 	if err != nil {
@@ -0,0 +1,79 @@
+package dicomio_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/suyashkumar/dicom/dicomio"
+	"github.com/suyashkumar/dicom/dicomuid"
+)
+
+func TestParseTransferSyntaxUID(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	implicit, explicit := dicomio.ImplicitVR, dicomio.ExplicitVR
+	// The transfer syntaxes of P3.6 Annex A.
+	for _, tc := range []struct {
+		uid       string
+		canonical string
+		bo        binary.ByteOrder
+		implicit  dicomio.IsImplicitVR
+	}{
+		{"1.2.840.10008.1.2", dicomuid.ImplicitVRLittleEndian, le, implicit},
+		{"1.2.840.10008.1.2.1", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.1.99", dicomuid.DeflatedExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.2", dicomuid.ExplicitVRBigEndian, be, explicit},
+		{"1.2.840.10008.1.2.4.50", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.51", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.52", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.53", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.54", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.55", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.56", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.57", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.58", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.59", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.60", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.61", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.62", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.63", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.64", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.65", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.66", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.70", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.80", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.81", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.90", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.91", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.92", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.93", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.94", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.95", dicomuid.DeflatedExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.100", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.101", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.102", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.103", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.104", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.105", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.106", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.107", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.4.108", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.5", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.6.1", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.2.6.2", dicomuid.ExplicitVRLittleEndian, le, explicit},
+		{"1.2.840.10008.1.20", dicomuid.ImplicitVRLittleEndian, le, implicit},
+	} {
+		canonical, err := dicomio.CanonicalTransferSyntaxUID(tc.uid)
+		assert.NoError(t, err, tc.uid)
+		assert.Equal(t, tc.canonical, canonical, tc.uid)
+		bo, implicit, err := dicomio.ParseTransferSyntaxUID(tc.uid)
+		assert.NoError(t, err, tc.uid)
+		assert.Equal(t, tc.bo, bo, tc.uid)
+		assert.Equal(t, tc.implicit, implicit, tc.uid)
+	}
+
+	for _, uid := range []string{"", "1.2.3.4", dicomuid.VerificationSOPClass} {
+		_, _, err := dicomio.ParseTransferSyntaxUID(uid)
+		assert.Error(t, err, uid)
+	}
+}
@@ -11,7 +11,17 @@ Tag = NamedTuple('Tag', [
     ('elem', int),
     ('vr', str),
     ('name', str),
-    ('vm', str)])
+    ('vm', str),
+    ('alt_vrs', List[str])])
+
+# VRs of tags that the standard defines with more than one VR. The tag
+# dictionary stores the first one.
+ALTERNATIVE_VRS = {
+    "xs": ["US", "SS"],
+    "ox": ["OW", "OB"],
+    "up": ["UP", "UL"],
+    "lt": ["US", "SS", "OW"],
+}
 
 def list_tags() -> List[Tag]:
     global DATA
@@ -27,6 +37,7 @@ def list_tags() -> List[Tag]:
             ok = False
             continue
 
+        alt_vrs = ALTERNATIVE_VRS.get(m.group(3), [])
         vr=m.group(3).upper()
         if vr == "XS":
             # Its generally safe to treat XS as unsigned.  See
@@ -37,14 +48,24 @@ def list_tags() -> List[Tag]:
 	    # TODO(saito) I'm less sure about the OX rule. Where is
 	    # this crap defined in the standard??
             vr = "OW"
+        elif vr == "LT" and alt_vrs:
+            # Lookup table data, "US, SS or OW". Not to be confused with
+            # the LT (long text) VR.
+            vr = "US"
 
         tag = Tag(group=m.group(1),
                   elem=m.group(2),
                   vr=vr,
                   name=m.group(4),
-                  vm=m.group(5))
+                  vm=m.group(5),
+                  alt_vrs=alt_vrs)
 
 
+        # Repeating groups, such as (6000-60FF,eeee) for overlays, are
+        # stored under the first group of the range. See Find.
+        m = re.match(r'^([0-9A-Fa-f]{2})00-\1FF$', tag.group, re.IGNORECASE)
+        if m:
+            tag = tag._replace(group=m.group(1) + "00")
         if not re.match('^[0-9A-Fa-f]+$', tag.group) or not re.match('^[0-9A-Fa-f]+$', tag.elem):
             continue
         tags.append(tag)
@@ -65,6 +86,7 @@ def generate(out: IO[str]):
         print(f'var {t.name} = Tag{{0x{t.group}, 0x{t.elem}}}', file=out)
 
     print("var tagDict map[Tag]TagInfo", file=out)
+    print("var altVRDict map[Tag][]string", file=out)
     print("", file=out)
     print("func init() {", file=out)
     print("	maybeInitTagDict()", file=out)
@@ -76,6 +98,16 @@ def generate(out: IO[str]):
     print("	tagDict = make(map[Tag]TagInfo)", file=out)
     for t in tags:
         print(f'	tagDict[Tag{{0x{t.group}, 0x{t.elem}}}] = TagInfo{{Tag{{0x{t.group}, 0x{t.elem}}}, "{t.vr}", "{t.name}", "{t.vm}"}}', file=out)
+    print("	altVRDict = make(map[Tag][]string)", file=out)
+    # A tag may be listed more than once, e.g., as ACR_NEMA_ and RETIRED_;
+    # the last entry wins, as in tagDict.
+    alt_vrs = {}
+    for t in tags:
+        if t.alt_vrs:
+            alt_vrs[(t.group, t.elem)] = t.alt_vrs
+    for (group, elem), vrs in alt_vrs.items():
+        vrs = ", ".join(f'"{vr}"' for vr in vrs)
+        print(f'	altVRDict[Tag{{0x{group}, 0x{elem}}}] = []string{{{vrs}}}', file=out)
     print("}", file=out)
 
 
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
@@ -119,9 +120,9 @@ func GetVRKind(tag Tag, vr string) VRKind {
 		return VRTagList
 	case "OW", "OB":
 		return VRBytes
-	case "LT", "UT":
+	case "LT", "UT", "UR":
 		return VRString
-	case "UL":
+	case "UL", "OL":
 		return VRUInt32List
 	case "SL":
 		return VRInt32List
@@ -129,9 +130,9 @@ func GetVRKind(tag Tag, vr string) VRKind {
 		return VRUInt16List
 	case "SS":
 		return VRInt16List
-	case "FL":
+	case "FL", "OF":
 		return VRFloat32List
-	case "FD":
+	case "FD", "OD":
 		return VRFloat64List
 	case "SQ":
 		return VRSequence
@@ -140,11 +141,31 @@ func GetVRKind(tag Tag, vr string) VRKind {
 	}
 }
 
+// repeatingGroupTag returns the tag under which a data element of a repeating
+// group, such as an overlay plane (60xx,eeee), is stored in the dictionary:
+// the one in the first group of its range. Repeating groups are the even
+// groups 5000-501E and 6000-601E (P3.5 7.6), and 7F00-7F1E, of the retired
+// variable pixel data. Other tags are returned as is.
+func repeatingGroupTag(tag Tag) Tag {
+	base := tag.Group & 0xff00
+	if (base == 0x5000 || base == 0x6000 || base == 0x7f00) && tag.Group%2 == 0 && tag.Group&0x00ff <= 0x1e {
+		return Tag{base, tag.Element}
+	}
+	return tag
+}
+
 // Find finds information about the given tag. If the tag is not part of
 // the DICOM standard, or is retired from the standard, it returns an error.
+// Tags of repeating groups are found by their first group, e.g., (6002,3000)
+// is OverlayData, with TagInfo.Tag set to the given tag.
 func Find(tag Tag) (TagInfo, error) {
 	maybeInitTagDict()
 	entry, ok := tagDict[tag]
+	if !ok {
+		if entry, ok = tagDict[repeatingGroupTag(tag)]; ok {
+			entry.Tag = tag
+		}
+	}
 	if !ok {
 		// (0000-u-ffff,0000)	UL	GenericGroupLength	1	GENERIC
 		if tag.Group%2 == 0 && tag.Element == 0x0000 {
@@ -156,6 +177,72 @@ func Find(tag Tag) (TagInfo, error) {
 	return entry, nil
 }
 
+// AllowedVRs returns the VRs that the DICOM standard allows for the given tag.
+// Most tags have exactly one VR, but some, such as SmallestImagePixelValue,
+// are defined as "US or SS". The first VR is the one stored in TagInfo.VR.
+func AllowedVRs(tag Tag) ([]string, error) {
+	entry, err := Find(tag)
+	if err != nil {
+		return nil, err
+	}
+	if vrs, ok := altVRDict[repeatingGroupTag(tag)]; ok {
+		return vrs, nil
+	}
+	return []string{entry.VR}, nil
+}
+
+// IsPrivateCreator reports whether tag is a private creator element
+// (gggg,0010-00FF), which reserves the block of private data elements
+// (gggg,xx00-xxFF) for the creator named in its value (P3.5 7.8.1).
+func IsPrivateCreator(tag Tag) bool {
+	return IsPrivate(tag.Group) && tag.Element >= 0x0010 && tag.Element <= 0x00ff
+}
+
+// privateKey identifies a private data element independently of the block
+// that its creator was assigned.
+type privateKey struct {
+	creator string
+	group   uint16
+	element uint8
+}
+
+var (
+	privateDictMu sync.RWMutex
+	privateDict   = map[privateKey]TagInfo{}
+)
+
+// RegisterPrivateTag adds a private data element of the given creator to the
+// dictionary consulted by FindPrivate. Only the low byte of info.Tag.Element
+// matters, since the block is assigned per file.
+//
+//   RegisterPrivateTag("ACME 1.0", TagInfo{Tag: Tag{0x0009, 0x1001}, VR: "DS", Name: "AcmeGain", VM: "1"})
+func RegisterPrivateTag(creator string, info TagInfo) error {
+	if !IsPrivate(info.Tag.Group) {
+		return fmt.Errorf("RegisterPrivateTag: %v is not a private tag", info.Tag)
+	}
+	privateDictMu.Lock()
+	defer privateDictMu.Unlock()
+	privateDict[privateKey{creator, info.Tag.Group, uint8(info.Tag.Element)}] = info
+	return nil
+}
+
+// FindPrivate finds information about a private tag, given the value of the
+// private creator element that reserved its block. Private creator elements
+// themselves are found regardless of the creator.
+func FindPrivate(creator string, tag Tag) (TagInfo, error) {
+	if IsPrivateCreator(tag) {
+		return TagInfo{tag, "LO", "PrivateCreator", "1"}, nil
+	}
+	privateDictMu.RLock()
+	entry, ok := privateDict[privateKey{creator, tag.Group, uint8(tag.Element)}]
+	privateDictMu.RUnlock()
+	if !IsPrivate(tag.Group) || tag.Element < 0x1000 || !ok {
+		return TagInfo{}, fmt.Errorf("Could not find private tag (0x%x, 0x%x) of %q in dictionary", tag.Group, tag.Element, creator)
+	}
+	entry.Tag = tag
+	return entry, nil
+}
+
 // MustFind is like FindTag, but panics on error.
 func MustFind(tag Tag) TagInfo {
 	e, err := Find(tag)
@@ -3199,6 +3199,22 @@ var WaveformPaddingValue = Tag{0x5400, 0x100A}
 var WaveformData = Tag{0x5400, 0x1010}
 var FirstOrderPhaseCorrectionAngle = Tag{0x5600, 0x0010}
 var SpectroscopyData = Tag{0x5600, 0x0020}
+var OverlayRows = Tag{0x6000, 0x0010}
+var OverlayColumns = Tag{0x6000, 0x0011}
+var NumberOfFramesInOverlay = Tag{0x6000, 0x0015}
+var OverlayDescription = Tag{0x6000, 0x0022}
+var OverlayType = Tag{0x6000, 0x0040}
+var OverlaySubtype = Tag{0x6000, 0x0045}
+var OverlayOrigin = Tag{0x6000, 0x0050}
+var ImageFrameOrigin = Tag{0x6000, 0x0051}
+var OverlayBitsAllocated = Tag{0x6000, 0x0100}
+var OverlayBitPosition = Tag{0x6000, 0x0102}
+var OverlayActivationLayer = Tag{0x6000, 0x1001}
+var ROIArea = Tag{0x6000, 0x1301}
+var ROIMean = Tag{0x6000, 0x1302}
+var ROIStandardDeviation = Tag{0x6000, 0x1303}
+var OverlayLabel = Tag{0x6000, 0x1500}
+var OverlayData = Tag{0x6000, 0x3000}
 var PixelData = Tag{0x7FE0, 0x0010}
 var DigitalSignaturesSequence = Tag{0xFFFA, 0xFFFA}
 var DataSetTrailingPadding = Tag{0xFFFC, 0xFFFC}
@@ -3303,6 +3319,9 @@ var ACR_NEMA_ImagePresentationComments = Tag{0x0028, 0x4000}
 var ACR_NEMA_TextGroupLength = Tag{0x4000, 0x0000}
 var ACR_NEMA_TextArbitrary = Tag{0x4000, 0x0010}
 var ACR_NEMA_TextComments = Tag{0x4000, 0x4000}
+var ACR_NEMA_OverlayFormat = Tag{0x6000, 0x0110}
+var ACR_NEMA_OverlayLocation = Tag{0x6000, 0x0200}
+var ACR_NEMA_OverlayComments = Tag{0x6000, 0x4000}
 var ACR_NEMA_2C_CompressionRecognitionCode = Tag{0x0028, 0x005F}
 var ACR_NEMA_2C_CompressionOriginator = Tag{0x0028, 0x0061}
 var ACR_NEMA_2C_CompressionLabel = Tag{0x0028, 0x0062}
@@ -3353,10 +3372,28 @@ var ACR_NEMA_2C_ShiftTableSize = Tag{0x1000, 0x0014}
 var ACR_NEMA_2C_ShiftTableTriplet = Tag{0x1000, 0x0015}
 var ACR_NEMA_2C_ZonalMapGroupLength = Tag{0x1010, 0x0000}
 var ACR_NEMA_2C_ZonalMap = Tag{0x1010, 0x0004}
+var ACR_NEMA_2C_OverlayCompressionCode = Tag{0x6000, 0x0060}
+var ACR_NEMA_2C_OverlayCompressionOriginator = Tag{0x6000, 0x0061}
+var ACR_NEMA_2C_OverlayCompressionLabel = Tag{0x6000, 0x0062}
+var ACR_NEMA_2C_OverlayCompressionDescription = Tag{0x6000, 0x0063}
+var ACR_NEMA_2C_OverlayCompressionStepPointers = Tag{0x6000, 0x0066}
+var ACR_NEMA_2C_OverlayRepeatInterval = Tag{0x6000, 0x0068}
+var ACR_NEMA_2C_OverlayBitsGrouped = Tag{0x6000, 0x0069}
+var ACR_NEMA_2C_OverlayCodeLabel = Tag{0x6000, 0x0800}
+var ACR_NEMA_2C_OverlayNumberOfTables = Tag{0x6000, 0x0802}
+var ACR_NEMA_2C_OverlayCodeTableLocation = Tag{0x6000, 0x0803}
+var ACR_NEMA_2C_OverlayBitsForCodeWord = Tag{0x6000, 0x0804}
+var ACR_NEMA_2C_VariablePixelDataGroupLength = Tag{0x7F00, 0x0000}
+var ACR_NEMA_2C_VariablePixelData = Tag{0x7F00, 0x0010}
+var ACR_NEMA_2C_VariableNextDataGroup = Tag{0x7F00, 0x0011}
+var ACR_NEMA_2C_VariableCoefficientsSDVN = Tag{0x7F00, 0x0020}
+var ACR_NEMA_2C_VariableCoefficientsSDHN = Tag{0x7F00, 0x0030}
+var ACR_NEMA_2C_VariableCoefficientsSDDN = Tag{0x7F00, 0x0040}
 var ACR_NEMA_2C_CoefficientsSDVN = Tag{0x7FE0, 0x0020}
 var ACR_NEMA_2C_CoefficientsSDHN = Tag{0x7FE0, 0x0030}
 var ACR_NEMA_2C_CoefficientsSDDN = Tag{0x7FE0, 0x0040}
 var tagDict map[Tag]TagInfo
+var altVRDict map[Tag][]string
 
 func init() {
 	maybeInitTagDict()
@@ -4808,7 +4845,7 @@ func maybeInitTagDict() {
 	tagDict[Tag{0x0028, 0x3002}] = TagInfo{Tag{0x0028, 0x3002}, "US", "LUTDescriptor", "3"}
 	tagDict[Tag{0x0028, 0x3003}] = TagInfo{Tag{0x0028, 0x3003}, "LO", "LUTExplanation", "1"}
 	tagDict[Tag{0x0028, 0x3004}] = TagInfo{Tag{0x0028, 0x3004}, "LO", "ModalityLUTType", "1"}
-	tagDict[Tag{0x0028, 0x3006}] = TagInfo{Tag{0x0028, 0x3006}, "LT", "LUTData", "1-n"}
+	tagDict[Tag{0x0028, 0x3006}] = TagInfo{Tag{0x0028, 0x3006}, "US", "LUTData", "1-n"}
 	tagDict[Tag{0x0028, 0x3010}] = TagInfo{Tag{0x0028, 0x3010}, "SQ", "VOILUTSequence", "1"}
 	tagDict[Tag{0x0028, 0x3110}] = TagInfo{Tag{0x0028, 0x3110}, "SQ", "SoftcopyVOILUTSequence", "1"}
 	tagDict[Tag{0x0028, 0x6010}] = TagInfo{Tag{0x0028, 0x6010}, "US", "RepresentativeFrameNumber", "1"}
@@ -6564,6 +6601,22 @@ func maybeInitTagDict() {
 	tagDict[Tag{0x5400, 0x1010}] = TagInfo{Tag{0x5400, 0x1010}, "OW", "WaveformData", "1"}
 	tagDict[Tag{0x5600, 0x0010}] = TagInfo{Tag{0x5600, 0x0010}, "OF", "FirstOrderPhaseCorrectionAngle", "1"}
 	tagDict[Tag{0x5600, 0x0020}] = TagInfo{Tag{0x5600, 0x0020}, "OF", "SpectroscopyData", "1"}
+	tagDict[Tag{0x6000, 0x0010}] = TagInfo{Tag{0x6000, 0x0010}, "US", "OverlayRows", "1"}
+	tagDict[Tag{0x6000, 0x0011}] = TagInfo{Tag{0x6000, 0x0011}, "US", "OverlayColumns", "1"}
+	tagDict[Tag{0x6000, 0x0015}] = TagInfo{Tag{0x6000, 0x0015}, "IS", "NumberOfFramesInOverlay", "1"}
+	tagDict[Tag{0x6000, 0x0022}] = TagInfo{Tag{0x6000, 0x0022}, "LO", "OverlayDescription", "1"}
+	tagDict[Tag{0x6000, 0x0040}] = TagInfo{Tag{0x6000, 0x0040}, "CS", "OverlayType", "1"}
+	tagDict[Tag{0x6000, 0x0045}] = TagInfo{Tag{0x6000, 0x0045}, "LO", "OverlaySubtype", "1"}
+	tagDict[Tag{0x6000, 0x0050}] = TagInfo{Tag{0x6000, 0x0050}, "SS", "OverlayOrigin", "2"}
+	tagDict[Tag{0x6000, 0x0051}] = TagInfo{Tag{0x6000, 0x0051}, "US", "ImageFrameOrigin", "1"}
+	tagDict[Tag{0x6000, 0x0100}] = TagInfo{Tag{0x6000, 0x0100}, "US", "OverlayBitsAllocated", "1"}
+	tagDict[Tag{0x6000, 0x0102}] = TagInfo{Tag{0x6000, 0x0102}, "US", "OverlayBitPosition", "1"}
+	tagDict[Tag{0x6000, 0x1001}] = TagInfo{Tag{0x6000, 0x1001}, "CS", "OverlayActivationLayer", "1"}
+	tagDict[Tag{0x6000, 0x1301}] = TagInfo{Tag{0x6000, 0x1301}, "IS", "ROIArea", "1"}
+	tagDict[Tag{0x6000, 0x1302}] = TagInfo{Tag{0x6000, 0x1302}, "DS", "ROIMean", "1"}
+	tagDict[Tag{0x6000, 0x1303}] = TagInfo{Tag{0x6000, 0x1303}, "DS", "ROIStandardDeviation", "1"}
+	tagDict[Tag{0x6000, 0x1500}] = TagInfo{Tag{0x6000, 0x1500}, "LO", "OverlayLabel", "1"}
+	tagDict[Tag{0x6000, 0x3000}] = TagInfo{Tag{0x6000, 0x3000}, "OW", "OverlayData", "1"}
 	tagDict[Tag{0x7FE0, 0x0010}] = TagInfo{Tag{0x7FE0, 0x0010}, "OW", "PixelData", "1"}
 	tagDict[Tag{0xFFFA, 0xFFFA}] = TagInfo{Tag{0xFFFA, 0xFFFA}, "SQ", "DigitalSignaturesSequence", "1"}
 	tagDict[Tag{0xFFFC, 0xFFFC}] = TagInfo{Tag{0xFFFC, 0xFFFC}, "OB", "DataSetTrailingPadding", "1"}
@@ -6682,6 +6735,9 @@ func maybeInitTagDict() {
 	tagDict[Tag{0x4000, 0x0000}] = TagInfo{Tag{0x4000, 0x0000}, "UL", "ACR_NEMA_TextGroupLength", "1"}
 	tagDict[Tag{0x4000, 0x0010}] = TagInfo{Tag{0x4000, 0x0010}, "LT", "ACR_NEMA_TextArbitrary", "1-n"}
 	tagDict[Tag{0x4000, 0x4000}] = TagInfo{Tag{0x4000, 0x4000}, "LT", "ACR_NEMA_TextComments", "1-n"}
+	tagDict[Tag{0x6000, 0x0110}] = TagInfo{Tag{0x6000, 0x0110}, "CS", "ACR_NEMA_OverlayFormat", "1"}
+	tagDict[Tag{0x6000, 0x0200}] = TagInfo{Tag{0x6000, 0x0200}, "US", "ACR_NEMA_OverlayLocation", "1"}
+	tagDict[Tag{0x6000, 0x4000}] = TagInfo{Tag{0x6000, 0x4000}, "LT", "ACR_NEMA_OverlayComments", "1-n"}
 	tagDict[Tag{0x0028, 0x005F}] = TagInfo{Tag{0x0028, 0x005F}, "CS", "ACR_NEMA_2C_CompressionRecognitionCode", "1"}
 	tagDict[Tag{0x0028, 0x0061}] = TagInfo{Tag{0x0028, 0x0061}, "SH", "ACR_NEMA_2C_CompressionOriginator", "1"}
 	tagDict[Tag{0x0028, 0x0062}] = TagInfo{Tag{0x0028, 0x0062}, "SH", "ACR_NEMA_2C_CompressionLabel", "1"}
@@ -6732,6 +6788,23 @@ func maybeInitTagDict() {
 	tagDict[Tag{0x1000, 0x0015}] = TagInfo{Tag{0x1000, 0x0015}, "US", "ACR_NEMA_2C_ShiftTableTriplet", "3"}
 	tagDict[Tag{0x1010, 0x0000}] = TagInfo{Tag{0x1010, 0x0000}, "UL", "ACR_NEMA_2C_ZonalMapGroupLength", "1"}
 	tagDict[Tag{0x1010, 0x0004}] = TagInfo{Tag{0x1010, 0x0004}, "US", "ACR_NEMA_2C_ZonalMap", "1-n"}
+	tagDict[Tag{0x6000, 0x0060}] = TagInfo{Tag{0x6000, 0x0060}, "CS", "ACR_NEMA_2C_OverlayCompressionCode", "1"}
+	tagDict[Tag{0x6000, 0x0061}] = TagInfo{Tag{0x6000, 0x0061}, "SH", "ACR_NEMA_2C_OverlayCompressionOriginator", "1"}
+	tagDict[Tag{0x6000, 0x0062}] = TagInfo{Tag{0x6000, 0x0062}, "SH", "ACR_NEMA_2C_OverlayCompressionLabel", "1"}
+	tagDict[Tag{0x6000, 0x0063}] = TagInfo{Tag{0x6000, 0x0063}, "SH", "ACR_NEMA_2C_OverlayCompressionDescription", "1"}
+	tagDict[Tag{0x6000, 0x0066}] = TagInfo{Tag{0x6000, 0x0066}, "AT", "ACR_NEMA_2C_OverlayCompressionStepPointers", "1-n"}
+	tagDict[Tag{0x6000, 0x0068}] = TagInfo{Tag{0x6000, 0x0068}, "US", "ACR_NEMA_2C_OverlayRepeatInterval", "1"}
+	tagDict[Tag{0x6000, 0x0069}] = TagInfo{Tag{0x6000, 0x0069}, "US", "ACR_NEMA_2C_OverlayBitsGrouped", "1"}
+	tagDict[Tag{0x6000, 0x0800}] = TagInfo{Tag{0x6000, 0x0800}, "CS", "ACR_NEMA_2C_OverlayCodeLabel", "1-n"}
+	tagDict[Tag{0x6000, 0x0802}] = TagInfo{Tag{0x6000, 0x0802}, "US", "ACR_NEMA_2C_OverlayNumberOfTables", "1"}
+	tagDict[Tag{0x6000, 0x0803}] = TagInfo{Tag{0x6000, 0x0803}, "AT", "ACR_NEMA_2C_OverlayCodeTableLocation", "1-n"}
+	tagDict[Tag{0x6000, 0x0804}] = TagInfo{Tag{0x6000, 0x0804}, "US", "ACR_NEMA_2C_OverlayBitsForCodeWord", "1"}
+	tagDict[Tag{0x7F00, 0x0000}] = TagInfo{Tag{0x7F00, 0x0000}, "UL", "ACR_NEMA_2C_VariablePixelDataGroupLength", "1"}
+	tagDict[Tag{0x7F00, 0x0010}] = TagInfo{Tag{0x7F00, 0x0010}, "OW", "ACR_NEMA_2C_VariablePixelData", "1"}
+	tagDict[Tag{0x7F00, 0x0011}] = TagInfo{Tag{0x7F00, 0x0011}, "AT", "ACR_NEMA_2C_VariableNextDataGroup", "1"}
+	tagDict[Tag{0x7F00, 0x0020}] = TagInfo{Tag{0x7F00, 0x0020}, "OW", "ACR_NEMA_2C_VariableCoefficientsSDVN", "1-n"}
+	tagDict[Tag{0x7F00, 0x0030}] = TagInfo{Tag{0x7F00, 0x0030}, "OW", "ACR_NEMA_2C_VariableCoefficientsSDHN", "1-n"}
+	tagDict[Tag{0x7F00, 0x0040}] = TagInfo{Tag{0x7F00, 0x0040}, "OW", "ACR_NEMA_2C_VariableCoefficientsSDDN", "1-n"}
 	tagDict[Tag{0x7FE0, 0x0020}] = TagInfo{Tag{0x7FE0, 0x0020}, "OW", "ACR_NEMA_2C_CoefficientsSDVN", "1-n"}
 	tagDict[Tag{0x7FE0, 0x0030}] = TagInfo{Tag{0x7FE0, 0x0030}, "OW", "ACR_NEMA_2C_CoefficientsSDHN", "1-n"}
 	tagDict[Tag{0x7FE0, 0x0040}] = TagInfo{Tag{0x7FE0, 0x0040}, "OW", "ACR_NEMA_2C_CoefficientsSDDN", "1-n"}
@@ -6895,7 +6968,7 @@ func maybeInitTagDict() {
 	tagDict[Tag{0x0028, 0x1111}] = TagInfo{Tag{0x0028, 0x1111}, "US", "RETIRED_LargeRedPaletteColorLookupTableDescriptor", "4"}
 	tagDict[Tag{0x0028, 0x1112}] = TagInfo{Tag{0x0028, 0x1112}, "US", "RETIRED_LargeGreenPaletteColorLookupTableDescriptor", "4"}
 	tagDict[Tag{0x0028, 0x1113}] = TagInfo{Tag{0x0028, 0x1113}, "US", "RETIRED_LargeBluePaletteColorLookupTableDescriptor", "4"}
-	tagDict[Tag{0x0028, 0x1200}] = TagInfo{Tag{0x0028, 0x1200}, "LT", "RETIRED_GrayLookupTableData", "1-n"}
+	tagDict[Tag{0x0028, 0x1200}] = TagInfo{Tag{0x0028, 0x1200}, "US", "RETIRED_GrayLookupTableData", "1-n"}
 	tagDict[Tag{0x0028, 0x1211}] = TagInfo{Tag{0x0028, 0x1211}, "OW", "RETIRED_LargeRedPaletteColorLookupTableData", "1"}
 	tagDict[Tag{0x0028, 0x1212}] = TagInfo{Tag{0x0028, 0x1212}, "OW", "RETIRED_LargeGreenPaletteColorLookupTableData", "1"}
 	tagDict[Tag{0x0028, 0x1213}] = TagInfo{Tag{0x0028, 0x1213}, "OW", "RETIRED_LargeBluePaletteColorLookupTableData", "1"}
@@ -7093,7 +7166,105 @@ func maybeInitTagDict() {
 	tagDict[Tag{0x4008, 0x0212}] = TagInfo{Tag{0x4008, 0x0212}, "CS", "RETIRED_InterpretationStatusID", "1"}
 	tagDict[Tag{0x4008, 0x0300}] = TagInfo{Tag{0x4008, 0x0300}, "ST", "RETIRED_Impressions", "1"}
 	tagDict[Tag{0x4008, 0x4000}] = TagInfo{Tag{0x4008, 0x4000}, "ST", "RETIRED_ResultsComments", "1"}
+	tagDict[Tag{0x5000, 0x0005}] = TagInfo{Tag{0x5000, 0x0005}, "US", "RETIRED_CurveDimensions", "1"}
+	tagDict[Tag{0x5000, 0x0010}] = TagInfo{Tag{0x5000, 0x0010}, "US", "RETIRED_NumberOfPoints", "1"}
+	tagDict[Tag{0x5000, 0x0020}] = TagInfo{Tag{0x5000, 0x0020}, "CS", "RETIRED_TypeOfData", "1"}
+	tagDict[Tag{0x5000, 0x0022}] = TagInfo{Tag{0x5000, 0x0022}, "LO", "RETIRED_CurveDescription", "1"}
+	tagDict[Tag{0x5000, 0x0030}] = TagInfo{Tag{0x5000, 0x0030}, "SH", "RETIRED_AxisUnits", "1-n"}
+	tagDict[Tag{0x5000, 0x0040}] = TagInfo{Tag{0x5000, 0x0040}, "SH", "RETIRED_AxisLabels", "1-n"}
+	tagDict[Tag{0x5000, 0x0103}] = TagInfo{Tag{0x5000, 0x0103}, "US", "RETIRED_DataValueRepresentation", "1"}
+	tagDict[Tag{0x5000, 0x0104}] = TagInfo{Tag{0x5000, 0x0104}, "US", "RETIRED_MinimumCoordinateValue", "1-n"}
+	tagDict[Tag{0x5000, 0x0105}] = TagInfo{Tag{0x5000, 0x0105}, "US", "RETIRED_MaximumCoordinateValue", "1-n"}
+	tagDict[Tag{0x5000, 0x0106}] = TagInfo{Tag{0x5000, 0x0106}, "SH", "RETIRED_CurveRange", "1-n"}
+	tagDict[Tag{0x5000, 0x0110}] = TagInfo{Tag{0x5000, 0x0110}, "US", "RETIRED_CurveDataDescriptor", "1-n"}
+	tagDict[Tag{0x5000, 0x0112}] = TagInfo{Tag{0x5000, 0x0112}, "US", "RETIRED_CoordinateStartValue", "1-n"}
+	tagDict[Tag{0x5000, 0x0114}] = TagInfo{Tag{0x5000, 0x0114}, "US", "RETIRED_CoordinateStepValue", "1-n"}
+	tagDict[Tag{0x5000, 0x1001}] = TagInfo{Tag{0x5000, 0x1001}, "CS", "RETIRED_CurveActivationLayer", "1"}
+	tagDict[Tag{0x5000, 0x2000}] = TagInfo{Tag{0x5000, 0x2000}, "US", "RETIRED_AudioType", "1"}
+	tagDict[Tag{0x5000, 0x2002}] = TagInfo{Tag{0x5000, 0x2002}, "US", "RETIRED_AudioSampleFormat", "1"}
+	tagDict[Tag{0x5000, 0x2004}] = TagInfo{Tag{0x5000, 0x2004}, "US", "RETIRED_NumberOfChannels", "1"}
+	tagDict[Tag{0x5000, 0x2006}] = TagInfo{Tag{0x5000, 0x2006}, "UL", "RETIRED_NumberOfSamples", "1"}
+	tagDict[Tag{0x5000, 0x2008}] = TagInfo{Tag{0x5000, 0x2008}, "UL", "RETIRED_SampleRate", "1"}
+	tagDict[Tag{0x5000, 0x200A}] = TagInfo{Tag{0x5000, 0x200A}, "UL", "RETIRED_TotalTime", "1"}
+	tagDict[Tag{0x5000, 0x200C}] = TagInfo{Tag{0x5000, 0x200C}, "OW", "RETIRED_AudioSampleData", "1"}
+	tagDict[Tag{0x5000, 0x200E}] = TagInfo{Tag{0x5000, 0x200E}, "LT", "RETIRED_AudioComments", "1"}
+	tagDict[Tag{0x5000, 0x2500}] = TagInfo{Tag{0x5000, 0x2500}, "LO", "RETIRED_CurveLabel", "1"}
+	tagDict[Tag{0x5000, 0x2600}] = TagInfo{Tag{0x5000, 0x2600}, "SQ", "RETIRED_CurveReferencedOverlaySequence", "1"}
+	tagDict[Tag{0x5000, 0x2610}] = TagInfo{Tag{0x5000, 0x2610}, "US", "RETIRED_CurveReferencedOverlayGroup", "1"}
+	tagDict[Tag{0x5000, 0x3000}] = TagInfo{Tag{0x5000, 0x3000}, "OW", "RETIRED_CurveData", "1"}
+	tagDict[Tag{0x6000, 0x0012}] = TagInfo{Tag{0x6000, 0x0012}, "US", "RETIRED_OverlayPlanes", "1"}
+	tagDict[Tag{0x6000, 0x0052}] = TagInfo{Tag{0x6000, 0x0052}, "US", "RETIRED_OverlayPlaneOrigin", "1"}
+	tagDict[Tag{0x6000, 0x0060}] = TagInfo{Tag{0x6000, 0x0060}, "CS", "RETIRED_OverlayCompressionCode", "1"}
+	tagDict[Tag{0x6000, 0x0061}] = TagInfo{Tag{0x6000, 0x0061}, "SH", "RETIRED_OverlayCompressionOriginator", "1"}
+	tagDict[Tag{0x6000, 0x0062}] = TagInfo{Tag{0x6000, 0x0062}, "SH", "RETIRED_OverlayCompressionLabel", "1"}
+	tagDict[Tag{0x6000, 0x0063}] = TagInfo{Tag{0x6000, 0x0063}, "CS", "RETIRED_OverlayCompressionDescription", "1"}
+	tagDict[Tag{0x6000, 0x0066}] = TagInfo{Tag{0x6000, 0x0066}, "AT", "RETIRED_OverlayCompressionStepPointers", "1-n"}
+	tagDict[Tag{0x6000, 0x0068}] = TagInfo{Tag{0x6000, 0x0068}, "US", "RETIRED_OverlayRepeatInterval", "1"}
+	tagDict[Tag{0x6000, 0x0069}] = TagInfo{Tag{0x6000, 0x0069}, "US", "RETIRED_OverlayBitsGrouped", "1"}
+	tagDict[Tag{0x6000, 0x0110}] = TagInfo{Tag{0x6000, 0x0110}, "CS", "RETIRED_OverlayFormat", "1"}
+	tagDict[Tag{0x6000, 0x0200}] = TagInfo{Tag{0x6000, 0x0200}, "US", "RETIRED_OverlayLocation", "1"}
+	tagDict[Tag{0x6000, 0x0800}] = TagInfo{Tag{0x6000, 0x0800}, "CS", "RETIRED_OverlayCodeLabel", "1-n"}
+	tagDict[Tag{0x6000, 0x0802}] = TagInfo{Tag{0x6000, 0x0802}, "US", "RETIRED_OverlayNumberOfTables", "1"}
+	tagDict[Tag{0x6000, 0x0803}] = TagInfo{Tag{0x6000, 0x0803}, "AT", "RETIRED_OverlayCodeTableLocation", "1-n"}
+	tagDict[Tag{0x6000, 0x0804}] = TagInfo{Tag{0x6000, 0x0804}, "US", "RETIRED_OverlayBitsForCodeWord", "1"}
+	tagDict[Tag{0x6000, 0x1100}] = TagInfo{Tag{0x6000, 0x1100}, "US", "RETIRED_OverlayDescriptorGray", "1"}
+	tagDict[Tag{0x6000, 0x1101}] = TagInfo{Tag{0x6000, 0x1101}, "US", "RETIRED_OverlayDescriptorRed", "1"}
+	tagDict[Tag{0x6000, 0x1102}] = TagInfo{Tag{0x6000, 0x1102}, "US", "RETIRED_OverlayDescriptorGreen", "1"}
+	tagDict[Tag{0x6000, 0x1103}] = TagInfo{Tag{0x6000, 0x1103}, "US", "RETIRED_OverlayDescriptorBlue", "1"}
+	tagDict[Tag{0x6000, 0x1200}] = TagInfo{Tag{0x6000, 0x1200}, "US", "RETIRED_OverlaysGray", "1-n"}
+	tagDict[Tag{0x6000, 0x1201}] = TagInfo{Tag{0x6000, 0x1201}, "US", "RETIRED_OverlaysRed", "1-n"}
+	tagDict[Tag{0x6000, 0x1202}] = TagInfo{Tag{0x6000, 0x1202}, "US", "RETIRED_OverlaysGreen", "1-n"}
+	tagDict[Tag{0x6000, 0x1203}] = TagInfo{Tag{0x6000, 0x1203}, "US", "RETIRED_OverlaysBlue", "1-n"}
+	tagDict[Tag{0x6000, 0x4000}] = TagInfo{Tag{0x6000, 0x4000}, "LT", "RETIRED_OverlayComments", "1"}
 	tagDict[Tag{0x7FE0, 0x0020}] = TagInfo{Tag{0x7FE0, 0x0020}, "OW", "RETIRED_CoefficientsSDVN", "1"}
 	tagDict[Tag{0x7FE0, 0x0030}] = TagInfo{Tag{0x7FE0, 0x0030}, "OW", "RETIRED_CoefficientsSDHN", "1"}
 	tagDict[Tag{0x7FE0, 0x0040}] = TagInfo{Tag{0x7FE0, 0x0040}, "OW", "RETIRED_CoefficientsSDDN", "1"}
+	tagDict[Tag{0x7F00, 0x0010}] = TagInfo{Tag{0x7F00, 0x0010}, "OW", "RETIRED_VariablePixelData", "1"}
+	tagDict[Tag{0x7F00, 0x0011}] = TagInfo{Tag{0x7F00, 0x0011}, "US", "RETIRED_VariableNextDataGroup", "1"}
+	tagDict[Tag{0x7F00, 0x0020}] = TagInfo{Tag{0x7F00, 0x0020}, "OW", "RETIRED_VariableCoefficientsSDVN", "1"}
+	tagDict[Tag{0x7F00, 0x0030}] = TagInfo{Tag{0x7F00, 0x0030}, "OW", "RETIRED_VariableCoefficientsSDHN", "1"}
+	tagDict[Tag{0x7F00, 0x0040}] = TagInfo{Tag{0x7F00, 0x0040}, "OW", "RETIRED_VariableCoefficientsSDDN", "1"}
+	altVRDict = make(map[Tag][]string)
+	altVRDict[Tag{0x0004, 0x1200}] = []string{"UP", "UL"}
+	altVRDict[Tag{0x0004, 0x1202}] = []string{"UP", "UL"}
+	altVRDict[Tag{0x0004, 0x1400}] = []string{"UP", "UL"}
+	altVRDict[Tag{0x0004, 0x1420}] = []string{"UP", "UL"}
+	altVRDict[Tag{0x0014, 0x3050}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x0014, 0x3070}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x0028, 0x0106}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x0107}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x0108}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x0109}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x0120}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x0121}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x1101}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x1102}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x1103}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x3002}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x3006}] = []string{"US", "SS", "OW"}
+	altVRDict[Tag{0x0040, 0x9211}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0040, 0x9216}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0060, 0x3004}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0060, 0x3006}] = []string{"US", "SS"}
+	altVRDict[Tag{0x5400, 0x0110}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x5400, 0x0112}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x5400, 0x100A}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x5400, 0x1010}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x6000, 0x3000}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x7FE0, 0x0010}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x0022, 0x1452}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x0104}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x0105}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x1100}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x1200}] = []string{"US", "SS", "OW"}
+	altVRDict[Tag{0x0028, 0x0071}] = []string{"US", "SS"}
+	altVRDict[Tag{0x7F00, 0x0010}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x0004, 0x1504}] = []string{"UP", "UL"}
+	altVRDict[Tag{0x0028, 0x0110}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x0111}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x1111}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x1112}] = []string{"US", "SS"}
+	altVRDict[Tag{0x0028, 0x1113}] = []string{"US", "SS"}
+	altVRDict[Tag{0x5000, 0x200C}] = []string{"OW", "OB"}
+	altVRDict[Tag{0x5000, 0x3000}] = []string{"OW", "OB"}
 }
@@ -62,3 +62,86 @@ func BenchmarkFindPixelDataTag(b *testing.B) {
 
 	}
 }
+
+func TestAllowedVRs(t *testing.T) {
+	vrs, err := AllowedVRs(SmallestImagePixelValue)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(vrs) != 2 || vrs[0] != "US" || vrs[1] != "SS" {
+		t.Errorf("Wrong VRs for SmallestImagePixelValue: %v", vrs)
+	}
+	vrs, err = AllowedVRs(PatientName)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(vrs) != 1 || vrs[0] != "PN" {
+		t.Errorf("Wrong VRs for PatientName: %v", vrs)
+	}
+	// Listed both as ACR_NEMA_ and RETIRED_; the latter wins.
+	vrs, err = AllowedVRs(Tag{0x0028, 0x1200})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(vrs) != 3 || vrs[2] != "OW" {
+		t.Errorf("Wrong VRs for (0028,1200): %v", vrs)
+	}
+}
+
+func TestFindRepeatingGroup(t *testing.T) {
+	elem, err := Find(Tag{0x6002, 0x3000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elem.Name != "OverlayData" || elem.VR != "OW" || (elem.Tag != Tag{0x6002, 0x3000}) {
+		t.Errorf("Wrong element: %v", elem)
+	}
+	vrs, err := AllowedVRs(Tag{0x601e, 0x3000})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(vrs) != 2 || vrs[0] != "OW" || vrs[1] != "OB" {
+		t.Errorf("Wrong VRs for OverlayData: %v", vrs)
+	}
+	elem, err = Find(Tag{0x7f02, 0x0010})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elem.Name != "RETIRED_VariablePixelData" || (elem.Tag != Tag{0x7f02, 0x0010}) {
+		t.Errorf("Wrong element: %v", elem)
+	}
+	// PixelData isn't in a repeating group.
+	if _, err := Find(Tag{0x7fe2, 0x0010}); err == nil {
+		t.Errorf("Found (7fe2,0010)")
+	}
+	// Odd groups are private, and 6020 is past the range.
+	for _, tag := range []Tag{{0x6001, 0x3000}, {0x6020, 0x3000}} {
+		if _, err := Find(tag); err == nil {
+			t.Errorf("Find(%v) succeeded", tag)
+		}
+	}
+}
+
+func TestFindPrivate(t *testing.T) {
+	if err := RegisterPrivateTag("ACME 1.0", TagInfo{Tag{0x0009, 0x1001}, "DS", "AcmeGain", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterPrivateTag("ACME 1.0", TagInfo{Tag{0x0008, 0x1001}, "DS", "AcmeGain", "1"}); err == nil {
+		t.Error("RegisterPrivateTag accepted a public tag")
+	}
+	// The block assigned to the creator doesn't matter.
+	elem, err := FindPrivate("ACME 1.0", Tag{0x0009, 0x1201})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elem.Name != "AcmeGain" || elem.VR != "DS" || (elem.Tag != Tag{0x0009, 0x1201}) {
+		t.Errorf("Wrong element: %v", elem)
+	}
+	if _, err := FindPrivate("OTHER", Tag{0x0009, 0x1001}); err == nil {
+		t.Error("FindPrivate found a tag of another creator")
+	}
+	elem, err = FindPrivate("", Tag{0x0009, 0x0012})
+	if err != nil || elem.VR != "LO" {
+		t.Errorf("Wrong private creator element: %v, %v", elem, err)
+	}
+}
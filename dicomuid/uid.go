@@ -7,6 +7,7 @@ package dicomuid
 
 import (
 	"fmt"
+	"strings"
 )
 
 type UIDType string
@@ -490,3 +491,26 @@ func UIDString(uid string) string {
 	}
 	return fmt.Sprintf("%s[%s]", uid, e.Name)
 }
+
+// Validate checks that uid is well formed, as per P3.5 9.1: at most 64
+// characters, made of numeric components separated by dots, with no leading
+// zero in a multi-digit component.
+func Validate(uid string) error {
+	if len(uid) == 0 || len(uid) > 64 {
+		return fmt.Errorf("UID '%s' must have 1 to 64 characters", uid)
+	}
+	for _, component := range strings.Split(uid, ".") {
+		if component == "" {
+			return fmt.Errorf("UID '%s' has an empty component", uid)
+		}
+		if len(component) > 1 && component[0] == '0' {
+			return fmt.Errorf("UID '%s' has a component with a leading zero", uid)
+		}
+		for _, c := range component {
+			if c < '0' || c > '9' {
+				return fmt.Errorf("UID '%s' has a non-digit character '%c'", uid, c)
+			}
+		}
+	}
+	return nil
+}
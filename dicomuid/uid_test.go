@@ -1,6 +1,7 @@
 package dicomuid_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/suyashkumar/dicom/dicomuid"
@@ -16,3 +17,12 @@ func TestLookupUID(t *testing.T) {
 	assert.Equal(t, u.Name, "dicomTransferCapability")
 	assert.Equal(t, string(u.Type), "LDAP OID")
 }
+
+func TestValidate(t *testing.T) {
+	for _, uid := range []string{"1.2.840.10008.1.2", "0", "1.0.2", dicomuid.ExplicitVRLittleEndian} {
+		assert.NoError(t, dicomuid.Validate(uid), uid)
+	}
+	for _, uid := range []string{"", "1..2", "1.2.", "1.02", "1.2a", " 1.2", "1." + strings.Repeat("2", 63)} {
+		assert.Error(t, dicomuid.Validate(uid), uid)
+	}
+}
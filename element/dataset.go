@@ -2,9 +2,13 @@ package element
 
 import (
 	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/suyashkumar/dicom/dicomio"
 	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/frame"
 )
 
 // DataSet represents contents of one DICOM file.
@@ -28,14 +32,328 @@ func (f *DataSet) FindElementByTag(tag dicomtag.Tag) (*Element, error) {
 	return FindByTag(f.Elements, tag)
 }
 
-func (ds *DataSet) TransferSyntax() (bo binary.ByteOrder, implicit dicomio.IsImplicitVR, err error) {
-	elem, err := ds.FindElementByTag(dicomtag.TransferSyntaxUID)
+// GetString returns the value of the element with the given tag, which must
+// hold exactly one string.
+func (ds *DataSet) GetString(tag dicomtag.Tag) (string, error) {
+	elem, err := ds.FindElementByTag(tag)
 	if err != nil {
-		return nil, dicomio.UnknownVR, err
+		return "", err
+	}
+	return elem.GetString()
+}
+
+// GetStrings returns the values of the element with the given tag, which must
+// all be strings.
+func (ds *DataSet) GetStrings(tag dicomtag.Tag) ([]string, error) {
+	elem, err := ds.FindElementByTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	return elem.GetStrings()
+}
+
+// GetInt returns the value of the element with the given tag, which must hold
+// exactly one integer, as for GetInts.
+func (ds *DataSet) GetInt(tag dicomtag.Tag) (int64, error) {
+	values, err := ds.GetInts(tag)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) != 1 {
+		return 0, fmt.Errorf("%v: found %d value(s) (expect 1)", dicomtag.DebugString(tag), len(values))
+	}
+	return values[0], nil
+}
+
+// GetInts returns the values of the element with the given tag as integers:
+// those of the binary integer VRs (SS, US, SL, UL, SV, UV), and those of IS
+// elements, parsed from their strings.
+func (ds *DataSet) GetInts(tag dicomtag.Tag) ([]int64, error) {
+	elem, err := ds.FindElementByTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	if elem.VR != "IS" {
+		return elem.GetInts()
 	}
-	transferSyntaxUID, err := elem.GetString()
+	values := make([]int64, len(elem.Value))
+	for i, v := range elem.Value {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("string value not found in %v", elem)
+		}
+		if values[i], err = strconv.ParseInt(strings.Trim(s, " "), 10, 64); err != nil {
+			return nil, fmt.Errorf("%v: %v", dicomtag.DebugString(tag), err)
+		}
+	}
+	return values, nil
+}
+
+// GetFloats returns the values of the element with the given tag as floats:
+// those of FL and FD elements, and those of DS elements, parsed from their
+// strings.
+func (ds *DataSet) GetFloats(tag dicomtag.Tag) ([]float64, error) {
+	elem, err := ds.FindElementByTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float64, len(elem.Value))
+	for i, v := range elem.Value {
+		switch v := v.(type) {
+		case float32:
+			values[i] = float64(v)
+		case float64:
+			values[i] = v
+		case string:
+			if elem.VR != "DS" {
+				return nil, fmt.Errorf("float value not found in %v", elem)
+			}
+			if values[i], err = strconv.ParseFloat(strings.Trim(v, " "), 64); err != nil {
+				return nil, fmt.Errorf("%v: %v", dicomtag.DebugString(tag), err)
+			}
+		default:
+			return nil, fmt.Errorf("float value not found in %v", elem)
+		}
+	}
+	return values, nil
+}
+
+// GetBytes returns the value of the element with the given tag, which must
+// hold exactly one []byte, as elements of the OB, OW, UN and other binary VRs
+// do.
+func (ds *DataSet) GetBytes(tag dicomtag.Tag) ([]byte, error) {
+	elem, err := ds.FindElementByTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	if len(elem.Value) != 1 {
+		return nil, fmt.Errorf("%v: found %d value(s) (expect 1)", dicomtag.DebugString(tag), len(elem.Value))
+	}
+	v, ok := elem.Value[0].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("bytes value not found in %v", elem)
+	}
+	return v, nil
+}
+
+// String returns the elements of the dataset, one per line, in the style of
+// dcmdump. Items of sequences are indented below them.
+func (ds *DataSet) String() string {
+	lines := make([]string, len(ds.Elements))
+	for i, elem := range ds.Elements {
+		lines[i] = elem.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (ds *DataSet) TransferSyntax() (bo binary.ByteOrder, implicit dicomio.IsImplicitVR, err error) {
+	transferSyntaxUID, err := ds.GetString(dicomtag.TransferSyntaxUID)
 	if err != nil {
 		return nil, dicomio.UnknownVR, err
 	}
 	return dicomio.ParseTransferSyntaxUID(transferSyntaxUID)
 }
+
+// MergePolicy tells DataSet.Merge what to do with a tag found in both
+// datasets.
+type MergePolicy int
+
+const (
+	// MergeLastWins keeps the element of the other dataset, in place of the
+	// one it replaces.
+	MergeLastWins MergePolicy = iota
+	// MergeRejectDuplicates makes Merge fail on the first tag found in both
+	// datasets, or twice in the other one.
+	MergeRejectDuplicates
+)
+
+// Merge returns a new dataset with the elements of ds followed by those of
+// other, e.g., to combine meta elements and body elements built separately.
+// The meta elements (Tag.Group==2) of both come first, so that the result is
+// written like any parsed dataset. Tags found in both datasets are resolved as
+// per policy. Neither dataset is modified, but the elements are shared.
+//
+//  ds, err := meta.Merge(body, element.MergeRejectDuplicates)
+func (ds *DataSet) Merge(other *DataSet, policy MergePolicy) (*DataSet, error) {
+	var meta, body []*Element
+	index := make(map[dicomtag.Tag]int) // Position of each tag in meta or body.
+	for _, elem := range ds.Elements {
+		if elem.Tag.Group == dicomtag.MetadataGroup {
+			index[elem.Tag] = len(meta)
+			meta = append(meta, elem)
+		} else {
+			index[elem.Tag] = len(body)
+			body = append(body, elem)
+		}
+	}
+	for _, elem := range other.Elements {
+		elems := &body
+		if elem.Tag.Group == dicomtag.MetadataGroup {
+			elems = &meta
+		}
+		i, ok := index[elem.Tag]
+		if !ok {
+			index[elem.Tag] = len(*elems)
+			*elems = append(*elems, elem)
+			continue
+		}
+		if policy == MergeRejectDuplicates {
+			return nil, fmt.Errorf("element.DataSet.Merge: %v found more than once", dicomtag.DebugString(elem.Tag))
+		}
+		(*elems)[i] = elem
+	}
+	return &DataSet{Elements: append(meta, body...)}, nil
+}
+
+// Clone returns a deep copy of ds: its elements, their values and the items
+// of its sequences are copied, so that the copy can be modified while ds is
+// being written, e.g., to write the same dataset to many destinations at once
+// with a few elements changed for each. Only the pixels of PixelData frames,
+// and the readers of a PixelDataStream, are shared with ds; a PixelDataStream
+// can still be written only once. RawBytes are left out, so that elements
+// modified in the copy are re-encoded even with write.WithFaithfulCopy.
+//
+//  ds2 := ds.Clone()
+//  elem, err := ds2.FindElementByTag(dicomtag.PatientID)
+//  elem.Value = []interface{}{"12345678"}
+func (ds *DataSet) Clone() *DataSet {
+	clone := &DataSet{Elements: make([]*Element, len(ds.Elements))}
+	for i, elem := range ds.Elements {
+		clone.Elements[i] = cloneElement(elem)
+	}
+	return clone
+}
+
+func cloneElement(elem *Element) *Element {
+	clone := *elem
+	clone.Value = make([]interface{}, len(elem.Value))
+	for i, value := range elem.Value {
+		switch v := value.(type) {
+		case *Element:
+			clone.Value[i] = cloneElement(v)
+		case SequenceItemValue:
+			if v.DataSet != nil {
+				v.DataSet = v.DataSet.Clone()
+			}
+			clone.Value[i] = v
+		case []byte:
+			clone.Value[i] = append([]byte(nil), v...)
+		case PixelDataInfo:
+			v.Offsets = append([]uint32(nil), v.Offsets...)
+			v.Frames = append([]frame.Frame(nil), v.Frames...)
+			clone.Value[i] = v
+		default:
+			// Strings, numbers and Tags are immutable.
+			clone.Value[i] = value
+		}
+	}
+	clone.RawBytes = nil
+	clone.RawDigest = nil
+	return &clone
+}
+
+// ValidationIssue is a problem found by DataSet.Validate.
+type ValidationIssue struct {
+	// Tag of the offending element, or the missing one.
+	Tag     dicomtag.Tag
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%v: %v", dicomtag.DebugString(i.Tag), i.Message)
+}
+
+// Validate checks that the dataset can be written as a conformant DICOM file,
+// and returns the problems found, if any:
+//
+// - a required meta element is missing, or the transfer syntax is unknown.
+// MediaStorageSOPClassUID and MediaStorageSOPInstanceUID may be missing if
+// SOPClassUID and SOPInstanceUID can stand in for them.
+//
+// - an element's VR is not one the DICOM standard allows for its tag.
+//
+// - a value of a binary VR (OB, OW, OL, OF, OD or UN) given as []byte has an
+// odd length, e.g., one that can't be split into 16-bit words for OW. String
+// values of odd length are padded when written.
+//
+// - a tag appears more than once in the dataset or in an item, including
+// items given as SequenceItemValue.
+func (ds *DataSet) Validate() []ValidationIssue {
+	var issues []ValidationIssue
+	if elem, err := ds.FindElementByTag(dicomtag.TransferSyntaxUID); err != nil {
+		issues = append(issues, ValidationIssue{dicomtag.TransferSyntaxUID, "missing required meta element"})
+	} else if uid, err := elem.GetString(); err != nil {
+		issues = append(issues, ValidationIssue{dicomtag.TransferSyntaxUID, err.Error()})
+	} else if _, err := dicomio.CanonicalTransferSyntaxUID(uid); err != nil {
+		issues = append(issues, ValidationIssue{dicomtag.TransferSyntaxUID, err.Error()})
+	}
+	for _, tags := range [][2]dicomtag.Tag{
+		{dicomtag.MediaStorageSOPClassUID, dicomtag.SOPClassUID},
+		{dicomtag.MediaStorageSOPInstanceUID, dicomtag.SOPInstanceUID},
+	} {
+		_, err := ds.FindElementByTag(tags[0])
+		_, sourceErr := ds.FindElementByTag(tags[1])
+		if err != nil && sourceErr != nil {
+			issues = append(issues, ValidationIssue{tags[0], "missing required meta element"})
+		}
+	}
+	return validateElements(ds.Elements, issues)
+}
+
+// validateElements appends the issues found in elems, and the items nested in
+// them, to issues.
+func validateElements(elems []*Element, issues []ValidationIssue) []ValidationIssue {
+	seen := make(map[dicomtag.Tag]bool)
+	for _, elem := range elems {
+		if seen[elem.Tag] && elem.Tag != dicomtag.Item {
+			issues = append(issues, ValidationIssue{elem.Tag, "duplicate tag"})
+		}
+		seen[elem.Tag] = true
+		if elem.VR != "" && elem.Tag != dicomtag.Item {
+			if allowed, err := dicomtag.AllowedVRs(elem.Tag); err == nil && !containsVR(allowed, elem.VR) {
+				issues = append(issues, ValidationIssue{elem.Tag,
+					fmt.Sprintf("VR %v is not allowed, the DICOM standard defines VR to be %v", elem.VR, strings.Join(allowed, " or "))})
+			}
+		}
+		if isBinaryVR(elem.VR) && len(elem.Value) == 1 {
+			if data, ok := elem.Value[0].([]byte); ok && len(data)%2 != 0 {
+				issues = append(issues, ValidationIssue{elem.Tag, fmt.Sprintf("odd value length %v for VR %v", len(data), elem.VR)})
+			}
+		}
+		if elem.VR == "SQ" || elem.Tag == dicomtag.Item {
+			var children []*Element
+			for _, value := range elem.Value {
+				switch v := value.(type) {
+				case *Element:
+					children = append(children, v)
+				case SequenceItemValue:
+					// Each item is a dataset of its own.
+					if v.DataSet != nil {
+						issues = validateElements(v.DataSet.Elements, issues)
+					}
+				}
+			}
+			issues = validateElements(children, issues)
+		}
+	}
+	return issues
+}
+
+// isBinaryVR reports whether vr is one of those Validate checks for values of
+// odd length.
+func isBinaryVR(vr string) bool {
+	switch vr {
+	case "OB", "OW", "OL", "OF", "OD", "UN":
+		return true
+	}
+	return false
+}
+
+func containsVR(vrs []string, vr string) bool {
+	for _, v := range vrs {
+		if v == vr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package element_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/dicomuid"
+	"github.com/suyashkumar/dicom/element"
+)
+
+// newTestDataSet returns a dataset with the required meta elements for the
+// given transfer syntax, followed by elems.
+func newTestDataSet(transferSyntaxUID string, elems ...*element.Element) *element.DataSet {
+	return &element.DataSet{Elements: append([]*element.Element{
+		element.MustNewElement(dicomtag.TransferSyntaxUID, transferSyntaxUID),
+		element.MustNewElement(dicomtag.MediaStorageSOPClassUID, "1.2.840.10008.5.1.4.1.1.7"),
+		element.MustNewElement(dicomtag.MediaStorageSOPInstanceUID, "1.2.3.4.5.6.7"),
+	}, elems...)}
+}
+
+func TestDataSetMerge(t *testing.T) {
+	meta := newTestDataSet(dicomuid.ExplicitVRLittleEndian)
+	body := &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.PatientName, "Foo^Bar"),
+		// A meta element given with the body still goes to the meta group.
+		element.MustNewElement(dicomtag.ImplementationVersionName, "MERGED"),
+		element.MustNewElement(dicomtag.PatientID, "1234"),
+	}}
+	ds, err := body.Merge(meta, element.MergeRejectDuplicates)
+	require.NoError(t, err)
+	var tags []dicomtag.Tag
+	for _, elem := range ds.Elements {
+		tags = append(tags, elem.Tag)
+	}
+	assert.Equal(t, []dicomtag.Tag{
+		dicomtag.ImplementationVersionName,
+		dicomtag.TransferSyntaxUID,
+		dicomtag.MediaStorageSOPClassUID,
+		dicomtag.MediaStorageSOPInstanceUID,
+		dicomtag.PatientName,
+		dicomtag.PatientID,
+	}, tags)
+	assert.Len(t, body.Elements, 3)
+
+	// The last element wins, in place of the first.
+	update := &element.DataSet{Elements: []*element.Element{element.MustNewElement(dicomtag.PatientName, "Baz")}}
+	ds2, err := ds.Merge(update, element.MergeLastWins)
+	require.NoError(t, err)
+	assert.Equal(t, "Baz", ds2.Elements[4].MustGetString())
+	assert.Equal(t, "Foo^Bar", ds.Elements[4].MustGetString())
+	_, err = ds.Merge(update, element.MergeRejectDuplicates)
+	assert.Error(t, err)
+
+	// Same for a tag repeated within the other dataset.
+	repeated := &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.StudyID, "1"),
+		element.MustNewElement(dicomtag.StudyID, "2"),
+	}}
+	ds3, err := ds.Merge(repeated, element.MergeLastWins)
+	require.NoError(t, err)
+	require.Len(t, ds3.Elements, len(ds.Elements)+1)
+	assert.Equal(t, "2", ds3.Elements[len(ds.Elements)].MustGetString())
+	_, err = ds.Merge(repeated, element.MergeRejectDuplicates)
+	assert.Error(t, err)
+}
+
+func TestDataSetClone(t *testing.T) {
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.PatientName, "Foo^Bar"),
+		element.MustNewElement(dicomtag.ReferencedImageSequence,
+			newItem(false, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3"))),
+		element.MustNewElement(dicomtag.ReferencedSeriesSequence, element.SequenceItemValue{DataSet: &element.DataSet{
+			Elements: []*element.Element{element.MustNewElement(dicomtag.SeriesInstanceUID, "1.2.4")},
+		}}),
+		element.MustNewElement(dicomtag.EncapsulatedDocument, []byte{1, 2}))
+	ds.Elements[3].RawBytes = []byte{0x10, 0x00, 0x10, 0x00}
+	clone := ds.Clone()
+	assert.Empty(t, ds.Diff(clone))
+	assert.Nil(t, clone.Elements[3].RawBytes)
+	find := func(tag dicomtag.Tag) *element.Element {
+		elem, err := clone.FindElementByTag(tag)
+		require.NoError(t, err)
+		return elem
+	}
+	find(dicomtag.PatientName).Value[0] = "Baz"
+	find(dicomtag.ReferencedImageSequence).Value[0].(*element.Element).Value[0].(*element.Element).Value[0] = "4.5.6"
+	find(dicomtag.ReferencedSeriesSequence).Value[0].(element.SequenceItemValue).DataSet.Elements[0].Value[0] = "1.2.5"
+	find(dicomtag.EncapsulatedDocument).Value[0].([]byte)[0] = 3
+	assert.Len(t, ds.Diff(clone), 4)
+	elem, err := ds.FindElementByTag(dicomtag.PatientName)
+	require.NoError(t, err)
+	assert.Equal(t, "Foo^Bar", elem.MustGetString())
+}
+
+func TestDataSetAccessors(t *testing.T) {
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.ImageType, "ORIGINAL", "PRIMARY"),
+		element.MustNewElement(dicomtag.PatientName, "Doe^John"),
+		element.MustNewElement(dicomtag.InstanceNumber, "12"),
+		element.MustNewElement(dicomtag.ImagePositionPatient, "-1.5", "2", "1e3"),
+		element.MustNewElement(dicomtag.Rows, uint16(512)),
+		&element.Element{Tag: dicomtag.ReferencePixelPhysicalValueX, VR: "FD", Value: []interface{}{0.25}},
+		&element.Element{Tag: dicomtag.LUTData, VR: "OW", Value: []interface{}{[]byte{1, 2}}})
+
+	s, err := ds.GetString(dicomtag.PatientName)
+	require.NoError(t, err)
+	assert.Equal(t, "Doe^John", s)
+	_, err = ds.GetString(dicomtag.ImageType)
+	assert.Error(t, err, "more than one value")
+	_, err = ds.GetString(dicomtag.Rows)
+	assert.Error(t, err, "not a string")
+
+	strs, err := ds.GetStrings(dicomtag.ImageType)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ORIGINAL", "PRIMARY"}, strs)
+
+	n, err := ds.GetInt(dicomtag.Rows)
+	require.NoError(t, err)
+	assert.Equal(t, int64(512), n)
+	n, err = ds.GetInt(dicomtag.InstanceNumber)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), n)
+	ints, err := ds.GetInts(dicomtag.InstanceNumber)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{12}, ints)
+	_, err = ds.GetInts(dicomtag.PatientName)
+	assert.Error(t, err)
+
+	floats, err := ds.GetFloats(dicomtag.ImagePositionPatient)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{-1.5, 2, 1000}, floats)
+	floats, err = ds.GetFloats(dicomtag.ReferencePixelPhysicalValueX)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.25}, floats)
+	_, err = ds.GetFloats(dicomtag.PatientName)
+	assert.Error(t, err)
+
+	data, err := ds.GetBytes(dicomtag.LUTData)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2}, data)
+	_, err = ds.GetBytes(dicomtag.PatientName)
+	assert.Error(t, err)
+
+	// Missing elements are errors.
+	_, err = ds.GetString(dicomtag.PatientID)
+	assert.Error(t, err)
+	_, err = ds.GetInt(dicomtag.Columns)
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.PatientName, "Foo"),
+		&element.Element{
+			Tag: dicomtag.ReferencedImageSequence,
+			VR:  "SQ",
+			Value: []interface{}{newItem(false,
+				element.MustNewElement(dicomtag.Rows, uint16(1)),
+				element.MustNewElement(dicomtag.Columns, uint16(1)))},
+		})
+	assert.Empty(t, ds.Validate())
+
+	ds = &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.TransferSyntaxUID, "1.2.3"),
+		element.MustNewElement(dicomtag.SOPInstanceUID, "1.2.3.4.5.6.7"),
+		element.MustNewElement(dicomtag.PatientName, "Foo"),
+		element.MustNewElement(dicomtag.PatientName, "Bar"),
+		{Tag: dicomtag.LUTData, VR: "OW", Value: []interface{}{[]byte{1, 2, 3}}},
+		{
+			Tag: dicomtag.ReferencedImageSequence,
+			VR:  "SQ",
+			Value: []interface{}{
+				newItem(false, &element.Element{Tag: dicomtag.Rows, VR: "SS", Value: []interface{}{int16(1)}}),
+				newItem(false, element.MustNewElement(dicomtag.Rows, uint16(1))),
+			},
+		},
+	}}
+	var tags []dicomtag.Tag
+	for _, issue := range ds.Validate() {
+		tags = append(tags, issue.Tag)
+	}
+	assert.Equal(t, []dicomtag.Tag{
+		dicomtag.TransferSyntaxUID,
+		dicomtag.MediaStorageSOPClassUID,
+		dicomtag.PatientName,
+		dicomtag.LUTData,
+		dicomtag.Rows,
+	}, tags)
+
+	// Items given as SequenceItemValue are checked too, for odd lengths of
+	// any binary VR.
+	ds = newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.ReferencedSeriesSequence, element.SequenceItemValue{DataSet: &element.DataSet{
+			Elements: []*element.Element{
+				{Tag: dicomtag.Rows, VR: "SS", Value: []interface{}{int16(1)}},
+				element.MustNewElement(dicomtag.SeriesInstanceUID, "1.2.3"),
+				element.MustNewElement(dicomtag.SeriesInstanceUID, "1.2.4"),
+				{Tag: dicomtag.EncapsulatedDocument, VR: "OB", Value: []interface{}{[]byte{1, 2, 3}}},
+			},
+		}}))
+	tags = nil
+	for _, issue := range ds.Validate() {
+		tags = append(tags, issue.Tag)
+	}
+	assert.Equal(t, []dicomtag.Tag{
+		dicomtag.Rows,
+		dicomtag.SeriesInstanceUID,
+		dicomtag.EncapsulatedDocument,
+	}, tags)
+}
@@ -0,0 +1,294 @@
+package element
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/frame"
+)
+
+// floatTolerance is the relative difference below which two FL, FD or DS
+// values are considered equal, e.g., after DS values were formatted with
+// fewer digits.
+const floatTolerance = 1e-9
+
+// Equal reports whether e and other hold the same data: the same tag, VR and
+// values. Values are compared the way they'd be read back after writing, so
+// padding of strings and byte values, and numeric formatting of DS and IS,
+// don't matter; nor does UndefinedLength. A missing VR stands for the one in
+// the dictionary.
+func (e *Element) Equal(other *Element) bool {
+	return len(diffElement(e, other, "", nil)) == 0
+}
+
+// Diff returns the differences between ds and other, one per line, naming
+// the tags and items involved. Elements are matched by tag, regardless of
+// their order. The result is empty iff every element is Equal to its match.
+//
+//  for _, diff := range ds.Diff(ds2) {
+//    fmt.Println(diff)
+//  }
+func (ds *DataSet) Diff(other *DataSet) []string {
+	return diffElements(ds.Elements, other.Elements, "", nil)
+}
+
+// diffElements appends the differences between two lists of elements, each
+// prefixed with path, to diffs.
+func diffElements(a, b []*Element, path string, diffs []string) []string {
+	byTag := func(elems []*Element) map[dicomtag.Tag][]*Element {
+		m := make(map[dicomtag.Tag][]*Element)
+		for _, elem := range elems {
+			m[elem.Tag] = append(m[elem.Tag], elem)
+		}
+		return m
+	}
+	ma, mb := byTag(a), byTag(b)
+	var tags []dicomtag.Tag
+	for tag := range ma {
+		tags = append(tags, tag)
+	}
+	for tag := range mb {
+		if _, ok := ma[tag]; !ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Group != tags[j].Group {
+			return tags[i].Group < tags[j].Group
+		}
+		return tags[i].Element < tags[j].Element
+	})
+	for _, tag := range tags {
+		ea, eb := ma[tag], mb[tag]
+		for i := 0; i < len(ea) || i < len(eb); i++ {
+			switch {
+			case i >= len(eb):
+				diffs = append(diffs, fmt.Sprintf("%s%v: only in the first dataset", path, dicomtag.DebugString(tag)))
+			case i >= len(ea):
+				diffs = append(diffs, fmt.Sprintf("%s%v: only in the second dataset", path, dicomtag.DebugString(tag)))
+			default:
+				diffs = diffElement(ea[i], eb[i], path, diffs)
+			}
+		}
+	}
+	return diffs
+}
+
+// diffElement appends the differences between two elements, each prefixed
+// with path, to diffs.
+func diffElement(a, b *Element, path string, diffs []string) []string {
+	prefix := path + dicomtag.DebugString(a.Tag)
+	if a.Tag != b.Tag {
+		return append(diffs, fmt.Sprintf("%s: tag differs from %v", prefix, dicomtag.DebugString(b.Tag)))
+	}
+	vr, vrb := dictionaryVR(a), dictionaryVR(b)
+	if vr != vrb {
+		return append(diffs, fmt.Sprintf("%s: VR %v vs %v", prefix, vr, vrb))
+	}
+	if len(a.Value) != len(b.Value) {
+		return append(diffs, fmt.Sprintf("%s: %d values vs %d", prefix, len(a.Value), len(b.Value)))
+	}
+	for i := range a.Value {
+		va, vb := a.Value[i], b.Value[i]
+		if ia, ok := itemElements(va); ok {
+			if ib, ok := itemElements(vb); ok {
+				diffs = diffElements(ia, ib, fmt.Sprintf("%s item %d: ", prefix, i), diffs)
+				continue
+			}
+		}
+		if ea, ok := va.(*Element); ok {
+			if eb, ok := vb.(*Element); ok {
+				// An element in an item.
+				diffs = diffElement(ea, eb, prefix+" ", diffs)
+				continue
+			}
+		}
+		if msg := diffValue(vr, va, vb); msg != "" {
+			if len(a.Value) > 1 {
+				msg = fmt.Sprintf("value %d: %s", i, msg)
+			}
+			diffs = append(diffs, fmt.Sprintf("%s: %s", prefix, msg))
+		}
+	}
+	return diffs
+}
+
+// dictionaryVR returns the VR of e, or the one in the dictionary if e has
+// none.
+func dictionaryVR(e *Element) string {
+	if e.VR == "" && e.Tag != dicomtag.Item {
+		if entry, err := dicomtag.Find(e.Tag); err == nil {
+			return entry.VR
+		}
+	}
+	return e.VR
+}
+
+// itemElements returns the elements held by an item of a sequence, given as an
+// Item element or a SequenceItemValue.
+func itemElements(value interface{}) ([]*Element, bool) {
+	switch v := value.(type) {
+	case SequenceItemValue:
+		if v.DataSet != nil {
+			return v.DataSet.Elements, true
+		}
+	case *Element:
+		if v.Tag == dicomtag.Item {
+			var elems []*Element
+			for _, value := range v.Value {
+				if elem, ok := value.(*Element); ok {
+					elems = append(elems, elem)
+				}
+			}
+			return elems, true
+		}
+	}
+	return nil, false
+}
+
+// diffValue compares one value of an element with the given VR, and
+// describes the difference, or returns "" if there's none.
+func diffValue(vr string, a, b interface{}) string {
+	if fa, ok := numberValue(vr, a); ok {
+		if fb, ok := numberValue(vr, b); ok {
+			if fa == fb || (isFloatVR(vr) && floatEqual(fa, fb)) {
+				return ""
+			}
+			return fmt.Sprintf("%v vs %v", a, b)
+		}
+	}
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			if strings.TrimRight(a, " \x00") == strings.TrimRight(b, " \x00") {
+				return ""
+			}
+			return fmt.Sprintf("%q vs %q", a, b)
+		}
+	case []byte:
+		if b, ok := b.([]byte); ok {
+			return diffBytes(a, b)
+		}
+	case PixelDataInfo:
+		if b, ok := b.(PixelDataInfo); ok {
+			return diffPixelData(a, b)
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return ""
+	}
+	return fmt.Sprintf("%v vs %v", a, b)
+}
+
+// numberValue returns v as a float64 if it's a number, or a DS or IS string.
+func numberValue(vr string, v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		if vr == "DS" || vr == "IS" {
+			f, err := strconv.ParseFloat(strings.Trim(v, " \x00"), 64)
+			return f, err == nil
+		}
+	}
+	return 0, false
+}
+
+// isFloatVR reports whether values of vr are compared with floatTolerance.
+func isFloatVR(vr string) bool {
+	switch vr {
+	case "DS", "FL", "FD", "OF", "OD":
+		return true
+	}
+	return false
+}
+
+func floatEqual(a, b float64) bool {
+	if math.IsNaN(a) && math.IsNaN(b) {
+		return true
+	}
+	return math.Abs(a-b) <= floatTolerance*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// diffBytes compares two byte values, ignoring a trailing zero byte added to
+// make the length of one of them even.
+func diffBytes(a, b []byte) string {
+	trim := func(data []byte) []byte {
+		if len(data)%2 == 0 && len(data) > 0 && data[len(data)-1] == 0 {
+			return data[:len(data)-1]
+		}
+		return data
+	}
+	if bytes.Equal(a, b) || bytes.Equal(trim(a), b) || bytes.Equal(a, trim(b)) {
+		return ""
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return fmt.Sprintf("bytes differ at offset %d: %02x vs %02x", i, a[i], b[i])
+		}
+	}
+	return fmt.Sprintf("%d bytes vs %d", len(a), len(b))
+}
+
+func diffPixelData(a, b PixelDataInfo) string {
+	if a.IsEncapsulated != b.IsEncapsulated {
+		return fmt.Sprintf("encapsulated %v vs %v", a.IsEncapsulated, b.IsEncapsulated)
+	}
+	// Offsets left to the writer to compute aren't compared.
+	if len(a.Offsets) > 0 && len(b.Offsets) > 0 && !reflect.DeepEqual(a.Offsets, b.Offsets) {
+		return fmt.Sprintf("offsets %v vs %v", a.Offsets, b.Offsets)
+	}
+	if len(a.Frames) != len(b.Frames) {
+		return fmt.Sprintf("%d frames vs %d", len(a.Frames), len(b.Frames))
+	}
+	for i := range a.Frames {
+		if msg := diffFrame(a.Frames[i], b.Frames[i]); msg != "" {
+			return fmt.Sprintf("frame %d: %s", i, msg)
+		}
+	}
+	return ""
+}
+
+func diffFrame(a, b frame.Frame) string {
+	if a.Encapsulated != b.Encapsulated {
+		return fmt.Sprintf("encapsulated %v vs %v", a.Encapsulated, b.Encapsulated)
+	}
+	if a.Encapsulated {
+		return diffBytes(a.EncapsulatedData.Data, b.EncapsulatedData.Data)
+	}
+	na, nb := a.NativeData, b.NativeData
+	if na.Rows != nb.Rows || na.Cols != nb.Cols || na.BitsPerSample != nb.BitsPerSample {
+		return fmt.Sprintf("%dx%d %d-bit vs %dx%d %d-bit", na.Rows, na.Cols, na.BitsPerSample, nb.Rows, nb.Cols, nb.BitsPerSample)
+	}
+	if len(na.Data) != len(nb.Data) {
+		return fmt.Sprintf("%d pixels vs %d", len(na.Data), len(nb.Data))
+	}
+	for i := range na.Data {
+		if !reflect.DeepEqual(na.Data[i], nb.Data[i]) {
+			return fmt.Sprintf("pixel %d: %v vs %v", i, na.Data[i], nb.Data[i])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package element_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/element"
+)
+
+// newItem returns an Item element holding elems.
+func newItem(undefinedLength bool, elems ...*element.Element) *element.Element {
+	item := &element.Element{Tag: dicomtag.Item, VR: "NA", UndefinedLength: undefinedLength}
+	for _, elem := range elems {
+		item.Value = append(item.Value, elem)
+	}
+	return item
+}
+
+func TestDataSetDiff(t *testing.T) {
+	newDataSet := func(imageType, uid string, spacing float64, rows uint16, data []byte) *element.DataSet {
+		return &element.DataSet{Elements: []*element.Element{
+			element.MustNewElement(dicomtag.ImageType, "ORIGINAL", imageType),
+			{Tag: dicomtag.PixelSpacing, VR: "DS", Value: []interface{}{spacing, 0.5}},
+			element.MustNewElement(dicomtag.Rows, rows),
+			element.MustNewElement(dicomtag.ReferencedImageSequence,
+				newItem(true, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, uid))),
+			{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1010}, VR: "OB", Value: []interface{}{data}},
+		}}
+	}
+	ds := newDataSet("PRIMARY", "1.2.3", 1.0/3, 512, []byte{1, 2, 3})
+	// The dataset as read back: padding, DS formatting, sequence lengths and
+	// the order of elements don't matter.
+	readBack := &element.DataSet{Elements: []*element.Element{
+		{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1010}, VR: "OB", Value: []interface{}{[]byte{1, 2, 3, 0}}},
+		element.MustNewElement(dicomtag.ReferencedImageSequence,
+			newItem(false, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3\x00"))),
+		element.MustNewElement(dicomtag.Rows, uint16(512)),
+		{Tag: dicomtag.PixelSpacing, VR: "DS", Value: []interface{}{"0.333333333333", "0.5"}},
+		element.MustNewElement(dicomtag.ImageType, "ORIGINAL", "PRIMARY "),
+	}}
+	assert.Empty(t, ds.Diff(readBack))
+	for _, elem := range ds.Elements {
+		elem2, err := readBack.FindElementByTag(elem.Tag)
+		if assert.NoError(t, err) {
+			assert.True(t, elem.Equal(elem2), dicomtag.DebugString(elem.Tag))
+		}
+	}
+
+	other := newDataSet("SECONDARY", "1.2.4", 0.3333, 256, []byte{1, 2, 4})
+	other.Elements = append(other.Elements, element.MustNewElement(dicomtag.Columns, uint16(512)))
+	assert.Equal(t, []string{
+		`(0008,0008)[ImageType]: value 1: "PRIMARY" vs "SECONDARY"`,
+		`(0008,1140)[ReferencedImageSequence] item 0: (0008,1155)[ReferencedSOPInstanceUID]: "1.2.3" vs "1.2.4"`,
+		`(0009,1010)[private]: bytes differ at offset 2: 03 vs 04`,
+		`(0028,0010)[Rows]: 512 vs 256`,
+		`(0028,0011)[Columns]: only in the second dataset`,
+		`(0028,0030)[PixelSpacing]: value 0: 0.3333333333333333 vs 0.3333`,
+	}, ds.Diff(other))
+}
@@ -4,6 +4,9 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/suyashkumar/dicom/dicomtag"
@@ -26,7 +29,8 @@ type Element struct {
 	// List of values in the element. Their types depends on value
 	// representation (VR) of the Tag; Cf. tag.go.
 	//
-	// If Tag==TagPixelData, len(Value)==1, and Value[0] is PixelDataInfo.
+	// If Tag==TagPixelData, len(Value)==1, and Value[0] is PixelDataInfo
+	// or PixelDataStream.
 	// Else if Tag==TagItem, each Value[i] is a *Element.
 	//    a value's Tag can be any (including TagItem, which represents a nested Item)
 	// Else if VR=="SQ", Value[i] is a *Element, with Tag=TagItem.
@@ -34,11 +38,11 @@ type Element struct {
 	// Else if VR=="LT", or "UT", then len(Value)==1, and Value[0] is string
 	// Else if VR=="DA", then len(Value)==1, and Value[0] is string. Use ParseDate() to parse the date string.
 	// Else if VR=="US", Value[] is a list of uint16s
-	// Else if VR=="UL", Value[] is a list of uint32s
+	// Else if VR=="UL" or "OL", Value[] is a list of uint32s
 	// Else if VR=="SS", Value[] is a list of int16s
 	// Else if VR=="SL", Value[] is a list of int32s
-	// Else if VR=="FL", Value[] is a list of float32s
-	// Else if VR=="FD", Value[] is a list of float64s
+	// Else if VR=="FL" or "OF", Value[] is a list of float32s
+	// Else if VR=="FD" or "OD", Value[] is a list of float64s
 	// Else if VR=="AT", Value[] is a list of Tag's.
 	// Else, Value[] is a list of strings.
 	//
@@ -72,16 +76,32 @@ type Element struct {
 	// this means.  It's one of the pointless complexities in the DICOM
 	// standard.
 	UndefinedLength bool
+
+	// RawBytes, if not nil, holds the bytes the element was read from, header
+	// included, as kept by the parser with ParseOptions.KeepRawBytes. They
+	// are written back as they are with write.WithFaithfulCopy, as long as
+	// the element still matches RawDigest; DataSet.Clone leaves them out.
+	RawBytes []byte
+
+	// RawDigest is the digest of the element as it was read, set along with
+	// RawBytes (see write.ElementDigest).
+	RawDigest []byte
 }
 
 // NewElement creates a new Element with the given tag and values. The type of
 // each each value must match the VR (value representation) of the tag (see
-// tag_definition.go).
+// tag_definition.go). For convenience, a []string, []int, []uint32, []float32
+// or []float64 value is expanded into its elements, and an int is converted to
+// the integer or float type of the VR, or to a decimal string for VR "IS".
+//
+//  elem, err := NewElement(dicomtag.Rows, 512)                  // uint16(512)
+//  elem, err := NewElement(dicomtag.ImageType, []string{"ORIGINAL", "PRIMARY"})
 func NewElement(tag dicomtag.Tag, values ...interface{}) (*Element, error) {
 	ti, err := dicomtag.Find(tag)
 	if err != nil {
 		return nil, err
 	}
+	values = expandValues(values)
 	e := Element{
 		Tag:   tag,
 		VR:    ti.VR,
@@ -89,12 +109,25 @@ func NewElement(tag dicomtag.Tag, values ...interface{}) (*Element, error) {
 	}
 	vrKind := dicomtag.GetVRKind(tag, ti.VR)
 	for i, v := range values {
+		if n, isInt := v.(int); isInt {
+			if v, err = convertInt(n, ti.VR, vrKind); err != nil {
+				return nil, fmt.Errorf("%v: %v", dicomtag.DebugString(tag), err)
+			}
+		}
 		var ok bool
 		switch vrKind {
 		case dicomtag.VRStringList, dicomtag.VRDate:
-			_, ok = v.(string)
+			switch v.(type) {
+			case string:
+				ok = true
+			case PersonName:
+				ok = ti.VR == "PN"
+			}
 		case dicomtag.VRBytes:
-			_, ok = v.([]byte)
+			switch v.(type) {
+			case []byte, LazyValue:
+				ok = true
+			}
 		case dicomtag.VRUInt16List:
 			_, ok = v.(uint16)
 		case dicomtag.VRUInt32List:
@@ -108,14 +141,18 @@ func NewElement(tag dicomtag.Tag, values ...interface{}) (*Element, error) {
 		case dicomtag.VRFloat64List:
 			_, ok = v.(float64)
 		case dicomtag.VRPixelData:
-			_, ok = v.(PixelDataInfo)
+			switch v.(type) {
+			case PixelDataInfo, PixelDataStream, LazyValue:
+				ok = true
+			}
 		case dicomtag.VRTagList:
 			_, ok = v.(dicomtag.Tag)
 		case dicomtag.VRSequence:
-			var subelem *Element
-			subelem, ok = v.(*Element)
-			if ok {
-				ok = (subelem.Tag == dicomtag.Item)
+			switch v := v.(type) {
+			case *Element:
+				ok = (v.Tag == dicomtag.Item)
+			case SequenceItemValue:
+				ok = v.DataSet != nil
 			}
 		case dicomtag.VRItem:
 			_, ok = v.(*Element)
@@ -128,6 +165,69 @@ func NewElement(tag dicomtag.Tag, values ...interface{}) (*Element, error) {
 	return &e, nil
 }
 
+// expandValues replaces []string, []int, []uint32, []float32 and []float64
+// values by their elements.
+func expandValues(values []interface{}) []interface{} {
+	var expanded []interface{}
+	for _, v := range values {
+		switch list := v.(type) {
+		case []string:
+			for _, s := range list {
+				expanded = append(expanded, s)
+			}
+		case []int:
+			for _, n := range list {
+				expanded = append(expanded, n)
+			}
+		case []uint32:
+			for _, n := range list {
+				expanded = append(expanded, n)
+			}
+		case []float32:
+			for _, f := range list {
+				expanded = append(expanded, f)
+			}
+		case []float64:
+			for _, f := range list {
+				expanded = append(expanded, f)
+			}
+		default:
+			expanded = append(expanded, v)
+		}
+	}
+	return expanded
+}
+
+// convertInt converts n to the Go type of the given VR. It returns n as is if
+// the VR isn't numeric, so that NewElement reports the type mismatch.
+func convertInt(n int, vr string, vrKind dicomtag.VRKind) (interface{}, error) {
+	inRange := func(min, max int64) error {
+		if int64(n) < min || int64(n) > max {
+			return fmt.Errorf("value %d out of range for VR %v", n, vr)
+		}
+		return nil
+	}
+	switch vrKind {
+	case dicomtag.VRUInt16List:
+		return uint16(n), inRange(0, math.MaxUint16)
+	case dicomtag.VRUInt32List:
+		return uint32(n), inRange(0, math.MaxUint32)
+	case dicomtag.VRInt16List:
+		return int16(n), inRange(math.MinInt16, math.MaxInt16)
+	case dicomtag.VRInt32List:
+		return int32(n), inRange(math.MinInt32, math.MaxInt32)
+	case dicomtag.VRFloat32List:
+		return float32(n), nil
+	case dicomtag.VRFloat64List:
+		return float64(n), nil
+	case dicomtag.VRStringList:
+		if vr == "IS" {
+			return strconv.Itoa(n), nil
+		}
+	}
+	return n, nil
+}
+
 // MustNewElement is similar to NewElement, but it crashes the process on any
 // error.
 func MustNewElement(tag dicomtag.Tag, values ...interface{}) *Element {
@@ -247,34 +347,89 @@ func (e *Element) MustGetStrings() []string {
 	return values
 }
 
+// maxValueStringLength is the length beyond which String() truncates the
+// values of an element.
+const maxValueStringLength = 1024
+
 func elementString(e *Element, nestLevel int) string {
-	// doassert(nestLevel < 10)
-	indent := strings.Repeat(" ", nestLevel)
-	s := indent
-	sVl := ""
+	indent := strings.Repeat("  ", nestLevel)
+	s := fmt.Sprintf("%s%s %s", indent, dicomtag.DebugString(e.Tag), e.VR)
 	if e.UndefinedLength {
-		sVl = "u"
+		s += " VL=u"
+	} else if vl, ok := valueLength(e); ok {
+		s += fmt.Sprintf(" VL=%d", vl)
 	}
-	s = fmt.Sprintf("%s %s %s %s ", s, dicomtag.DebugString(e.Tag), e.VR, sVl)
 	if e.VR == "SQ" || e.Tag == dicomtag.Item {
-		s += fmt.Sprintf(" (#%d)[\n", len(e.Value))
+		s += fmt.Sprintf(" (#%d)", len(e.Value))
 		for _, v := range e.Value {
-			s += elementString(v.(*Element), nestLevel+1) + "\n"
+			if subelem, ok := v.(*Element); ok {
+				s += "\n" + elementString(subelem, nestLevel+1)
+			} else {
+				s += fmt.Sprintf("\n%s  %v", indent, v)
+			}
 		}
-		s += indent + " ]"
-	} else {
-		var sv string
-		if len(e.Value) == 1 {
-			sv = fmt.Sprintf("%v", e.Value)
-		} else {
-			sv = fmt.Sprintf("(%d)%v", len(e.Value), e.Value)
+		return s
+	}
+	sv := valuesString(e)
+	if len(sv) > maxValueStringLength {
+		sv = sv[:maxValueStringLength] + "(...)"
+	}
+	if len(e.Value) != 1 {
+		sv = fmt.Sprintf("(%d)%s", len(e.Value), sv)
+	}
+	return s + " " + sv
+}
+
+// valuesString formats the values of e the way they are written: strings
+// separated by backslashes, numbers by spaces, and bytes in hex.
+func valuesString(e *Element) string {
+	var parts []string
+	sep := " "
+	for _, v := range e.Value {
+		switch v := v.(type) {
+		case string:
+			parts = append(parts, v)
+			sep = "\\"
+		case []byte:
+			if len(v) > maxValueStringLength/2 {
+				parts = append(parts, fmt.Sprintf("%x(...)", v[:maxValueStringLength/2]))
+			} else {
+				parts = append(parts, fmt.Sprintf("%x", v))
+			}
+		case dicomtag.Tag:
+			parts = append(parts, v.String())
+		default:
+			parts = append(parts, fmt.Sprint(v))
 		}
-		if len(sv) > 1024 {
-			sv = sv[1:1024] + "(...)"
+	}
+	return "[" + strings.Join(parts, sep) + "]"
+}
+
+// valueLength returns the length of the encoded values of e, if it can be
+// known without the transfer syntax, i.e., unless e is a sequence, an item,
+// or PixelData.
+func valueLength(e *Element) (int, bool) {
+	n := 0
+	for i, v := range e.Value {
+		switch v := v.(type) {
+		case string:
+			if i > 0 {
+				n++ // The backslash.
+			}
+			n += len(v)
+		case []byte:
+			n += len(v)
+		case uint16, int16:
+			n += 2
+		case uint32, int32, float32, dicomtag.Tag:
+			n += 4
+		case float64:
+			n += 8
+		default:
+			return 0, false
 		}
-		s += sv
 	}
-	return s
+	return n + n%2, true
 }
 
 // Stringer
@@ -306,6 +461,68 @@ func (data PixelDataInfo) String() string {
 	return s + "]}"
 }
 
+// PixelDataStream is an alternative Element.Value payload for a native
+// PixelData element whose frames are read from io.Readers while writing,
+// instead of being held in memory. Each reader must yield exactly
+// FrameLength bytes: the frame's samples, already encoded in the byte order
+// of the transfer syntax. The parser never produces PixelDataStream.
+type PixelDataStream struct {
+	Frames      []io.Reader
+	FrameLength int // in bytes
+}
+
+func (data PixelDataStream) String() string {
+	return fmt.Sprintf("image{stream: %d frames of %d bytes}", len(data.Frames), data.FrameLength)
+}
+
+// LazyValue is an alternative Element.Value payload for an OB, OW or UN
+// element, including native PixelData, whose bytes are loaded only while
+// writing, e.g., straight from the file being copied, instead of being held in
+// memory. The bytes are written as they are, so OW values must already be in
+// the byte order of the transfer syntax. The parser never produces LazyValue.
+type LazyValue interface {
+	// Len returns the number of bytes of the value.
+	Len() int64
+	// Open returns a reader of the bytes of the value. It may be called more
+	// than once.
+	Open() (io.Reader, error)
+}
+
+// NewSectionValue returns a LazyValue of the n bytes of r starting at offset
+// off.
+//
+//  f, err := os.Open("in.dcm")
+//  elem := &Element{Tag: dicomtag.PixelData, VR: "OW", Value: []interface{}{NewSectionValue(f, off, n)}}
+func NewSectionValue(r io.ReaderAt, off, n int64) LazyValue {
+	return sectionValue{r, off, n}
+}
+
+type sectionValue struct {
+	r      io.ReaderAt
+	off, n int64
+}
+
+func (v sectionValue) Len() int64 { return v.n }
+
+func (v sectionValue) Open() (io.Reader, error) {
+	return io.NewSectionReader(v.r, v.off, v.n), nil
+}
+
+func (v sectionValue) String() string {
+	return fmt.Sprintf("lazy{offset: %d, size: %d}", v.off, v.n)
+}
+
+// SequenceItemValue is an alternative Element.Value payload for a SQ element:
+// one item of the sequence, given as the DataSet of the elements it holds,
+// instead of an Item element. It is written like an Item of the same length
+// encoding as the sequence. The parser never produces SequenceItemValue.
+//
+//  seq := MustNewElement(dicomtag.ReferencedSeriesSequence,
+//    SequenceItemValue{DataSet: &DataSet{Elements: []*Element{...}}})
+type SequenceItemValue struct {
+	DataSet *DataSet
+}
+
 // EndOfData is an pseudoelement to cause the caller to stop reading the input.
 var EndOfData = &Element{Tag: dicomtag.Tag{Group: 0x7fff, Element: 0x7fff}}
 
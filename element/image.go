@@ -0,0 +1,182 @@
+package element
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/suyashkumar/dicom/dicomio"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/dicomuid"
+)
+
+// ToImage decodes the given frame of the native PixelData of ds into an
+// image, as described by the Image Pixel elements (P3.3 C.7.6.3):
+// MONOCHROME1 and MONOCHROME2 become an image.Gray, or an image.Gray16 if
+// BitsAllocated is 16, with MONOCHROME1 inverted so that white is the
+// maximum; RGB becomes an image.RGBA or image.RGBA64. Samples are scaled from
+// BitsStored to the bits of the image, and signed ones are offset so that the
+// most negative value is black. No window is applied. It returns an error for
+// other photometric interpretations and for encapsulated (compressed) pixel
+// data.
+//
+//  img, err := ds.ToImage(0)
+//  err = png.Encode(out, img)
+func (ds *DataSet) ToImage(frameIndex int) (image.Image, error) {
+	if elem, err := ds.FindElementByTag(dicomtag.TransferSyntaxUID); err == nil {
+		uid, err := elem.GetString()
+		if err != nil {
+			return nil, err
+		}
+		if canonical, err := dicomio.CanonicalTransferSyntaxUID(uid); err != nil {
+			return nil, err
+		} else if canonical == dicomuid.ExplicitVRLittleEndian && uid != dicomuid.ExplicitVRLittleEndian {
+			return nil, fmt.Errorf("ToImage: transfer syntax %v is compressed", dicomuid.UIDString(uid))
+		}
+	}
+	pixelData, err := ds.FindElementByTag(dicomtag.PixelData)
+	if err != nil {
+		return nil, err
+	}
+	info, ok := singlePixelDataInfo(pixelData)
+	if !ok {
+		return nil, fmt.Errorf("ToImage: PixelData holds no PixelDataInfo")
+	}
+	if frameIndex < 0 || frameIndex >= len(info.Frames) {
+		return nil, fmt.Errorf("ToImage: frame %d out of %d", frameIndex, len(info.Frames))
+	}
+	if info.IsEncapsulated || info.Frames[frameIndex].Encapsulated {
+		return nil, fmt.Errorf("ToImage: pixel data is encapsulated")
+	}
+	native := info.Frames[frameIndex].NativeData
+
+	getInt := func(tag dicomtag.Tag, defaultValue int) (int, error) {
+		elem, err := ds.FindElementByTag(tag)
+		if err != nil {
+			if defaultValue < 0 {
+				return 0, err
+			}
+			return defaultValue, nil
+		}
+		n, err := elem.GetInt()
+		return int(n), err
+	}
+	rows, err := getInt(dicomtag.Rows, -1)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := getInt(dicomtag.Columns, -1)
+	if err != nil {
+		return nil, err
+	}
+	bitsAllocated, err := getInt(dicomtag.BitsAllocated, -1)
+	if err != nil {
+		return nil, err
+	}
+	samplesPerPixel, err := getInt(dicomtag.SamplesPerPixel, 1)
+	if err != nil {
+		return nil, err
+	}
+	bitsStored, err := getInt(dicomtag.BitsStored, bitsAllocated)
+	if err != nil {
+		return nil, err
+	}
+	pixelRepresentation, err := getInt(dicomtag.PixelRepresentation, 0)
+	if err != nil {
+		return nil, err
+	}
+	planarConfiguration, err := getInt(dicomtag.PlanarConfiguration, 0)
+	if err != nil {
+		return nil, err
+	}
+	photometric := "MONOCHROME2"
+	if elem, err := ds.FindElementByTag(dicomtag.PhotometricInterpretation); err == nil {
+		if photometric, err = elem.GetString(); err != nil {
+			return nil, err
+		}
+		photometric = strings.TrimRight(photometric, " ")
+	}
+
+	if bitsAllocated != 8 && bitsAllocated != 16 {
+		return nil, fmt.Errorf("ToImage: unsupported BitsAllocated %d", bitsAllocated)
+	}
+	if bitsStored < 1 || bitsStored > bitsAllocated {
+		return nil, fmt.Errorf("ToImage: BitsStored %d out of range for BitsAllocated %d", bitsStored, bitsAllocated)
+	}
+	switch {
+	case (photometric == "MONOCHROME1" || photometric == "MONOCHROME2") && samplesPerPixel == 1:
+	case photometric == "RGB" && samplesPerPixel == 3:
+	default:
+		return nil, fmt.Errorf("ToImage: unsupported PhotometricInterpretation %s with %d samples per pixel", photometric, samplesPerPixel)
+	}
+	if rows != native.Rows || cols != native.Cols || len(native.Data) != rows*cols {
+		return nil, fmt.Errorf("ToImage: frame %d has %d pixels, but the image is %dx%d", frameIndex, len(native.Data), cols, rows)
+	}
+
+	// The parser reads samples pixel by pixel; with PlanarConfiguration 1,
+	// they are actually stored plane by plane.
+	n := rows * cols
+	samples := make([]int, 0, n*samplesPerPixel)
+	for i, pixel := range native.Data {
+		if len(pixel) != samplesPerPixel {
+			return nil, fmt.Errorf("ToImage: pixel %d has %d samples, expected %d", i, len(pixel), samplesPerPixel)
+		}
+		samples = append(samples, pixel...)
+	}
+	sample := func(i, s int) uint32 {
+		var v int
+		if planarConfiguration == 1 {
+			v = samples[s*n+i]
+		} else {
+			v = samples[i*samplesPerPixel+s]
+		}
+		v &= 1<<uint(bitsStored) - 1
+		if pixelRepresentation == 1 {
+			// Two's complement, offset to make the most negative value 0.
+			v ^= 1 << uint(bitsStored-1)
+		}
+		if photometric == "MONOCHROME1" {
+			v = 1<<uint(bitsStored) - 1 - v
+		}
+		return uint32(v) << uint(bitsAllocated-bitsStored)
+	}
+
+	rect := image.Rect(0, 0, cols, rows)
+	switch {
+	case samplesPerPixel == 1 && bitsAllocated == 8:
+		img := image.NewGray(rect)
+		for i := 0; i < n; i++ {
+			img.Pix[i] = uint8(sample(i, 0))
+		}
+		return img, nil
+	case samplesPerPixel == 1:
+		img := image.NewGray16(rect)
+		for i := 0; i < n; i++ {
+			img.SetGray16(i%cols, i/cols, color.Gray16{Y: uint16(sample(i, 0))})
+		}
+		return img, nil
+	case bitsAllocated == 8:
+		img := image.NewRGBA(rect)
+		for i := 0; i < n; i++ {
+			img.SetRGBA(i%cols, i/cols, color.RGBA{R: uint8(sample(i, 0)), G: uint8(sample(i, 1)), B: uint8(sample(i, 2)), A: 0xff})
+		}
+		return img, nil
+	default:
+		img := image.NewRGBA64(rect)
+		for i := 0; i < n; i++ {
+			img.SetRGBA64(i%cols, i/cols, color.RGBA64{R: uint16(sample(i, 0)), G: uint16(sample(i, 1)), B: uint16(sample(i, 2)), A: 0xffff})
+		}
+		return img, nil
+	}
+}
+
+// singlePixelDataInfo returns the value of a PixelData element, if it's a
+// PixelDataInfo.
+func singlePixelDataInfo(elem *Element) (PixelDataInfo, bool) {
+	if len(elem.Value) != 1 {
+		return PixelDataInfo{}, false
+	}
+	info, ok := elem.Value[0].(PixelDataInfo)
+	return info, ok
+}
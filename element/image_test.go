@@ -0,0 +1,70 @@
+package element_test
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/dicomuid"
+	"github.com/suyashkumar/dicom/element"
+	"github.com/suyashkumar/dicom/frame"
+)
+
+// newImageDataSet returns a dataset holding one frame of native pixel data,
+// with the given photometric interpretation, bits and pixel representation.
+func newImageDataSet(rows, cols int, photometric string, bitsAllocated, bitsStored, signed int, data [][]int, elems ...*element.Element) *element.DataSet {
+	samples := len(data[0])
+	pixelData := element.PixelDataInfo{Frames: []frame.Frame{{
+		NativeData: frame.NativeFrame{Data: data, Rows: rows, Cols: cols, BitsPerSample: bitsAllocated},
+	}}}
+	return newTestDataSet(dicomuid.ExplicitVRLittleEndian, append([]*element.Element{
+		element.MustNewElement(dicomtag.SamplesPerPixel, uint16(samples)),
+		element.MustNewElement(dicomtag.PhotometricInterpretation, photometric),
+		element.MustNewElement(dicomtag.Rows, uint16(rows)),
+		element.MustNewElement(dicomtag.Columns, uint16(cols)),
+		element.MustNewElement(dicomtag.BitsAllocated, uint16(bitsAllocated)),
+		element.MustNewElement(dicomtag.BitsStored, uint16(bitsStored)),
+		element.MustNewElement(dicomtag.PixelRepresentation, uint16(signed)),
+		element.MustNewElement(dicomtag.PixelData, pixelData),
+	}, elems...)...)
+}
+
+func TestToImage(t *testing.T) {
+	// MONOCHROME1 is inverted.
+	ds := newImageDataSet(1, 2, "MONOCHROME1", 8, 8, 0, [][]int{{0}, {200}})
+	img, err := ds.ToImage(0)
+	require.NoError(t, err)
+	assert.Equal(t, []uint8{255, 55}, img.(*image.Gray).Pix)
+	_, err = ds.ToImage(1)
+	assert.Error(t, err)
+
+	// 16-bit samples are scaled from BitsStored, and signed ones offset.
+	ds = newImageDataSet(1, 3, "MONOCHROME2", 16, 12, 1, [][]int{{-2048}, {0}, {2047}})
+	img, err = ds.ToImage(0)
+	require.NoError(t, err)
+	gray := img.(*image.Gray16)
+	assert.Equal(t, image.Rect(0, 0, 3, 1), gray.Bounds())
+	for x, want := range []uint16{0, 0x8000, 0xfff0} {
+		assert.Equal(t, want, gray.Gray16At(x, 0).Y, "%d", x)
+	}
+
+	// With PlanarConfiguration 1, the samples are stored plane by plane.
+	ds = newImageDataSet(1, 2, "RGB", 8, 8, 0, [][]int{{1, 2, 3}, {4, 5, 6}},
+		element.MustNewElement(dicomtag.PlanarConfiguration, uint16(1)))
+	img, err = ds.ToImage(0)
+	require.NoError(t, err)
+	assert.Equal(t, []uint8{1, 3, 5, 255, 2, 4, 6, 255}, img.(*image.RGBA).Pix)
+
+	// Compressed pixel data can't be decoded.
+	ds = newImageDataSet(1, 2, "MONOCHROME2", 8, 8, 0, [][]int{{0}, {200}})
+	ds.Elements[0] = element.MustNewElement(dicomtag.TransferSyntaxUID, "1.2.840.10008.1.2.4.50")
+	_, err = ds.ToImage(0)
+	assert.Error(t, err)
+
+	// Unsupported photometric interpretations are errors.
+	ds = newImageDataSet(1, 2, "YBR_FULL", 8, 8, 0, [][]int{{1, 2, 3}, {4, 5, 6}})
+	_, err = ds.ToImage(0)
+	assert.Error(t, err)
+}
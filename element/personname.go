@@ -0,0 +1,57 @@
+package element
+
+import "strings"
+
+// PersonName is a structured value of a PN element: up to three component
+// groups, for the name written in alphabetic characters, in ideographic
+// characters (e.g., kanji), and phonetically (e.g., hiragana) (P3.5 6.2.1).
+// It can be used instead of a string value in NewElement and when writing.
+//
+//  elem, err := NewElement(dicomtag.PatientName, PersonName{
+//    Alphabetic:  PersonNameGroup{FamilyName: "Yamada", GivenName: "Tarou"},
+//    Ideographic: PersonNameGroup{FamilyName: "山田", GivenName: "太郎"},
+//  })
+type PersonName struct {
+	Alphabetic  PersonNameGroup
+	Ideographic PersonNameGroup
+	Phonetic    PersonNameGroup
+}
+
+// PersonNameGroup is one component group of a PersonName.
+type PersonNameGroup struct {
+	FamilyName string
+	GivenName  string
+	MiddleName string
+	NamePrefix string
+	NameSuffix string
+}
+
+// ParsePersonName splits a PN value into its component groups, separated by
+// "=", and their components, separated by "^". Missing groups and components
+// are empty.
+func ParsePersonName(s string) PersonName {
+	var groups [3]PersonNameGroup
+	for i, group := range strings.SplitN(strings.TrimRight(s, " "), "=", 3) {
+		var c [5]string
+		copy(c[:], strings.SplitN(group, "^", 5))
+		groups[i] = PersonNameGroup{c[0], c[1], c[2], c[3], c[4]}
+	}
+	return PersonName{groups[0], groups[1], groups[2]}
+}
+
+// String returns the PN value of n, in the form
+// "Alphabetic=Ideographic=Phonetic", leaving out trailing empty components
+// and groups, e.g., "Yamada^Tarou=山田^太郎".
+func (n PersonName) String() string {
+	return strings.TrimRight(strings.Join([]string{
+		n.Alphabetic.String(), n.Ideographic.String(), n.Phonetic.String(),
+	}, "="), "=")
+}
+
+// String returns the components of g separated by "^", leaving out trailing
+// empty ones, e.g., "Doe^John".
+func (g PersonNameGroup) String() string {
+	return strings.TrimRight(strings.Join([]string{
+		g.FamilyName, g.GivenName, g.MiddleName, g.NamePrefix, g.NameSuffix,
+	}, "^"), "^")
+}
@@ -0,0 +1,29 @@
+package element_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/element"
+)
+
+func TestPersonName(t *testing.T) {
+	name := element.PersonName{
+		Alphabetic:  element.PersonNameGroup{FamilyName: "Yamada", GivenName: "Tarou"},
+		Ideographic: element.PersonNameGroup{FamilyName: "山田", GivenName: "太郎"},
+		Phonetic:    element.PersonNameGroup{FamilyName: "やまだ", GivenName: "たろう"},
+	}
+	assert.Equal(t, "Yamada^Tarou=山田^太郎=やまだ^たろう", name.String())
+	assert.Equal(t, name, element.ParsePersonName(name.String()))
+	// Trailing empty components and groups are left out.
+	assert.Equal(t, "Doe^John", element.PersonName{Alphabetic: element.PersonNameGroup{FamilyName: "Doe", GivenName: "John"}}.String())
+	assert.Equal(t, "=山田", element.PersonName{Ideographic: element.PersonNameGroup{FamilyName: "山田"}}.String())
+	// Padding is ignored.
+	assert.Equal(t, element.PersonName{Alphabetic: element.PersonNameGroup{FamilyName: "Doe"}}, element.ParsePersonName("Doe "))
+
+	_, err := element.NewElement(dicomtag.PatientName, name)
+	assert.NoError(t, err)
+	_, err = element.NewElement(dicomtag.PatientID, name)
+	assert.Error(t, err)
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -16,6 +17,8 @@ import (
 	"github.com/suyashkumar/dicom/dicomtag"
 	"github.com/suyashkumar/dicom/element"
 	"github.com/suyashkumar/dicom/frame"
+	"github.com/suyashkumar/dicom/write"
+	"golang.org/x/text/encoding"
 )
 
 // Parser represents an entity that can read and parse DICOMs
@@ -41,6 +44,12 @@ type parser struct {
 	// reading a sequence).
 	currentSequenceDataset *element.DataSet
 	force		bool
+	// metaRawBytes holds the bytes and digest of each meta element, set as
+	// their RawBytes and RawDigest by Parse with KeepRawBytes.
+	metaRawBytes map[*element.Element]element.Element
+	// charset encodes strings in the character set they are decoded from, to
+	// compute the RawDigest of elements.
+	charset *encoding.Encoder
 }
 
 func newParserInternal(in io.Reader, bytesToRead int64, frameChannel chan *frame.Frame, force bool) parser {
@@ -97,6 +106,16 @@ func NewParserFromFile(path string, frameChannel chan *frame.Frame) (Parser, err
 	return p, err
 }
 
+// ReadDataSetFromFile parses the DICOM file at path and returns its dataset. It
+// is a shorthand for NewParserFromFile followed by Parse.
+func ReadDataSetFromFile(path string, options ParseOptions) (*element.DataSet, error) {
+	p, err := NewParserFromFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return p.Parse(options)
+}
+
 // NewParserFromDecoder returns parser from a decoder
 // TODO: remove or cleanup, currently needed for testing
 func NewParserFromDecoder(decoder *dicomio.Decoder, frameChannel chan *frame.Frame) (Parser, error) {
@@ -144,6 +163,14 @@ func (p *parser) Parse(options ParseOptions) (*element.DataSet, error) {
 		defer p.file.Close()
 	}
 
+	if options.KeepRawBytes {
+		for _, elem := range p.parsedElements.Elements {
+			if raw, ok := p.metaRawBytes[elem]; ok {
+				elem.RawBytes, elem.RawDigest = raw.RawBytes, raw.RawDigest
+			}
+		}
+	}
+
 	// Read the list of elements.
 	for p.decoder.Len() > 0 {
 		startLen := p.decoder.Len()
@@ -159,28 +186,7 @@ func (p *parser) Parse(options ParseOptions) (*element.DataSet, error) {
 			// Parse error.
 			continue
 		}
-		if elem.Tag == dicomtag.SpecificCharacterSet {
-			// Set the []byte -> string decoder for the rest of the
-			// file.  It's sad that SpecificCharacterSet isn't part
-			// of metadata, but is part of regular attrs, so we need
-			// to watch out for multiple occurrences of this type of
-			// elements.
-			encodingNames, err := elem.GetStrings()
-			if err != nil {
-				p.decoder.SetError(err)
-			} else {
-				// TODO(saito) SpecificCharacterSet may appear in a
-				// middle of a SQ or NA.  In such case, the charset seem
-				// to be scoped inside the SQ or NA. So we need to make
-				// the charset a stack.
-				cs, err := dicomio.ParseSpecificCharacterSet(encodingNames)
-				if err != nil {
-					p.decoder.SetError(err)
-				} else {
-					p.decoder.SetCodingSystem(cs)
-				}
-			}
-		}
+		p.updateCodingSystem(elem)
 		if options.ReturnTags == nil || (options.ReturnTags != nil && tagInList(elem.Tag, options.ReturnTags)) {
 			p.parsedElements.Elements = append(p.parsedElements.Elements, elem)
 		}
@@ -192,7 +198,50 @@ func (p *parser) Parse(options ParseOptions) (*element.DataSet, error) {
 	return p.parsedElements, p.decoder.Error()
 }
 
+// updateCodingSystem sets the []byte -> string decoder for the rest of the
+// file if elem is SpecificCharacterSet. Errors are reported through
+// p.decoder.Error().
+func (p *parser) updateCodingSystem(elem *element.Element) {
+	if elem.Tag != dicomtag.SpecificCharacterSet {
+		return
+	}
+	// It's sad that SpecificCharacterSet isn't part of metadata, but is
+	// part of regular attrs, so we need to watch out for multiple
+	// occurrences of this type of elements.
+	encodingNames, err := elem.GetStrings()
+	if err != nil {
+		p.decoder.SetError(err)
+		return
+	}
+	// TODO(saito) SpecificCharacterSet may appear in a middle of a SQ or
+	// NA.  In such case, the charset seem to be scoped inside the SQ or NA.
+	// So we need to make the charset a stack.
+	cs, err := dicomio.ParseSpecificCharacterSet(encodingNames)
+	if err != nil {
+		p.decoder.SetError(err)
+	} else {
+		p.decoder.SetCodingSystem(cs)
+	}
+	if cs, err := dicomio.ParseSpecificCharacterSetEncoder(encodingNames); err == nil {
+		p.charset = cs
+	}
+}
+
 func (p *parser) ParseNext(options ParseOptions) *element.Element {
+	if options.KeepRawBytes {
+		p.decoder.StartRecording()
+		options.KeepRawBytes = false
+		elem := p.ParseNext(options)
+		raw := p.decoder.StopRecording()
+		if elem != nil && elem != element.EndOfData {
+			elem.RawBytes = raw
+			bo, implicit := p.decoder.TransferSyntax()
+			e := dicomio.NewEncoder(ioutil.Discard, bo, implicit)
+			e.SetCharset(p.charset)
+			elem.RawDigest = write.ElementDigest(e, elem)
+		}
+		return elem
+	}
 	tag := readTag(p.decoder)
 
 	if tag == dicomtag.PixelData && options.DropPixelData {
@@ -297,13 +346,17 @@ func (p *parser) ParseNext(options ParseOptions) *element.Element {
 				datasetToUse = p.currentSequenceDataset
 			}
 
-			image, _, err := readNativeFrames(p.decoder, datasetToUse, p.frameChannel)
+			image, bytesRead, err := readNativeFrames(p.decoder, datasetToUse, p.frameChannel)
 
 			if err != nil {
 				p.decoder.SetError(err)
 				dicomlog.Vprintf(1, "dicom.ReadElement: Error reading native frames")
 				return nil
 			}
+			if int(vl) > bytesRead {
+				// Skip the padding byte that follows an odd number of 8-bit samples.
+				p.decoder.Skip(int(vl) - bytesRead)
+			}
 
 			data = append(data, *image)
 		}
@@ -370,7 +423,9 @@ func (p *parser) ParseNext(options ParseOptions) *element.Element {
 					break
 				}
 				data = append(data, subelem)
-				p.currentSequenceDataset.Elements = append(p.currentSequenceDataset.Elements, subelem)
+				if p.currentSequenceDataset != nil { // nil for an Item outside of any SQ
+					p.currentSequenceDataset.Elements = append(p.currentSequenceDataset.Elements, subelem)
+				}
 			}
 		} else {
 			// Sequence of arbitary elements, for the  total of "vl" bytes.
@@ -382,7 +437,9 @@ func (p *parser) ParseNext(options ParseOptions) *element.Element {
 					break
 				}
 				data = append(data, subelem)
-				p.currentSequenceDataset.Elements = append(p.currentSequenceDataset.Elements, subelem)
+				if p.currentSequenceDataset != nil { // nil for an Item outside of any SQ
+					p.currentSequenceDataset.Elements = append(p.currentSequenceDataset.Elements, subelem)
+				}
 			}
 			p.decoder.PopLimit()
 		}
@@ -425,7 +482,12 @@ func (p *parser) ParseNext(options ParseOptions) *element.Element {
 		} else if vr == "LT" || vr == "UT" {
 			str := p.decoder.ReadString(int(vl))
 			data = append(data, str)
-		} else if vr == "UL" {
+		} else if vr == "UR" {
+			// A single URI, which may contain backslashes. Trailing spaces
+			// are padding (P3.5 6.2).
+			str := p.decoder.ReadString(int(vl))
+			data = append(data, strings.TrimRight(str, " "))
+		} else if vr == "UL" || vr == "OL" {
 			for p.decoder.Len() > 0 && p.decoder.Error() == nil {
 				data = append(data, p.decoder.ReadUInt32())
 			}
@@ -441,11 +503,11 @@ func (p *parser) ParseNext(options ParseOptions) *element.Element {
 			for p.decoder.Len() > 0 && p.decoder.Error() == nil {
 				data = append(data, p.decoder.ReadInt16())
 			}
-		} else if vr == "FL" {
+		} else if vr == "FL" || vr == "OF" {
 			for p.decoder.Len() > 0 && p.decoder.Error() == nil {
 				data = append(data, p.decoder.ReadFloat32())
 			}
-		} else if vr == "FD" {
+		} else if vr == "FD" || vr == "OD" {
 			for p.decoder.Len() > 0 && p.decoder.Error() == nil {
 				data = append(data, p.decoder.ReadFloat64())
 			}
@@ -495,8 +557,20 @@ func (p *parser) parseFileHeader() []*element.Element {
 		}
 	}
 
+	// The meta elements are kept as they are read, for a later Parse with
+	// KeepRawBytes.
+	p.metaRawBytes = map[*element.Element]element.Element{}
+	parseMetaElem := func() *element.Element {
+		elem := p.ParseNext(ParseOptions{KeepRawBytes: true})
+		if elem != nil {
+			p.metaRawBytes[elem] = element.Element{RawBytes: elem.RawBytes, RawDigest: elem.RawDigest}
+			elem.RawBytes, elem.RawDigest = nil, nil
+		}
+		return elem
+	}
+
 	// (0002,0000) MetaElementGroupLength
-	metaElem := p.ParseNext(ParseOptions{})
+	metaElem := parseMetaElem()
 	if p.decoder.Error() != nil {
 		return nil
 	}
@@ -518,7 +592,7 @@ func (p *parser) parseFileHeader() []*element.Element {
 	p.decoder.PushLimit(metaLength)
 	defer p.decoder.PopLimit()
 	for p.decoder.Len() > 0 {
-		elem := p.ParseNext(ParseOptions{})
+		elem := parseMetaElem()
 		if p.decoder.Error() != nil {
 			break
 		}
@@ -550,6 +624,12 @@ type ParseOptions struct {
 	// StopAtag defines a tag at which when read (or a tag with a greater
 	// value than it is read), the program will stop parsing the dicom file.
 	StopAtTag *dicomtag.Tag
+
+	// KeepRawBytes makes the parser keep the bytes each top-level element,
+	// meta elements included, is read from in its RawBytes, along with its
+	// RawDigest, for write.WithFaithfulCopy. PixelData is then held twice in
+	// memory, and each element is also encoded once to compute its digest.
+	KeepRawBytes bool
 }
 
 // readNativeFrames reads NativeData frames from a Decoder based on already parsed pixel information
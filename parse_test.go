@@ -1,8 +1,12 @@
 package dicom_test
 
 import (
+	"bytes"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -89,6 +93,24 @@ func TestWriteFile(t *testing.T) {
 	testWriteFile(t, "examples/CT-MONO2-16-ort.dcm", dicomuid.ExplicitVRLittleEndian)
 }
 
+func TestReadAndWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dicom")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	data, err := dicom.ReadDataSetFromFile("examples/CT-MONO2-16-ort.dcm", dicom.ParseOptions{})
+	require.NoError(t, err)
+	path := filepath.Join(dir, "test.dcm")
+	require.NoError(t, write.DataSetToFile(path, data))
+	data2, err := dicom.ReadDataSetFromFile(path, dicom.ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, len(data.Elements), len(data2.Elements))
+
+	_, err = dicom.ReadDataSetFromFile(filepath.Join(dir, "nonexistent.dcm"), dicom.ParseOptions{})
+	assert.Error(t, err)
+	assert.Error(t, write.DataSetToFile(filepath.Join(dir, "nonexistent", "test.dcm"), data))
+	assert.Error(t, write.DataSetToFile(path, &element.DataSet{}))
+}
+
 func TestReadDataSet(t *testing.T) {
 	data := mustReadFile("examples/IM-0001-0001.dcm", dicom.ParseOptions{})
 	elem, err := data.FindElementByName("PatientName")
@@ -102,6 +124,103 @@ func TestReadDataSet(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestTransform(t *testing.T) {
+	// A file with native pixel data, read with the elements of group 0028.
+	in, err := os.Open("examples/CT-MONO2-16-ort.dcm")
+	require.NoError(t, err)
+	defer in.Close()
+	var out bytes.Buffer
+	err = dicom.Transform(in, &out, func(elem *element.Element) *element.Element {
+		switch elem.Tag {
+		case dicomtag.PatientName:
+			return element.MustNewElement(dicomtag.PatientName, strings.ToUpper(elem.MustGetString()))
+		case dicomtag.Modality:
+			return nil
+		}
+		return elem
+	})
+	require.NoError(t, err)
+	p, err := dicom.NewParserFromBytes(out.Bytes(), nil)
+	require.NoError(t, err)
+	data, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	elem, err := data.FindElementByTag(dicomtag.PatientName)
+	require.NoError(t, err)
+	assert.Equal(t, "ANONYMIZED", elem.MustGetString())
+
+	_, err = data.FindElementByTag(dicomtag.Modality)
+	assert.Error(t, err)
+	orig := mustReadFile("examples/CT-MONO2-16-ort.dcm", dicom.ParseOptions{})
+	assert.Equal(t, []string{
+		"(0008,0060)[Modality]: only in the first dataset",
+		`(0010,0010)[PatientName]: "Anonymized" vs "ANONYMIZED"`,
+	}, orig.Diff(data))
+}
+
+func TestUpdateElementInPlace(t *testing.T) {
+	orig, err := ioutil.ReadFile("examples/CT-MONO2-16-ort.dcm")
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "dicom")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.dcm")
+	require.NoError(t, ioutil.WriteFile(path, orig, 0644))
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// "Anonymized" becomes a name of the same length.
+	require.NoError(t, dicom.UpdateElementInPlace(f, dicomtag.PatientName, "Doe^Jane^A"))
+	data := mustReadFile(path, dicom.ParseOptions{})
+	assert.Equal(t, []string{
+		`(0010,0010)[PatientName]: "Anonymized" vs "Doe^Jane^A"`,
+	}, mustReadFile("examples/CT-MONO2-16-ort.dcm", dicom.ParseOptions{}).Diff(data))
+	updated, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, len(orig), len(updated))
+
+	// Values that don't fit, missing elements and meta elements are errors,
+	// and leave the file as is.
+	for _, test := range []struct {
+		tag   dicomtag.Tag
+		value string
+	}{
+		{dicomtag.PatientName, "Doe^Jane^Alice"},
+		{dicomtag.AccessionNumber, "1234"},
+		{dicomtag.TransferSyntaxUID, dicomuid.ImplicitVRLittleEndian},
+	} {
+		assert.Error(t, dicom.UpdateElementInPlace(f, test.tag, test.value), "%v", test.tag)
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, updated, data, "%v", test.tag)
+	}
+}
+
+func TestFaithfulCopy(t *testing.T) {
+	// Both files have elements that the writer would pad or format
+	// differently, e.g., a meta element padded with a zero byte, and DS
+	// values with leading spaces.
+	for _, path := range []string{"examples/IM-0001-0001.dcm", "examples/I_000000.dcm"} {
+		orig, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		data := mustReadFile(path, dicom.ParseOptions{KeepRawBytes: true})
+		var out bytes.Buffer
+		require.NoError(t, write.DataSet(&out, data, write.KeepElementOrder, write.WithFaithfulCopy), path)
+		assert.True(t, bytes.Equal(orig, out.Bytes()), path)
+
+		out.Reset()
+		require.NoError(t, write.DataSet(&out, data, write.KeepElementOrder), path)
+		assert.False(t, bytes.Equal(orig, out.Bytes()), path)
+	}
+
+	// Raw bytes don't apply to another transfer syntax.
+	data := mustReadFile("examples/I_000000.dcm", dicom.ParseOptions{KeepRawBytes: true})
+	var faithful, plain bytes.Buffer
+	require.NoError(t, write.DataSet(&faithful, data, write.WithFaithfulCopy, write.WithTransferSyntax(dicomuid.ExplicitVRBigEndian)))
+	require.NoError(t, write.DataSet(&plain, data, write.WithTransferSyntax(dicomuid.ExplicitVRBigEndian)))
+	assert.True(t, bytes.Equal(plain.Bytes(), faithful.Bytes()))
+}
+
 // Test ReadOptions
 func TestReadOptions(t *testing.T) {
 	// Test Drop Pixel Data
@@ -0,0 +1,77 @@
+package dicom
+
+import (
+	"bufio"
+	"io"
+	"math"
+
+	"github.com/suyashkumar/dicom/element"
+	"github.com/suyashkumar/dicom/write"
+)
+
+// Transform copies the DICOM file read from in to out one element at a time,
+// passing every element, meta elements included, through fn: the element fn
+// returns is written in place of the one read, and nil drops it. Unlike Parse
+// followed by write.DataSet, it doesn't hold the dataset in memory; only the
+// Image Pixel elements (group 0028) are kept, to read native pixel data. in is
+// read until io.EOF. opts are passed to write.NewElementWriter.
+//
+//  err := dicom.Transform(in, out, func(elem *element.Element) *element.Element {
+//    if elem.Tag == dicomtag.PatientName {
+//      return element.MustNewElement(dicomtag.PatientName, "Anonymous")
+//    }
+//    return elem
+//  })
+func Transform(in io.Reader, out io.Writer, fn func(elem *element.Element) *element.Element, opts ...write.Option) error {
+	// The end of the file is found by peeking into the reader shared with
+	// the decoder, hence the unbounded limit.
+	br := bufio.NewReader(in)
+	p := newParserInternal(br, math.MaxInt64, nil, false)
+	metaElems := p.parseFileHeader()
+	if p.decoder.Error() != nil {
+		return p.decoder.Error()
+	}
+	p.parsedElements = &element.DataSet{Elements: metaElems}
+	endian, implicit, err := p.parsedElements.TransferSyntax()
+	if err != nil {
+		return err
+	}
+	var transformedMeta []*element.Element
+	for _, elem := range metaElems {
+		if elem = fn(elem); elem != nil {
+			transformedMeta = append(transformedMeta, elem)
+		}
+	}
+	w, err := write.NewElementWriter(out, transformedMeta, opts...)
+	if err != nil {
+		return err
+	}
+
+	p.decoder.PushTransferSyntax(endian, implicit)
+	defer p.decoder.PopTransferSyntax()
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		elem := p.ParseNext(ParseOptions{})
+		if p.decoder.Error() != nil {
+			return p.decoder.Error()
+		}
+		p.updateCodingSystem(elem)
+		if p.decoder.Error() != nil {
+			return p.decoder.Error()
+		}
+		if elem.Tag.Group == 0x0028 {
+			p.parsedElements.Elements = append(p.parsedElements.Elements, elem)
+		}
+		if elem = fn(elem); elem == nil {
+			continue
+		}
+		if err := w.WriteElement(elem); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
@@ -0,0 +1,99 @@
+package dicom
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/suyashkumar/dicom/dicomio"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/dicomuid"
+	"github.com/suyashkumar/dicom/element"
+	"github.com/suyashkumar/dicom/write"
+)
+
+// UpdateElementInPlace replaces the values of the top-level element with the
+// given tag in the DICOM file rw, without rewriting the rest of the file. The
+// element keeps the VR it has in the file, and values are encoded as by
+// write.Element. Only the elements before the one updated are read, so
+// PixelData is usually never loaded.
+//
+// The new element must encode to exactly as many bytes as the old one,
+// padding included; otherwise, UpdateElementInPlace returns an error and rw
+// is left untouched, and the file has to be rewritten, e.g., with Transform.
+// Meta elements and files in Deflated Explicit VR Little Endian can't be
+// updated in place either.
+//
+//  f, err := os.OpenFile("big.dcm", os.O_RDWR, 0)
+//  err = dicom.UpdateElementInPlace(f, dicomtag.PatientID, "12345678")
+func UpdateElementInPlace(rw io.ReadWriteSeeker, tag dicomtag.Tag, values ...interface{}) error {
+	if tag.Group == dicomtag.MetadataGroup {
+		return fmt.Errorf("UpdateElementInPlace: %v is a meta element", dicomtag.DebugString(tag))
+	}
+	size, err := rw.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := rw.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	p := newParserInternal(rw, size, nil, false)
+	metaElems := p.parseFileHeader()
+	if p.decoder.Error() != nil {
+		return p.decoder.Error()
+	}
+	p.parsedElements = &element.DataSet{Elements: metaElems}
+	if elem, err := p.parsedElements.FindElementByTag(dicomtag.TransferSyntaxUID); err == nil {
+		if uid, err := elem.GetString(); err == nil {
+			if canonical, err := dicomio.CanonicalTransferSyntaxUID(uid); err == nil && canonical == dicomuid.DeflatedExplicitVRLittleEndian {
+				return fmt.Errorf("UpdateElementInPlace: the dataset is deflated")
+			}
+		}
+	}
+	endian, implicit, err := p.parsedElements.TransferSyntax()
+	if err != nil {
+		return err
+	}
+
+	// Find the element and the offsets of its start and end in rw.
+	p.decoder.PushTransferSyntax(endian, implicit)
+	defer p.decoder.PopTransferSyntax()
+	var old *element.Element
+	var start, end int64
+	for p.decoder.Len() > 0 {
+		start = size - p.decoder.Len()
+		elem := p.ParseNext(ParseOptions{})
+		if p.decoder.Error() != nil {
+			return p.decoder.Error()
+		}
+		if elem.Tag == tag {
+			old, end = elem, size-p.decoder.Len()
+			break
+		}
+		if elem.Tag.Compare(tag) > 0 {
+			// Elements are sorted by tag.
+			break
+		}
+		p.parsedElements.Elements = append(p.parsedElements.Elements, elem)
+	}
+	if old == nil {
+		return fmt.Errorf("UpdateElementInPlace: %v not found", dicomtag.DebugString(tag))
+	}
+
+	elem, err := element.NewElement(tag, values...)
+	if err != nil || elem.VR != old.VR {
+		elem = &element.Element{Tag: tag, VR: old.VR, Value: values}
+	}
+	e := dicomio.NewBytesEncoder(endian, implicit)
+	write.Element(e, elem)
+	if e.Error() != nil {
+		return e.Error()
+	}
+	if n := int64(len(e.Bytes())); n != end-start {
+		return fmt.Errorf("UpdateElementInPlace: %v would take %d bytes instead of %d", dicomtag.DebugString(tag), n, end-start)
+	}
+	if _, err := rw.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = rw.Write(e.Bytes())
+	return err
+}
@@ -0,0 +1,357 @@
+package write
+
+import (
+	"bufio"
+	"compress/flate"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/suyashkumar/dicom/dicomio"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/dicomuid"
+	"github.com/suyashkumar/dicom/element"
+)
+
+// ElementWriter writes a DICOM file one element at a time, so that the whole
+// DataSet never has to be held in memory.
+//
+//  w, err := write.NewElementWriter(out, metaElems)
+//  for ... {
+//    err := w.WriteElement(elem)
+//  }
+//  err := w.Close()
+type ElementWriter struct {
+	e       *dicomio.Encoder
+	options optSet
+	// Non-nil iff the transfer syntax is Deflated Explicit VR Little Endian.
+	deflater *flate.Writer
+	// Values of the private creator elements written so far, keyed by their
+	// tag, to look up the VRs of private data elements.
+	privateCreators map[dicomtag.Tag]string
+	// Value of the BitsAllocated element written so far, or 0.
+	bitsAllocated int
+	// Non-nil iff there's a WithElementHook, to measure each element.
+	counter *countingWriter
+	// Non-nil unless buffering is disabled by WithBufferSize.
+	buffer *bufio.Writer
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	out io.Writer
+	n   int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.out.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewElementWriter writes the file header built from metaElems (see
+// FileHeader) to out, and returns an ElementWriter that encodes the elements
+// that follow using the transfer syntax found in metaElems. With Deflated
+// Explicit VR Little Endian, the elements are compressed as per P3.5 A.5.
+func NewElementWriter(out io.Writer, metaElems []*element.Element, opts ...Option) (*ElementWriter, error) {
+	options := optsIntoOptSet(opts...)
+	if options.hash != nil {
+		out = io.MultiWriter(out, options.hash)
+	}
+	var buffer *bufio.Writer
+	if options.bufferSize >= 0 {
+		size := options.bufferSize
+		if size == 0 {
+			size = defaultBufferSize
+		}
+		buffer = bufio.NewWriterSize(out, size)
+		out = buffer
+	}
+	sourceEndian, sourceImplicit, _ := (&element.DataSet{Elements: metaElems}).TransferSyntax()
+	if options.transferSyntaxUID != "" {
+		if _, _, err := dicomio.ParseTransferSyntaxUID(options.transferSyntaxUID); err != nil {
+			return nil, err
+		}
+		metaElems = withTransferSyntaxUID(metaElems, options.transferSyntaxUID)
+	}
+	endian, implicit, err := (&element.DataSet{Elements: metaElems}).TransferSyntax()
+	if err != nil {
+		return nil, err
+	}
+	if options.pixelByteSwap == autoPixelByteSwap && sourceEndian != nil && sourceEndian != endian {
+		// Raw pixel bytes are in the byte order of the source.
+		options.pixelByteSwap = swapPixelBytes
+	}
+	if sourceEndian != endian || sourceImplicit != implicit {
+		// Raw element bytes are in the transfer syntax of the source.
+		options.faithfulCopy = false
+	}
+	headerElems := metaElems
+	if uid := options.transferSyntaxLabel; uid != "" {
+		if info, err := dicomuid.Lookup(uid); err != nil || info.Type != dicomuid.TypeTransferSyntax {
+			return nil, fmt.Errorf("write.NewElementWriter: '%v' is not a registered transfer syntax UID", uid)
+		}
+		headerElems = withTransferSyntaxUID(metaElems, uid)
+	}
+	if !options.omitMetaGroup {
+		header := dicomio.NewEncoder(out, nil, dicomio.UnknownVR)
+		FileHeader(header, headerElems, opts...)
+		if header.Error() != nil {
+			return nil, header.Error()
+		}
+	}
+	if isVideoTransferSyntax(metaElems) {
+		options.emptyBasicOffsetTable = true
+	}
+	w := &ElementWriter{options: options, privateCreators: map[dicomtag.Tag]string{}, buffer: buffer}
+	if uid, err := transferSyntaxUID(metaElems); err == nil && uid == dicomuid.DeflatedExplicitVRLittleEndian {
+		// Deflate, as in RFC 1951, without the zlib header.
+		w.deflater, err = flate.NewWriter(out, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		out = w.deflater
+	}
+	if options.elementHook != nil {
+		w.counter = &countingWriter{out: out}
+		out = w.counter
+	}
+	w.e = dicomio.NewEncoder(out, endian, implicit)
+	if options.defaultCharset != nil {
+		cs, err := dicomio.ParseSpecificCharacterSetEncoder(options.defaultCharset)
+		if err != nil {
+			return nil, err
+		}
+		w.e.SetCharset(cs)
+	}
+	return w, nil
+}
+
+// withTransferSyntaxUID returns a copy of metaElems with the TransferSyntaxUID
+// element replaced by uid.
+func withTransferSyntaxUID(metaElems []*element.Element, uid string) []*element.Element {
+	var overridden []*element.Element
+	for _, elem := range metaElems {
+		if elem.Tag != dicomtag.TransferSyntaxUID {
+			overridden = append(overridden, elem)
+		}
+	}
+	return append(overridden, element.MustNewElement(dicomtag.TransferSyntaxUID, uid))
+}
+
+// transferSyntaxUID returns the canonical transfer syntax UID in metaElems.
+func transferSyntaxUID(metaElems []*element.Element) (string, error) {
+	elem, err := element.FindByTag(metaElems, dicomtag.TransferSyntaxUID)
+	if err != nil {
+		return "", err
+	}
+	uid, err := elem.GetString()
+	if err != nil {
+		return "", err
+	}
+	return dicomio.CanonicalTransferSyntaxUID(uid)
+}
+
+// isVideoTransferSyntax reports whether the transfer syntax in metaElems is an
+// MPEG2, MPEG-4 AVC/H.264 or HEVC/H.265 one. Their pixel data is a single
+// bit stream, not separately addressable frames, so the Basic Offset Table
+// must be empty (P3.5 8.2.5).
+func isVideoTransferSyntax(metaElems []*element.Element) bool {
+	elem, err := element.FindByTag(metaElems, dicomtag.TransferSyntaxUID)
+	if err != nil {
+		return false
+	}
+	uid, err := elem.GetString()
+	if err != nil {
+		return false
+	}
+	switch strings.TrimRight(uid, " \x00") {
+	case "1.2.840.10008.1.2.4.100", "1.2.840.10008.1.2.4.101", // MPEG2
+		"1.2.840.10008.1.2.4.102", "1.2.840.10008.1.2.4.103", "1.2.840.10008.1.2.4.104",
+		"1.2.840.10008.1.2.4.105", "1.2.840.10008.1.2.4.106", // MPEG-4 AVC/H.264
+		"1.2.840.10008.1.2.4.107", "1.2.840.10008.1.2.4.108": // HEVC/H.265
+		return true
+	}
+	return false
+}
+
+// WriteElement encodes one non-meta element, unless WithTagFilter excludes
+// it. Once an error is returned, all later calls return the same error.
+func (w *ElementWriter) WriteElement(elem *element.Element) error {
+	if w.e.Error() != nil {
+		return w.e.Error()
+	}
+	if elem.Tag.Group == dicomtag.MetadataGroup {
+		w.e.SetError(fmt.Errorf("%v: meta elements must be passed to NewElementWriter", dicomtag.DebugString(elem.Tag)))
+		return w.e.Error()
+	}
+	if filteredOut(elem.Tag, w.options) {
+		return nil
+	}
+	if err := updateCharset(w.e, elem); err != nil {
+		w.e.SetError(err)
+		return err
+	}
+	elem, err := w.resolvePixelData(w.resolvePrivateVR(elem))
+	if err != nil {
+		w.e.SetError(err)
+		return err
+	}
+	if w.counter == nil {
+		encodeElement(w.e, elem, w.options)
+		return w.e.Error()
+	}
+	start := w.counter.n
+	encodeElement(w.e, elem, w.options)
+	if w.e.Error() == nil {
+		w.options.elementHook(elem, int(w.counter.n-start))
+	}
+	return w.e.Error()
+}
+
+// resolvePixelData returns elem, or, if elem is PixelData without a VR, a copy
+// of it with OB for encapsulated or 8-bit data and OW otherwise (P3.5 8.1.1),
+// going by the BitsAllocated element written before it. It also records
+// BitsAllocated, and reports native frames whose samples don't have that size,
+// as readers would misinterpret them.
+func (w *ElementWriter) resolvePixelData(elem *element.Element) (*element.Element, error) {
+	if elem.Tag == dicomtag.BitsAllocated {
+		if bits, ok := singleValue(elem).(uint16); ok {
+			w.bitsAllocated = int(bits)
+		}
+		return elem, nil
+	}
+	if elem.Tag != dicomtag.PixelData {
+		return elem, nil
+	}
+	bits := w.bitsAllocated
+	encapsulated := false
+	switch v := singleValue(elem).(type) {
+	case element.PixelDataInfo:
+		encapsulated = v.IsEncapsulated
+		for i, frame := range v.Frames {
+			if encapsulated || frame.Encapsulated {
+				break
+			}
+			if bits == 0 {
+				bits = frame.NativeData.BitsPerSample
+			} else if frame.NativeData.BitsPerSample != bits {
+				return nil, fmt.Errorf("%v: frame %d has %d bits per sample, but BitsAllocated is %d",
+					dicomtag.DebugString(elem.Tag), i, frame.NativeData.BitsPerSample, bits)
+			}
+		}
+	}
+	if elem.VR != "" {
+		return elem, nil
+	}
+	resolved := *elem
+	if encapsulated || (bits > 0 && bits <= 8) {
+		resolved.VR = "OB"
+	} else {
+		resolved.VR = "OW"
+	}
+	return &resolved, nil
+}
+
+// updateCharset makes e encode the strings that follow in the character set
+// of elem if it is SpecificCharacterSet, as the parser decodes them. Like the
+// parser, this ignores SpecificCharacterSet in sequences.
+func updateCharset(e *dicomio.Encoder, elem *element.Element) error {
+	if elem.Tag != dicomtag.SpecificCharacterSet {
+		return nil
+	}
+	encodingNames, err := elem.GetStrings()
+	if err != nil {
+		return err
+	}
+	cs, err := dicomio.ParseSpecificCharacterSetEncoder(encodingNames)
+	if err != nil {
+		return err
+	}
+	e.SetCharset(cs)
+	return nil
+}
+
+// resolvePrivateVR returns elem, or a copy of it with the VR that the private
+// dictionary (see dicomtag.RegisterPrivateTag) defines for it if elem is a
+// private data element without a VR. It also records the values of private
+// creator elements. Elements in sequences aren't resolved.
+func (w *ElementWriter) resolvePrivateVR(elem *element.Element) *element.Element {
+	if dicomtag.IsPrivateCreator(elem.Tag) {
+		if creator, err := elem.GetString(); err == nil {
+			w.privateCreators[elem.Tag] = creator
+		}
+		return elem
+	}
+	if elem.VR != "" || !dicomtag.IsPrivate(elem.Tag.Group) {
+		return elem
+	}
+	creator, ok := w.privateCreators[dicomtag.Tag{Group: elem.Tag.Group, Element: elem.Tag.Element >> 8}]
+	if !ok {
+		return elem
+	}
+	info, err := dicomtag.FindPrivate(creator, elem.Tag)
+	if err != nil {
+		return elem
+	}
+	resolved := *elem
+	resolved.VR = info.VR
+	return &resolved
+}
+
+// singleValue returns the value of elem if it has exactly one, else nil.
+func singleValue(elem *element.Element) interface{} {
+	if len(elem.Value) != 1 {
+		return nil
+	}
+	return elem.Value[0]
+}
+
+// groupLength returns the encoded length of the leading elements of elems in
+// the given group, up to the next group length element, as the value of a
+// group length element written before them.
+func (w *ElementWriter) groupLength(elems []*element.Element, group uint16) (uint32, error) {
+	sube, buf := newSubEncoder(w.e)
+	defer putBuffer(buf)
+	length := 0
+	for _, elem := range elems {
+		if elem.Tag.Group != group || elem.Tag.Element == 0x0000 {
+			break
+		}
+		if filteredOut(elem.Tag, w.options) {
+			continue
+		}
+		if err := updateCharset(sube, elem); err != nil {
+			return 0, err
+		}
+		if stream, ok := singleValue(elem).(element.PixelDataStream); ok {
+			// Measure the header only, so that the readers aren't consumed.
+			n := stream.FrameLength * len(stream.Frames)
+			length += n + n%2
+			elem = &element.Element{Tag: elem.Tag, VR: elem.VR, Value: []interface{}{element.PixelDataStream{}}}
+		} else if lazy, ok := singleValue(elem).(element.LazyValue); ok {
+			// Same for lazy values, which aren't to be loaded twice.
+			n := lazy.Len()
+			length += int(n + n%2)
+			elem = &element.Element{Tag: elem.Tag, VR: elem.VR, Value: []interface{}{element.NewSectionValue(nil, 0, 0)}}
+		}
+		encodeElement(sube, w.resolvePrivateVR(elem), w.options)
+		if sube.Error() != nil {
+			return 0, sube.Error()
+		}
+	}
+	return uint32(length + len(sube.Bytes())), nil
+}
+
+// Close finishes writing, flushing the output buffer, and returns the first
+// error encountered, if any. It does not close the underlying io.Writer.
+func (w *ElementWriter) Close() error {
+	if w.deflater != nil {
+		w.e.SetError(w.deflater.Close())
+		w.deflater = nil
+	}
+	if w.buffer != nil && w.e.Error() == nil {
+		w.e.SetError(w.buffer.Flush())
+	}
+	return w.e.Error()
+}
@@ -0,0 +1,181 @@
+package write_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/dicomuid"
+	"github.com/suyashkumar/dicom/element"
+	"github.com/suyashkumar/dicom/frame"
+	"github.com/suyashkumar/dicom/write"
+)
+
+func TestElementWriter(t *testing.T) {
+	var out bytes.Buffer
+	meta := newTestDataSet(dicomuid.ImplicitVRLittleEndian).Elements
+	w, err := write.NewElementWriter(&out, meta)
+	require.NoError(t, err)
+	// Generate elements lazily, one at a time.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.WriteElement(
+			element.MustNewElement(dicomtag.Tag{Group: 0x0020, Element: 0x0011 + uint16(i)}, fmt.Sprint(i))))
+	}
+	require.NoError(t, w.Close())
+
+	p, err := dicom.NewParserFromBytes(out.Bytes(), nil)
+	require.NoError(t, err)
+	ds, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		elem, err := ds.FindElementByTag(dicomtag.Tag{Group: 0x0020, Element: 0x0011 + uint16(i)})
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(i), elem.MustGetString())
+	}
+}
+
+func TestElementWriterRejectsMetaElements(t *testing.T) {
+	var out bytes.Buffer
+	w, err := write.NewElementWriter(&out, newTestDataSet(dicomuid.ExplicitVRLittleEndian).Elements)
+	require.NoError(t, err)
+	assert.Error(t, w.WriteElement(element.MustNewElement(dicomtag.ImplementationVersionName, "FOO")))
+	// The error sticks.
+	assert.Error(t, w.WriteElement(element.MustNewElement(dicomtag.PatientName, "Foo")))
+	assert.Error(t, w.Close())
+
+	// Without a transfer syntax, no header can be written.
+	_, err = write.NewElementWriter(&out, nil)
+	assert.Error(t, err)
+}
+
+func TestEncapsulatedPixelDataWriter(t *testing.T) {
+	frames := [][]byte{
+		{0xff, 0xd8, 0x01, 0xff, 0xd9},
+		{0xff, 0xd8, 0x02, 0x03, 0x04, 0x05, 0xff, 0xd9},
+	}
+	image := element.PixelDataInfo{IsEncapsulated: true}
+	for _, data := range frames {
+		image.Frames = append(image.Frames, frame.Frame{
+			Encapsulated:     true,
+			EncapsulatedData: frame.EncapsulatedFrame{Data: data},
+		})
+	}
+	ds := newTestDataSet("1.2.840.10008.1.2.4.50" /* JPEG Baseline */, &element.Element{
+		Tag: dicomtag.PixelData, VR: "OB", Value: []interface{}{image}})
+	var want bytes.Buffer
+	require.NoError(t, write.DataSet(&want, ds))
+
+	frameLengths := []int{len(frames[0]), len(frames[1])}
+	for _, lengths := range [][]int{frameLengths, nil} {
+		var out bytes.Buffer
+		w, err := write.NewElementWriter(&out, ds.Elements[:3])
+		require.NoError(t, err)
+		pw, err := write.NewEncapsulatedPixelDataWriter(w, lengths)
+		require.NoError(t, err)
+		for _, data := range frames {
+			require.NoError(t, pw.AddFrame(data))
+		}
+		require.NoError(t, pw.Close())
+		require.NoError(t, w.Close())
+		if lengths != nil {
+			// Same as writing the whole PixelDataInfo at once.
+			assert.Equal(t, want.Bytes(), out.Bytes())
+		} else {
+			// PixelData with undefined length, then an empty Basic Offset Table.
+			assert.Contains(t, out.String(), "\xe0\x7f\x10\x00OB\x00\x00\xff\xff\xff\xff\xfe\xff\x00\xe0\x00\x00\x00\x00")
+		}
+
+		p, err := dicom.NewParserFromBytes(out.Bytes(), nil)
+		require.NoError(t, err)
+		ds2, err := p.Parse(dicom.ParseOptions{})
+		require.NoError(t, err)
+		elem, err := ds2.FindElementByTag(dicomtag.PixelData)
+		require.NoError(t, err)
+		got := elem.Value[0].(element.PixelDataInfo)
+		require.Len(t, got.Frames, len(frames))
+		assert.Equal(t, []byte{0xff, 0xd8, 0x01, 0xff, 0xd9, 0}, got.Frames[0].EncapsulatedData.Data)
+		assert.Equal(t, frames[1], got.Frames[1].EncapsulatedData.Data)
+	}
+
+	// The number of frames must match the one given.
+	var out bytes.Buffer
+	w, err := write.NewElementWriter(&out, ds.Elements[:3])
+	require.NoError(t, err)
+	pw, err := write.NewEncapsulatedPixelDataWriter(w, frameLengths)
+	require.NoError(t, err)
+	require.NoError(t, pw.AddFrame(frames[0]))
+	assert.Error(t, pw.Close())
+	assert.Error(t, w.Close())
+
+	// So must the length of each frame.
+	out.Reset()
+	w, err = write.NewElementWriter(&out, ds.Elements[:3])
+	require.NoError(t, err)
+	pw, err = write.NewEncapsulatedPixelDataWriter(w, frameLengths)
+	require.NoError(t, err)
+	assert.Error(t, pw.AddFrame(frames[1]))
+	assert.Error(t, w.Close())
+
+	// An empty list of lengths means no frame at all.
+	out.Reset()
+	w, err = write.NewElementWriter(&out, ds.Elements[:3])
+	require.NoError(t, err)
+	pw, err = write.NewEncapsulatedPixelDataWriter(w, []int{})
+	require.NoError(t, err)
+	assert.Error(t, pw.AddFrame(frames[0]))
+	assert.Error(t, w.Close())
+}
+
+func TestEncapsulatedPixelDataWriterOptions(t *testing.T) {
+	ds := newTestDataSet("1.2.840.10008.1.2.4.50" /* JPEG Baseline */)
+	frames := [][]byte{{0xff, 0xd8, 0x01, 0xff, 0xd9}, {0xff, 0xd8, 0x02, 0xff}}
+	writeFrames := func(opts ...write.Option) []byte {
+		var out bytes.Buffer
+		w, err := write.NewElementWriter(&out, ds.Elements, opts...)
+		require.NoError(t, err)
+		pw, err := write.NewEncapsulatedPixelDataWriter(w, []int{len(frames[0]), len(frames[1])})
+		require.NoError(t, err)
+		for _, data := range frames {
+			require.NoError(t, pw.AddFrame(data))
+		}
+		require.NoError(t, pw.Close())
+		require.NoError(t, w.Close())
+		return out.Bytes()
+	}
+	var header bytes.Buffer
+	require.NoError(t, write.DataSet(&header, ds))
+	assert.Equal(t, header.Bytes(), writeFrames(write.WithoutPixelData))
+
+	var tags []dicomtag.Tag
+	size := 0
+	writeFrames(write.WithElementHook(func(elem *element.Element, bytesWritten int) {
+		tags = append(tags, elem.Tag)
+		size = bytesWritten
+	}))
+	assert.Equal(t, []dicomtag.Tag{dicomtag.PixelData}, tags)
+	// The header, the Basic Offset Table, two fragments and the delimiter.
+	assert.Equal(t, 12+(8+8)+(8+6)+(8+4)+8, size)
+}
+
+func TestWithElementHook(t *testing.T) {
+	ds := newTestDataSet(dicomuid.DeflatedExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.PatientName, "Doe^John"),
+		element.MustNewElement(dicomtag.ReferencedImageSequence,
+			newItem(true, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3"))))
+	sizes := map[dicomtag.Tag]int{}
+	var tags []dicomtag.Tag
+	hook := func(elem *element.Element, bytesWritten int) {
+		tags = append(tags, elem.Tag)
+		sizes[elem.Tag] = bytesWritten
+	}
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds, write.WithElementHook(hook)))
+	assert.Equal(t, []dicomtag.Tag{dicomtag.ReferencedImageSequence, dicomtag.PatientName}, tags)
+	assert.Equal(t, 8+8, sizes[dicomtag.PatientName])
+	// The sequence header, and the item with its delimiter.
+	assert.Equal(t, 12+8+(8+6)+8, sizes[dicomtag.ReferencedImageSequence])
+}
@@ -0,0 +1,82 @@
+//go:build go1.18
+// +build go1.18
+
+package write_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/element"
+	"github.com/suyashkumar/dicom/write"
+)
+
+// FuzzRoundTrip checks that any file the parser accepts is written back to a
+// file that parses to the same dataset. The example files seed the corpus;
+// run "go test -fuzz=FuzzRoundTrip ./write" to explore beyond them.
+func FuzzRoundTrip(f *testing.F) {
+	paths, err := filepath.Glob("../examples/*.dcm")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := dicom.NewParserFromBytes(data, nil)
+		if err != nil {
+			return
+		}
+		ds, err := p.Parse(dicom.ParseOptions{})
+		if err != nil {
+			return
+		}
+		var out bytes.Buffer
+		if err := write.DataSet(&out, ds); err != nil {
+			// The parser accepts files that can't be written back, e.g., with
+			// VRs that don't match the dictionary.
+			return
+		}
+		p, err = dicom.NewParserFromBytes(out.Bytes(), nil)
+		if err != nil {
+			t.Fatalf("parse written file: %v", err)
+		}
+		ds2, err := p.Parse(dicom.ParseOptions{})
+		if err != nil {
+			t.Fatalf("parse written file: %v", err)
+		}
+		// Elements are sorted when written, so compare them regardless of
+		// order.
+		want, got := elementStrings(ds), elementStrings(ds2)
+		if len(want) != len(got) {
+			t.Fatalf("wrote %d elements, read back %d", len(want), len(got))
+		}
+		for i := range want {
+			if want[i] != got[i] {
+				t.Fatalf("element mismatch:\n%v\n%v", want[i], got[i])
+			}
+		}
+	})
+}
+
+// elementStrings returns the sorted string forms of the elements in ds, except
+// FileMetaInformationGroupLength, which is recomputed on write.
+func elementStrings(ds *element.DataSet) []string {
+	var s []string
+	for _, elem := range ds.Elements {
+		if elem.Tag != dicomtag.FileMetaInformationGroupLength {
+			s = append(s, elem.String())
+		}
+	}
+	sort.Strings(s)
+	return s
+}
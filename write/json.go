@@ -0,0 +1,202 @@
+package write
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suyashkumar/dicom/dicomio"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/element"
+)
+
+// jsonAttribute is one element in the DICOM JSON model (P3.18 F.2.2).
+type jsonAttribute struct {
+	VR           string        `json:"vr"`
+	Value        []interface{} `json:"Value,omitempty"`
+	InlineBinary string        `json:"InlineBinary,omitempty"`
+}
+
+// DataSetJSON writes "ds" to out in the DICOM JSON model (P3.18 Annex F), as
+// used by DICOMweb. Elements are keyed by their tag as eight hexadecimal
+// digits. Binary values (OB, OW, UN, PixelData, etc) are written inline in
+// base64, in Little Endian byte order; bulk data URIs aren't produced, so
+// encapsulated (compressed) pixel data is an error.
+//
+//  err := write.DataSetJSON(out, ds)
+func DataSetJSON(out io.Writer, ds *element.DataSet) error {
+	obj, err := jsonObject(ds.Elements)
+	if err != nil {
+		return fmt.Errorf("write.DataSetJSON: %v", err)
+	}
+	return json.NewEncoder(out).Encode(obj)
+}
+
+// jsonObject converts a dataset or the contents of an item into a JSON object.
+func jsonObject(elems []*element.Element) (map[string]*jsonAttribute, error) {
+	obj := make(map[string]*jsonAttribute, len(elems))
+	for _, elem := range elems {
+		attr, err := jsonElement(elem)
+		if err != nil {
+			return nil, err
+		}
+		obj[fmt.Sprintf("%04X%04X", elem.Tag.Group, elem.Tag.Element)] = attr
+	}
+	return obj, nil
+}
+
+// modelVR returns the VR of elem to use in the JSON and XML models.
+func modelVR(elem *element.Element) string {
+	vr := elem.VR
+	if vr == "" {
+		if entry, err := dicomtag.Find(elem.Tag); err == nil {
+			vr = entry.VR
+		} else if dicomtag.IsPrivateCreator(elem.Tag) {
+			vr = "LO"
+		} else {
+			vr = "UN"
+		}
+	}
+	if elem.Tag == dicomtag.PixelData && vr != "OB" {
+		vr = "OW"
+	}
+	return vr
+}
+
+// isBinaryVR reports whether values of vr are written as InlineBinary.
+func isBinaryVR(vr string) bool {
+	switch vr {
+	case "OB", "OD", "OF", "OL", "OW", "UN":
+		return true
+	}
+	return false
+}
+
+// inlineBinary returns the value of elem as it's encoded in Explicit VR
+// Little Endian, in base64. Encapsulated pixel data is an error, as its
+// encoding is a sequence of fragments rather than a value.
+func inlineBinary(elem *element.Element, vr string) (string, error) {
+	if info, ok := singleValue(elem).(element.PixelDataInfo); ok && info.IsEncapsulated {
+		return "", fmt.Errorf("%v: encapsulated pixel data can't be written inline", dicomtag.DebugString(elem.Tag))
+	}
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	encodeElement(e, &element.Element{Tag: elem.Tag, VR: vr, Value: elem.Value}, optSet{skipVRVerification: true})
+	if e.Error() != nil {
+		return "", e.Error()
+	}
+	// Strip the 12-byte header.
+	return base64.StdEncoding.EncodeToString(e.Bytes()[12:]), nil
+}
+
+// itemElements returns the elements of an item in a sequence.
+func itemElements(value interface{}) ([]*element.Element, error) {
+	item, ok := sequenceItem(value, false)
+	if !ok {
+		return nil, fmt.Errorf("SQ element must be an Item, but found %v", value)
+	}
+	var elems []*element.Element
+	for _, v := range item.Value {
+		subelem, ok := v.(*element.Element)
+		if !ok {
+			return nil, fmt.Errorf("Item values must be an element.Element, but found %v", v)
+		}
+		elems = append(elems, subelem)
+	}
+	return elems, nil
+}
+
+func jsonElement(elem *element.Element) (*jsonAttribute, error) {
+	vr := modelVR(elem)
+	attr := &jsonAttribute{VR: vr}
+	if isBinaryVR(vr) {
+		if len(elem.Value) == 0 {
+			return attr, nil
+		}
+		var err error
+		attr.InlineBinary, err = inlineBinary(elem, vr)
+		return attr, err
+	}
+	for _, value := range elem.Value {
+		v, err := jsonValue(vr, value)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", dicomtag.DebugString(elem.Tag), err)
+		}
+		attr.Value = append(attr.Value, v)
+	}
+	if len(attr.Value) == 1 && attr.Value[0] == nil {
+		attr.Value = nil // A single empty value is no value at all.
+	}
+	return attr, nil
+}
+
+// stringValue returns a value of a string VR without padding. Numeric DS and
+// IS values, and time.Time DA, TM and DT values, are formatted as in the
+// binary encoding.
+func stringValue(vr string, value interface{}) (string, error) {
+	s, ok := value.(string)
+	if t, isTime := value.(time.Time); isTime && (vr == "DA" || vr == "TM" || vr == "DT") {
+		s, ok = formatTime(vr, t), true
+	}
+	if name, isName := value.(element.PersonName); isName && vr == "PN" {
+		s, ok = name.String(), true
+	}
+	if !ok {
+		if vr != "DS" && vr != "IS" {
+			return "", fmt.Errorf("Non-string value found")
+		}
+		var err error
+		if s, err = formatNumber(vr, value); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimRight(s, " \x00"), nil
+}
+
+// jsonValue converts one value of an element with the given VR.
+func jsonValue(vr string, value interface{}) (interface{}, error) {
+	switch vr {
+	case "SQ":
+		elems, err := itemElements(value)
+		if err != nil {
+			return nil, err
+		}
+		return jsonObject(elems)
+	case "AT":
+		t, ok := value.(dicomtag.Tag)
+		if !ok {
+			return nil, fmt.Errorf("expect Tag, but found %v", value)
+		}
+		return fmt.Sprintf("%04X%04X", t.Group, t.Element), nil
+	case "US", "UL", "SS", "SL", "FL", "FD":
+		return value, nil
+	}
+	s, err := stringValue(vr, value)
+	if err != nil {
+		return nil, err
+	}
+	if s == "" {
+		return nil, nil // Empty values are null (P3.18 F.2.5).
+	}
+	switch vr {
+	case "DS":
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case "IS":
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	case "PN":
+		// Alphabetic, ideographic and phonetic component groups (P3.18
+		// F.2.2).
+		name := map[string]string{}
+		for i, group := range strings.SplitN(s, "=", 3) {
+			if group != "" {
+				name[[]string{"Alphabetic", "Ideographic", "Phonetic"}[i]] = group
+			}
+		}
+		return name, nil
+	}
+	return s, nil
+}
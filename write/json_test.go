@@ -0,0 +1,77 @@
+package write_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/element"
+	"github.com/suyashkumar/dicom/frame"
+	"github.com/suyashkumar/dicom/write"
+)
+
+func TestDataSetJSON(t *testing.T) {
+	ds := &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.SpecificCharacterSet, "ISO_IR 192"),
+		element.MustNewElement(dicomtag.ImageType, "ORIGINAL", "", "AXIAL"),
+		element.MustNewElement(dicomtag.PatientName, "Yamada^Tarou=山田^太郎=やまだ^たろう"),
+		element.MustNewElement(dicomtag.ReferringPhysicianName, "Foo^Bar"),
+		element.MustNewElement(dicomtag.PatientID, ""),
+		element.MustNewElement(dicomtag.SliceThickness, "1.5 "),
+		element.MustNewElement(dicomtag.NumberOfFrames, "3"),
+		element.MustNewElement(dicomtag.Rows, uint16(512)),
+		element.MustNewElement(dicomtag.FrameIncrementPointer, dicomtag.FrameTime),
+		element.MustNewElement(dicomtag.ReferencedImageSequence,
+			newItem(true, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3"))),
+		{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1010}, VR: "OB", Value: []interface{}{[]byte{1, 2, 3}}},
+		{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1011}, VR: "OW", Value: []interface{}{}},
+	}}
+	var out bytes.Buffer
+	require.NoError(t, write.DataSetJSON(&out, ds))
+	assert.JSONEq(t, `{
+		"00080005": {"vr": "CS", "Value": ["ISO_IR 192"]},
+		"00080008": {"vr": "CS", "Value": ["ORIGINAL", null, "AXIAL"]},
+		"00100010": {"vr": "PN", "Value": [{
+			"Alphabetic": "Yamada^Tarou",
+			"Ideographic": "山田^太郎",
+			"Phonetic": "やまだ^たろう"
+		}]},
+		"00080090": {"vr": "PN", "Value": [{"Alphabetic": "Foo^Bar"}]},
+		"00100020": {"vr": "LO"},
+		"00180050": {"vr": "DS", "Value": [1.5]},
+		"00280008": {"vr": "IS", "Value": [3]},
+		"00280010": {"vr": "US", "Value": [512]},
+		"00280009": {"vr": "AT", "Value": ["00181063"]},
+		"00081140": {"vr": "SQ", "Value": [{
+			"00081155": {"vr": "UI", "Value": ["1.2.3"]}
+		}]},
+		"00091010": {"vr": "OB", "InlineBinary": "AQIDAA=="},
+		"00091011": {"vr": "OW"}
+	}`, out.String())
+
+	ds.Elements = append(ds.Elements, &element.Element{Tag: dicomtag.StudyDate, VR: "DA", Value: []interface{}{20180101}})
+	assert.Error(t, write.DataSetJSON(&out, ds))
+}
+
+func TestDataSetJSONEncapsulatedPixelData(t *testing.T) {
+	encapsulated := element.PixelDataInfo{IsEncapsulated: true, Frames: []frame.Frame{{
+		Encapsulated:     true,
+		EncapsulatedData: frame.EncapsulatedFrame{Data: []byte{1, 2, 3, 4}},
+	}}}
+	native := element.PixelDataInfo{Frames: []frame.Frame{{
+		NativeData: frame.NativeFrame{Data: [][]int{{1}, {2}}, Rows: 1, Cols: 2, BitsPerSample: 8},
+	}}}
+	var out bytes.Buffer
+	require.NoError(t, write.DataSetJSON(&out, &element.DataSet{Elements: []*element.Element{
+		{Tag: dicomtag.PixelData, VR: "OB", Value: []interface{}{native}},
+	}}))
+	assert.JSONEq(t, `{"7FE00010": {"vr": "OB", "InlineBinary": "AQI="}}`, out.String())
+
+	ds := &element.DataSet{Elements: []*element.Element{
+		{Tag: dicomtag.PixelData, VR: "OB", UndefinedLength: true, Value: []interface{}{encapsulated}},
+	}}
+	assert.Error(t, write.DataSetJSON(&out, ds))
+	assert.Error(t, write.DataSetXML(&out, ds))
+}
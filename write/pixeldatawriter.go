@@ -0,0 +1,148 @@
+package write
+
+import (
+	"fmt"
+
+	"github.com/suyashkumar/dicom/dicomio"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/element"
+)
+
+// EncapsulatedPixelDataWriter writes an encapsulated PixelData element one
+// frame at a time, each frame as a single fragment (P3.5 A.4). It implements
+// io.WriteCloser, where every Write is one frame.
+//
+//  pw, err := write.NewEncapsulatedPixelDataWriter(w, frameLengths)
+//  for _, frame := range frames {
+//    err := pw.AddFrame(frame)
+//  }
+//  err := pw.Close()
+type EncapsulatedPixelDataWriter struct {
+	e       *dicomio.Encoder
+	options optSet
+	// Lengths of the frames expected, or nil if unknown.
+	frameLengths []int
+	// Whether WithoutPixelData or WithTagFilter excludes PixelData, in which
+	// case the frames are dropped.
+	skip bool
+	// Non-nil iff there's a WithElementHook, with its count at the start of
+	// the element.
+	counter *countingWriter
+	start   int64
+	// Number of frames added so far.
+	n      int
+	closed bool
+}
+
+// NewEncapsulatedPixelDataWriter writes the header of a PixelData element
+// with undefined length and its Basic Offset Table to w, and returns a writer
+// for its frames. No other element may be written to w until the returned
+// writer is closed.
+//
+// The Basic Offset Table is computed from frameLengths, the length of each
+// frame to be added, so that every frame is encoded as soon as it's added.
+// With frameLengths nil (frames unknown in advance), or with
+// EmptyBasicOffsetTable, the Basic Offset Table is empty. As with
+// WriteElement, nothing is written if WithoutPixelData or WithTagFilter
+// excludes PixelData, and the hook of WithElementHook is called on Close.
+func NewEncapsulatedPixelDataWriter(w *ElementWriter, frameLengths []int) (*EncapsulatedPixelDataWriter, error) {
+	if w.e.Error() != nil {
+		return nil, w.e.Error()
+	}
+	for i, length := range frameLengths {
+		if length < 0 {
+			w.e.SetErrorf("%v: frame %d has negative length %d", dicomtag.DebugString(dicomtag.PixelData), i, length)
+			return nil, w.e.Error()
+		}
+	}
+	pw := &EncapsulatedPixelDataWriter{
+		e:       w.e,
+		options: w.options,
+		skip:    filteredOut(dicomtag.PixelData, w.options),
+		counter: w.counter,
+	}
+	if frameLengths != nil {
+		// An empty list means no frames, unlike nil.
+		pw.frameLengths = append(make([]int, 0, len(frameLengths)), frameLengths...)
+	}
+	if pw.skip {
+		return pw, nil
+	}
+	if pw.counter != nil {
+		pw.start = pw.counter.n
+	}
+	encodeElementHeader(pw.e, dicomtag.PixelData, "OB", element.VLUndefinedLength, pw.options)
+	if len(frameLengths) > 0 && !pw.options.emptyBasicOffsetTable {
+		writeBasicOffsetTable(pw.e, basicOffsetTable(frameLengths), pw.options)
+	} else {
+		writeBasicOffsetTable(pw.e, nil, pw.options)
+	}
+	if pw.e.Error() != nil {
+		return nil, pw.e.Error()
+	}
+	return pw, nil
+}
+
+// AddFrame adds one frame of encapsulated (compressed) data, which must have
+// the length given to NewEncapsulatedPixelDataWriter, if any. A frame of odd
+// length is padded with a zero byte, unless StrictPadding is used. Once an
+// error is returned, all later calls return the same error.
+func (pw *EncapsulatedPixelDataWriter) AddFrame(data []byte) error {
+	if pw.e.Error() != nil {
+		return pw.e.Error()
+	}
+	if pw.closed {
+		return fmt.Errorf("write.EncapsulatedPixelDataWriter: AddFrame after Close")
+	}
+	if pw.frameLengths != nil {
+		if pw.n >= len(pw.frameLengths) {
+			pw.e.SetErrorf("%v: expect %v frames, but found more", dicomtag.DebugString(dicomtag.PixelData), len(pw.frameLengths))
+			return pw.e.Error()
+		}
+		if len(data) != pw.frameLengths[pw.n] {
+			pw.e.SetErrorf("%v: expect frame %d of %d bytes, but found %d",
+				dicomtag.DebugString(dicomtag.PixelData), pw.n, pw.frameLengths[pw.n], len(data))
+			return pw.e.Error()
+		}
+	}
+	if !pw.skip {
+		writeRawItem(pw.e, data, pw.options)
+	}
+	pw.n++
+	return pw.e.Error()
+}
+
+// Write adds p as one frame, like AddFrame.
+func (pw *EncapsulatedPixelDataWriter) Write(p []byte) (int, error) {
+	if err := pw.AddFrame(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes the empty fragment under TrailingEmptyFragment and the
+// sequence delimiter, and returns the first error encountered. The hook of
+// WithElementHook gets a PixelData element without frames, along with the
+// length of the whole element. Close does not close the ElementWriter.
+func (pw *EncapsulatedPixelDataWriter) Close() error {
+	if pw.closed || pw.e.Error() != nil {
+		return pw.e.Error()
+	}
+	pw.closed = true
+	if pw.frameLengths != nil && pw.n != len(pw.frameLengths) {
+		pw.e.SetErrorf("%v: expect %v frames, but found %v", dicomtag.DebugString(dicomtag.PixelData), len(pw.frameLengths), pw.n)
+		return pw.e.Error()
+	}
+	if pw.skip {
+		return nil
+	}
+	if pw.options.trailingEmptyFragment {
+		writeRawItem(pw.e, nil, pw.options)
+	}
+	encodeElementHeader(pw.e, dicomtag.SequenceDelimitationItem, "" /*not used*/, 0, pw.options)
+	if pw.e.Error() == nil && pw.counter != nil {
+		elem := &element.Element{Tag: dicomtag.PixelData, VR: "OB", Value: []interface{}{element.PixelDataInfo{IsEncapsulated: true}}}
+		pw.options.elementHook(elem, int(pw.counter.n-pw.start))
+	}
+	return pw.e.Error()
+}
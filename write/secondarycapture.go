@@ -0,0 +1,111 @@
+package write
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/dicomuid"
+	"github.com/suyashkumar/dicom/element"
+	"github.com/suyashkumar/dicom/frame"
+)
+
+// NewSecondaryCaptureDataSet returns a Secondary Capture Image (P3.3 A.8.1)
+// of img, with the attributes of the SOP Common, Patient, General Study,
+// General Series, SC Equipment, General Image and Image Pixel modules that the
+// IOD requires, ready to be passed to DataSet. Grayscale images (of
+// color.GrayModel) are stored as 8-bit MONOCHROME2; any other image is stored
+// as 8-bit RGB, with transparent pixels composed over black. The study, series
+// and instance get new UUID-derived UIDs; the Patient module is left empty,
+// for the caller to fill in.
+//
+//  ds, err := write.NewSecondaryCaptureDataSet(img)
+//  err = write.DataSetToFile("sc.dcm", ds)
+func NewSecondaryCaptureDataSet(img image.Image) (*element.DataSet, error) {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, fmt.Errorf("NewSecondaryCaptureDataSet: empty image")
+	}
+	if bounds.Dx() > math.MaxUint16 || bounds.Dy() > math.MaxUint16 {
+		return nil, fmt.Errorf("NewSecondaryCaptureDataSet: %dx%d image is too large", bounds.Dx(), bounds.Dy())
+	}
+	var uids [3]string
+	for i := range uids {
+		uid, err := newUUIDUID()
+		if err != nil {
+			return nil, err
+		}
+		uids[i] = uid
+	}
+	studyInstanceUID, seriesInstanceUID, sopInstanceUID := uids[0], uids[1], uids[2]
+
+	gray := img.ColorModel() == color.GrayModel
+	pixels := make([][]int, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.At(x, y)
+			if gray {
+				pixels = append(pixels, []int{int(color.GrayModel.Convert(c).(color.Gray).Y)})
+				continue
+			}
+			r, g, b, _ := c.RGBA()
+			pixels = append(pixels, []int{int(r >> 8), int(g >> 8), int(b >> 8)})
+		}
+	}
+	pixelData := element.PixelDataInfo{Frames: []frame.Frame{{
+		NativeData: frame.NativeFrame{
+			Data:          pixels,
+			Rows:          bounds.Dy(),
+			Cols:          bounds.Dx(),
+			BitsPerSample: 8,
+		},
+	}}}
+
+	now := time.Now()
+	elems := []*element.Element{
+		element.MustNewElement(dicomtag.TransferSyntaxUID, dicomuid.ExplicitVRLittleEndian),
+		// Secondary Capture Image Storage.
+		element.MustNewElement(dicomtag.SOPClassUID, "1.2.840.10008.5.1.4.1.1.7"),
+		element.MustNewElement(dicomtag.SOPInstanceUID, sopInstanceUID),
+		element.MustNewElement(dicomtag.StudyDate, now.Format("20060102")),
+		element.MustNewElement(dicomtag.StudyTime, now.Format("150405")),
+		element.MustNewElement(dicomtag.AccessionNumber),
+		element.MustNewElement(dicomtag.Modality, "OT"),
+		// Workstation.
+		element.MustNewElement(dicomtag.ConversionType, "WSD"),
+		element.MustNewElement(dicomtag.ReferringPhysicianName),
+		element.MustNewElement(dicomtag.PatientName),
+		element.MustNewElement(dicomtag.PatientID),
+		element.MustNewElement(dicomtag.PatientBirthDate),
+		element.MustNewElement(dicomtag.PatientSex),
+		element.MustNewElement(dicomtag.StudyInstanceUID, studyInstanceUID),
+		element.MustNewElement(dicomtag.SeriesInstanceUID, seriesInstanceUID),
+		element.MustNewElement(dicomtag.StudyID),
+		element.MustNewElement(dicomtag.SeriesNumber, "1"),
+		element.MustNewElement(dicomtag.InstanceNumber, "1"),
+		element.MustNewElement(dicomtag.PatientOrientation),
+	}
+	if gray {
+		elems = append(elems,
+			element.MustNewElement(dicomtag.SamplesPerPixel, uint16(1)),
+			element.MustNewElement(dicomtag.PhotometricInterpretation, "MONOCHROME2"))
+	} else {
+		elems = append(elems,
+			element.MustNewElement(dicomtag.SamplesPerPixel, uint16(3)),
+			element.MustNewElement(dicomtag.PhotometricInterpretation, "RGB"),
+			// Color-by-pixel: R1, G1, B1, R2, ...
+			element.MustNewElement(dicomtag.PlanarConfiguration, uint16(0)))
+	}
+	elems = append(elems,
+		element.MustNewElement(dicomtag.Rows, uint16(bounds.Dy())),
+		element.MustNewElement(dicomtag.Columns, uint16(bounds.Dx())),
+		element.MustNewElement(dicomtag.BitsAllocated, uint16(8)),
+		element.MustNewElement(dicomtag.BitsStored, uint16(8)),
+		element.MustNewElement(dicomtag.HighBit, uint16(7)),
+		element.MustNewElement(dicomtag.PixelRepresentation, uint16(0)),
+		&element.Element{Tag: dicomtag.PixelData, VR: "OB", Value: []interface{}{pixelData}})
+	return &element.DataSet{Elements: elems}, nil
+}
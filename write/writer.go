@@ -1,17 +1,30 @@
 package write
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"math"
+	"math/big"
 	"os"
-
-	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/suyashkumar/dicom/constants"
 	"github.com/suyashkumar/dicom/dicomio"
 	"github.com/suyashkumar/dicom/dicomlog"
 	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/dicomuid"
 	"github.com/suyashkumar/dicom/element"
 )
 
@@ -23,9 +36,425 @@ var SkipVRVerification Option = func(o *optSet) {
 	o.skipVRVerification = true
 }
 
+// WithTransferSyntax makes DataSet encode the file with the given transfer
+// syntax, overriding the TransferSyntaxUID element of the dataset. DataSet
+// returns an error if uid is not a known transfer syntax.
+func WithTransferSyntax(uid string) Option {
+	return func(o *optSet) {
+		o.transferSyntaxUID = uid
+	}
+}
+
+// WithTransferSyntaxLabel makes DataSet and ElementWriter write uid as the
+// TransferSyntaxUID element of the meta group, while the elements are still
+// encoded with the transfer syntax of the dataset or WithTransferSyntax, e.g.,
+// to relabel files whose header names the wrong transfer syntax. It returns an
+// error if uid is not a transfer syntax of the DICOM standard.
+//
+// DANGER: Readers decode the elements with the transfer syntax in the header,
+// so it must describe how they were actually encoded.
+func WithTransferSyntaxLabel(uid string) Option {
+	return func(o *optSet) {
+		o.transferSyntaxLabel = uid
+	}
+}
+
+// ForceImplicitVR makes DataSet encode the file in Implicit VR Little Endian,
+// regardless of the TransferSyntaxUID element of the dataset. It is a shorthand
+// for WithTransferSyntax(dicomuid.ImplicitVRLittleEndian).
+var ForceImplicitVR Option = WithTransferSyntax(dicomuid.ImplicitVRLittleEndian)
+
+// StrictPadding makes encoding fail on values of odd length instead of padding
+// them to even length. Use it to catch upstream bugs that produce odd-length
+// values.
+var StrictPadding Option = func(o *optSet) {
+	o.strictPadding = true
+}
+
+// StrictValues makes encoding fail on string values that don't follow the
+// format of their VR, e.g., an AS value other than three digits and a unit, a
+// DA value other than YYYYMMDD, or a UI value other than digits and dots up to
+// 64 characters, instead of normalizing them where possible (UI values are
+// truncated) or writing them as is.
+var StrictValues Option = func(o *optSet) {
+	o.strictValues = true
+}
+
+// WithMaxElementLength makes encoding fail on any element whose value length
+// exceeds n bytes, so that a corrupt in-memory dataset can't produce a huge
+// file. Elements of undefined length are checked item by item. n == 0 means no
+// limit.
+func WithMaxElementLength(n uint32) Option {
+	return func(o *optSet) {
+		o.maxElementLength = n
+	}
+}
+
+// WithoutPreamble makes encoding skip the 128-byte preamble and the "DICM"
+// magic, so that the output starts with the meta group, for protocols that
+// forbid the preamble.
+var WithoutPreamble Option = func(o *optSet) {
+	o.withoutPreamble = true
+}
+
+// OmitMetaGroup makes encoding leave out the file meta information group
+// (group 0002) along with the preamble, so that only the dataset proper is
+// written.
+var OmitMetaGroup Option = func(o *optSet) {
+	o.omitMetaGroup = true
+}
+
+// WithDefaultCharset makes encoding convert strings into the given DICOM
+// character set, such as "ISO_IR 100", until a SpecificCharacterSet element
+// is written. The option doesn't add a SpecificCharacterSet element, so the
+// reader of the file must know the character set by other means. Without it,
+// strings are converted into the character set in the SpecificCharacterSet
+// element of the dataset, or written as is if there is none.
+func WithDefaultCharset(encodingNames ...string) Option {
+	return func(o *optSet) {
+		o.defaultCharset = encodingNames
+	}
+}
+
+// defaultMaxSequenceDepth is the limit of WithMaxSequenceDepth unless given.
+const defaultMaxSequenceDepth = 100
+
+// defaultBufferSize is the size of the output buffer unless WithBufferSize is
+// given.
+const defaultBufferSize = 32 << 10
+
+// WithMaxSequenceDepth makes encoding fail on sequence items nested more than
+// n levels deep, so that a corrupt in-memory dataset, e.g., a sequence that
+// contains itself, can't recurse forever. n <= 0 means the default of 100.
+func WithMaxSequenceDepth(n int) Option {
+	return func(o *optSet) {
+		o.maxSequenceDepth = n
+	}
+}
+
+// WithDefaultMeta makes DataSet synthesize the meta group of a dataset that has
+// no meta elements at all, instead of failing: the transfer syntax is
+// Explicit VR Little Endian (or the one of WithTransferSyntax), and
+// MediaStorageSOPClassUID and MediaStorageSOPInstanceUID are taken from
+// SOPClassUID and SOPInstanceUID, or else default to Secondary Capture Image
+// Storage and a new UUID-derived UID (P3.5 B.2).
+var WithDefaultMeta Option = func(o *optSet) {
+	o.defaultMeta = true
+}
+
+// EmptyBasicOffsetTable makes encoding write an empty Basic Offset Table for
+// encapsulated pixel data, for receivers that don't need random access to
+// frames. It is implied by the MPEG2, MPEG-4 and HEVC transfer syntaxes.
+var EmptyBasicOffsetTable Option = func(o *optSet) {
+	o.emptyBasicOffsetTable = true
+}
+
+// TrailingEmptyFragment makes encoding write a zero-length fragment after the
+// frames of encapsulated pixel data, before the sequence delimiter, as some
+// modalities do, so that their files can be reproduced byte for byte.
+var TrailingEmptyFragment Option = func(o *optSet) {
+	o.trailingEmptyFragment = true
+}
+
+// WithImplementationClassUID makes FileHeader write uid as the
+// ImplementationClassUID, in place of the one in the dataset or the library
+// default. FileHeader fails if uid is malformed.
+func WithImplementationClassUID(uid string) Option {
+	return func(o *optSet) {
+		o.implementationClassUID = uid
+	}
+}
+
+// WithImplementationVersionName makes FileHeader write name as the
+// ImplementationVersionName, in place of the one in the dataset or the library
+// default. FileHeader fails if name is longer than 16 characters.
+func WithImplementationVersionName(name string) Option {
+	return func(o *optSet) {
+		o.implementationVersionName = name
+	}
+}
+
+// WithValidation makes DataSet check the dataset with DataSet.Validate
+// before writing anything, and fail if it finds any issue.
+var WithValidation Option = func(o *optSet) {
+	o.validate = true
+}
+
+// WithExplicitSequenceLength makes encoding write sequences and items with
+// their length in the VL field, even if their UndefinedLength is set, for
+// readers that don't handle delimitation items.
+var WithExplicitSequenceLength Option = func(o *optSet) {
+	o.explicitSequenceLength = true
+}
+
+// KeepElementOrder makes DataSet write the elements in the order of
+// ds.Elements. By default, they are sorted by tag, as the DICOM standard
+// requires (P3.5 7.1).
+var KeepElementOrder Option = func(o *optSet) {
+	o.keepElementOrder = true
+}
+
+// WithGroupLengths makes DataSet recompute the value of each group length
+// element (gggg,0000) in the dataset from the elements that follow it in its
+// group, so that stale lengths aren't written. Groups without one don't get
+// one. The meta group length (0002,0000) is always computed.
+var WithGroupLengths Option = func(o *optSet) {
+	o.groupLengths = recomputeGroupLengths
+}
+
+// WithoutGroupLengths makes DataSet drop all group length elements outside
+// the meta group, as the DICOM standard retired them (P3.5 7.2).
+var WithoutGroupLengths Option = func(o *optSet) {
+	o.groupLengths = stripGroupLengths
+}
+
+// CoerceVR makes encoding write an element whose VR the DICOM standard doesn't
+// allow for its tag with the VR of the dictionary instead, converting its
+// numeric values to the Go type of that VR, e.g., uint16 values of an element
+// mislabeled as "SS" are written as US. Values that can't be converted, or are
+// out of range, are an error. Without CoerceVR, such an element is written
+// with its own VR if both VRs have the same Go type, and is a VRMismatchError
+// otherwise. SkipVRVerification takes precedence.
+var CoerceVR Option = func(o *optSet) {
+	o.coerceVR = true
+}
+
+// WithLegacyVRs makes encoding write, as they are, elements of legacy files
+// whose VR would otherwise be a VRMismatchError: elements holding a single
+// []byte value under a VR other than the dictionary one, e.g., UN or OB for a
+// PN element, and meta elements with a nonstandard VR. The bytes are written
+// verbatim, padded with a zero byte to an even length, even under a string VR
+// that expects string values. Unlike under SkipVRVerification, other
+// mismatches are still errors.
+var WithLegacyVRs Option = func(o *optSet) {
+	o.legacyVRs = true
+}
+
+// WithFaithfulCopy makes encoding write the elements that have RawBytes, as
+// kept by the parser with ParseOptions.KeepRawBytes, as those bytes instead of
+// re-encoding them, so that a file that is read and written back with
+// KeepElementOrder is reproduced bit for bit, nonstandard padding and number
+// formatting included. The bytes are used only if they still hold the tag and
+// VR of the element, and its normal encoding, which passes the usual checks,
+// still has the Element.RawDigest recorded by the parser; otherwise, e.g.,
+// once its value is modified, the element is encoded as usual. It has no effect
+// on elements written with another transfer syntax than the one they were
+// read with, i.e., when WithTransferSyntax changes it.
+var WithFaithfulCopy Option = func(o *optSet) {
+	o.faithfulCopy = true
+}
+
+// WithPixelByteSwap sets whether the 16-bit words of OW PixelData given as
+// raw bytes, in a PixelDataStream or a LazyValue, are byte-swapped as they are
+// written. By default, these bytes are taken to be in the byte order of the
+// TransferSyntaxUID of the dataset or meta elements, and are swapped iff
+// WithTransferSyntax changes the byte order, e.g., when transcoding from
+// Explicit VR Little Endian to Explicit VR Big Endian. WithPixelByteSwap(true)
+// swaps them regardless, e.g., for bytes known to be in the other byte order,
+// and WithPixelByteSwap(false) never does. Samples of native frames are always
+// encoded in the byte order of the transfer syntax.
+func WithPixelByteSwap(swap bool) Option {
+	return func(o *optSet) {
+		if swap {
+			o.pixelByteSwap = swapPixelBytes
+		} else {
+			o.pixelByteSwap = keepPixelBytes
+		}
+	}
+}
+
+// WithUNResolution makes encoding write a UN element with the VR that
+// resolve returns for its tag, e.g., to restore the VRs of private elements
+// read from an implicit VR file for a PACS that rejects UN. The raw bytes of
+// the value are reinterpreted as values of that VR, assuming little endian
+// byte order, as in implicit VR files. Elements for which resolve returns ""
+// or "UN", and UN sequences of undefined length, are written as they are.
+func WithUNResolution(resolve func(tag dicomtag.Tag) string) Option {
+	return func(o *optSet) {
+		o.unResolution = resolve
+	}
+}
+
+// WithoutPixelData makes encoding leave out PixelData, including its
+// fragments, e.g., for metadata-only copies of a study. Like WithTagFilter, it
+// applies to sequence items, too, and group lengths computed under
+// WithGroupLengths don't count the element.
+var WithoutPixelData Option = func(o *optSet) {
+	o.withoutPixelData = true
+}
+
+// WithTagFilter makes encoding write only the elements whose tag satisfies
+// keep, e.g., to drop private elements without modifying the dataset. It
+// applies to elements in sequence items, too, but not to the meta group, which
+// is always written.
+func WithTagFilter(keep func(tag dicomtag.Tag) bool) Option {
+	return func(o *optSet) {
+		o.tagFilter = keep
+	}
+}
+
+// WithRawVL makes encoding write vl as the value length of every element with
+// the given tag, whatever the length of the value that follows, e.g., to
+// reproduce files of a buggy producer when testing readers.
+//
+// DANGER: This skips all checks on the VL, and the output is most likely
+// malformed; readers may misinterpret everything after the element. Never use
+// it for files meant to be read.
+func WithRawVL(tag dicomtag.Tag, vl uint32) Option {
+	return func(o *optSet) {
+		if o.rawVLs == nil {
+			o.rawVLs = map[dicomtag.Tag]uint32{}
+		}
+		o.rawVLs[tag] = vl
+	}
+}
+
+// WithBufferSize sets the size of the buffer that DataSet and ElementWriter
+// write the output through, flushed by ElementWriter.Close, instead of 32KiB.
+// With n <= 0, every element is written to out as soon as it's encoded, e.g.,
+// when out is buffered already.
+func WithBufferSize(n int) Option {
+	return func(o *optSet) {
+		o.bufferSize = n
+		if n <= 0 {
+			o.bufferSize = -1
+		}
+	}
+}
+
+// WithHash makes DataSet and ElementWriter also write every byte of the
+// output to h, e.g., to get a checksum of the file without reading it back:
+//
+//  h := sha256.New()
+//  err := write.DataSet(out, ds, write.WithHash(h))
+//  sum := h.Sum(nil)
+func WithHash(h hash.Hash) Option {
+	return func(o *optSet) {
+		o.hash = h
+	}
+}
+
+// WithElementHook makes DataSet and ElementWriter call hook after writing each
+// element outside the meta group, with the number of bytes it took, header
+// included, before any deflate compression; e.g., to find which elements
+// dominate the size of a file. Elements nested in sequences are counted as
+// part of their sequence.
+func WithElementHook(hook func(elem *element.Element, bytesWritten int)) Option {
+	return func(o *optSet) {
+		o.elementHook = hook
+	}
+}
+
+// withContext makes encoding stop with ctx.Err() between pixel data frames
+// once ctx is done.
+func withContext(ctx context.Context) Option {
+	return func(o *optSet) {
+		o.ctx = ctx
+	}
+}
+
+// filteredOut reports whether WithTagFilter or WithoutPixelData excludes tag.
+func filteredOut(tag dicomtag.Tag, options optSet) bool {
+	if options.withoutPixelData && tag == dicomtag.PixelData {
+		return true
+	}
+	return options.tagFilter != nil && !options.tagFilter(tag)
+}
+
+// tooDeep reports whether the item being encoded is nested deeper than
+// WithMaxSequenceDepth allows.
+func tooDeep(options optSet) bool {
+	max := options.maxSequenceDepth
+	if max <= 0 {
+		max = defaultMaxSequenceDepth
+	}
+	return options.depth > max
+}
+
+// canceled reports whether the context in options is done, setting its error
+// in e if so.
+func canceled(e *dicomio.Encoder, options optSet) bool {
+	if options.ctx == nil || options.ctx.Err() == nil {
+		return false
+	}
+	e.SetError(options.ctx.Err())
+	return true
+}
+
+type groupLengthMode int
+
+const (
+	keepGroupLengths groupLengthMode = iota
+	recomputeGroupLengths
+	stripGroupLengths
+)
+
+type pixelByteSwapMode int
+
+const (
+	autoPixelByteSwap pixelByteSwapMode = iota
+	swapPixelBytes
+	keepPixelBytes
+)
+
 // optSet is the struct type used to receive provided options
 type optSet struct {
-	skipVRVerification bool
+	skipVRVerification        bool
+	strictPadding             bool
+	strictValues              bool
+	transferSyntaxUID         string
+	transferSyntaxLabel       string
+	maxElementLength          uint32
+	maxSequenceDepth          int
+	withoutPreamble           bool
+	omitMetaGroup             bool
+	defaultMeta               bool
+	emptyBasicOffsetTable     bool
+	trailingEmptyFragment     bool
+	defaultCharset            []string
+	validate                  bool
+	explicitSequenceLength    bool
+	keepElementOrder          bool
+	implementationClassUID    string
+	implementationVersionName string
+	groupLengths              groupLengthMode
+	tagFilter                 func(tag dicomtag.Tag) bool
+	withoutPixelData          bool
+	rawVLs                    map[dicomtag.Tag]uint32
+	coerceVR                  bool
+	legacyVRs                 bool
+	faithfulCopy              bool
+	pixelByteSwap             pixelByteSwapMode
+	unResolution              func(tag dicomtag.Tag) string
+	hash                      hash.Hash
+	bufferSize                int
+	elementHook               func(elem *element.Element, bytesWritten int)
+	// Set by DataSetWithContext. Checked between elements and frames.
+	ctx context.Context
+	// Number of items enclosing the element being encoded.
+	depth int
+}
+
+// ErrorUnimplemented is wrapped by the errors reported for elements that are
+// valid, but that encoding doesn't support yet, e.g., native pixel data of 12
+// bits per sample. The error names the element and the missing feature; test
+// for it with errors.Is.
+var ErrorUnimplemented = errors.New("not implemented")
+
+// VRMismatchError is reported when an element's VR is not one the DICOM
+// standard allows for its tag, and the two VRs are represented by different Go
+// types. Such elements can still be written with SkipVRVerification.
+type VRMismatchError struct {
+	Tag dicomtag.Tag
+	// VR of the element being written.
+	VR string
+	// VR defined for Tag by the DICOM standard.
+	DictionaryVR string
+}
+
+func (e *VRMismatchError) Error() string {
+	return fmt.Sprintf("dicom.Element: VR value mismatch for tag %s. Element.VR=%v, but DICOM standard defines VR to be %v",
+		dicomtag.DebugString(e.Tag), e.VR, e.DictionaryVR)
 }
 
 // optsIntoOptSet creates an optSet from an Option slice
@@ -42,7 +471,9 @@ func optsIntoOptSet(opts ...Option) optSet {
 // must have Tag.Group==2. It must contain at least the following three
 // elements: TagTransferSyntaxUID, TagMediaStorageSOPClassUID,
 // TagMediaStorageSOPInstanceUID. The list may contain other meta elements as
-// long as their Tag.Group==2; they are added to the header.
+// long as their Tag.Group==2; they are added to the header. A missing
+// FileMetaInformationVersion defaults to the two bytes 00H 01H. The 128-byte
+// preamble and "DICM" magic are left out under WithoutPreamble.
 //
 // Errors are reported via e.Error().
 //
@@ -72,12 +503,29 @@ func FileHeader(e *dicomio.Encoder, metaElems []*element.Element, opts ...Option
 		}
 		tagsUsed[tag] = true
 	}
-	writeOptionalMetaElem(dicomtag.FileMetaInformationVersion, []byte("0 1"))
+	writeOptionalMetaElem(dicomtag.FileMetaInformationVersion, []byte{0x00, 0x01})
 	writeRequiredMetaElem(dicomtag.MediaStorageSOPClassUID)
 	writeRequiredMetaElem(dicomtag.MediaStorageSOPInstanceUID)
 	writeRequiredMetaElem(dicomtag.TransferSyntaxUID)
-	writeOptionalMetaElem(dicomtag.ImplementationClassUID, constants.GoDICOMImplementationClassUID)
-	writeOptionalMetaElem(dicomtag.ImplementationVersionName, constants.GoDICOMImplementationVersionName)
+	options := optsIntoOptSet(opts...)
+	if uid := options.implementationClassUID; uid != "" {
+		if err := dicomuid.Validate(uid); err != nil {
+			subEncoder.SetErrorf("%v: %v", dicomtag.DebugString(dicomtag.ImplementationClassUID), err)
+		}
+		Element(subEncoder, element.MustNewElement(dicomtag.ImplementationClassUID, uid), opts...)
+		tagsUsed[dicomtag.ImplementationClassUID] = true
+	} else {
+		writeOptionalMetaElem(dicomtag.ImplementationClassUID, constants.GoDICOMImplementationClassUID)
+	}
+	if name := options.implementationVersionName; name != "" {
+		if len(name) > 16 {
+			subEncoder.SetErrorf("%v: '%v' is longer than 16 characters", dicomtag.DebugString(dicomtag.ImplementationVersionName), name)
+		}
+		Element(subEncoder, element.MustNewElement(dicomtag.ImplementationVersionName, name), opts...)
+		tagsUsed[dicomtag.ImplementationVersionName] = true
+	} else {
+		writeOptionalMetaElem(dicomtag.ImplementationVersionName, constants.GoDICOMImplementationVersionName)
+	}
 	for _, elem := range metaElems {
 		if elem.Tag.Group == dicomtag.MetadataGroup {
 			if _, ok := tagsUsed[elem.Tag]; !ok {
@@ -90,191 +538,981 @@ func FileHeader(e *dicomio.Encoder, metaElems []*element.Element, opts ...Option
 		return
 	}
 	metaBytes := subEncoder.Bytes()
-	e.WriteZeros(128)
-	e.WriteString("DICM")
+	if !options.withoutPreamble {
+		e.WriteZeros(128)
+		e.WriteString("DICM")
+	}
 	Element(e, element.MustNewElement(dicomtag.FileMetaInformationGroupLength, uint32(len(metaBytes))), opts...)
 	e.WriteBytes(metaBytes)
 }
 
-func encodeElementHeader(e *dicomio.Encoder, tag dicomtag.Tag, vr string, vl uint32) {
-	doassert(vl == element.VLUndefinedLength || vl%2 == 0, vl)
-	e.WriteUInt16(tag.Group)
-	e.WriteUInt16(tag.Element)
-
+// encodeElementHeader writes the tag, VR and VL of an element. A malformed
+// header (odd VL, bad VR, VL too large for the VR or options) is reported
+// through e.Error() and nothing is written. encodeElementHeader returns false
+// iff it reported an error.
+func encodeElementHeader(e *dicomio.Encoder, tag dicomtag.Tag, vr string, vl uint32, options optSet) bool {
+	if rawVL, ok := options.rawVLs[tag]; ok {
+		// Skip the checks below, even on the original VL.
+		writeElementHeader(e, tag, vr, rawVL)
+		return true
+	}
+	if vl != element.VLUndefinedLength && vl%2 != 0 {
+		e.SetErrorf("%v: value length must be even, but found %v", dicomtag.DebugString(tag), vl)
+		return false
+	}
+	if vl != element.VLUndefinedLength && options.maxElementLength > 0 && vl > options.maxElementLength {
+		e.SetErrorf("%v: value length %v exceeds the limit of %v", dicomtag.DebugString(tag), vl, options.maxElementLength)
+		return false
+	}
+	switch tag {
+	case dicomtag.Item:
+	case dicomtag.ItemDelimitationItem, dicomtag.SequenceDelimitationItem:
+		// Unlike an item, delimitation items never have a value (P3.5 7.5).
+		if vl != 0 {
+			e.SetErrorf("%v: value length must be 0, but found %v", dicomtag.DebugString(tag), vl)
+			return false
+		}
+	default:
+		if tag.Group == dicomtag.GROUP_ItemSeq {
+			e.SetErrorf("%v: not an item or delimitation item", dicomtag.DebugString(tag))
+			return false
+		}
+	}
 	_, implicit := e.TransferSyntax()
-	if tag.Group == dicomtag.GROUP_ItemSeq {
-		implicit = dicomio.ImplicitVR
+	// Item and delimitation items (FFFE,E000/E00D/E0DD) have no VR and a
+	// 32-bit VL in every transfer syntax (P3.5 7.5). Only their byte order
+	// follows the transfer syntax.
+	hasVR := implicit == dicomio.ExplicitVR && tag.Group != dicomtag.GROUP_ItemSeq
+	if hasVR && len(vr) != 2 {
+		e.SetErrorf("%v: VR must be two characters, but found '%v'", dicomtag.DebugString(tag), vr)
+		return false
+	}
+	if hasVR && !isLongVLVR(vr) && vl > 0xffff {
+		e.SetErrorf("%v: value length %v does not fit in the 16-bit length field of VR %v",
+			dicomtag.DebugString(tag), vl, vr)
+		return false
 	}
-	if implicit == dicomio.ExplicitVR {
-		doassert(len(vr) == 2, vr)
+	writeElementHeader(e, tag, vr, vl)
+	return true
+}
+
+// writeElementHeader writes the tag, VR and VL of an element, without any
+// checks. A VL that doesn't fit in 16 bits is truncated for short VRs.
+func writeElementHeader(e *dicomio.Encoder, tag dicomtag.Tag, vr string, vl uint32) {
+	_, implicit := e.TransferSyntax()
+	hasVR := implicit == dicomio.ExplicitVR && tag.Group != dicomtag.GROUP_ItemSeq
+	e.WriteUInt16(tag.Group)
+	e.WriteUInt16(tag.Element)
+	if hasVR {
 		e.WriteString(vr)
-		switch vr {
-		case "NA", "OB", "OD", "OF", "OL", "OW", "SQ", "UN", "UC", "UR", "UT":
+		if isLongVLVR(vr) {
 			e.WriteZeros(2) // two bytes for "future use" (0000H)
 			e.WriteUInt32(vl)
-		default:
+		} else {
 			e.WriteUInt16(uint16(vl))
 		}
 	} else {
-		doassert(implicit == dicomio.ImplicitVR, implicit)
+		doassert(implicit == dicomio.ImplicitVR || tag.Group == dicomtag.GROUP_ItemSeq, implicit)
 		e.WriteUInt32(vl)
 	}
 }
 
-func writeRawItem(e *dicomio.Encoder, data []byte) {
-	encodeElementHeader(e, dicomtag.Item, "NA", uint32(len(data)))
+// isLongVLVR reports whether elements of vr have a 32-bit VL in explicit VR
+// transfer syntaxes (P3.5 7.1.2).
+func isLongVLVR(vr string) bool {
+	switch vr {
+	case "NA", "OB", "OD", "OF", "OL", "OW", "SQ", "UN", "UC", "UR", "UT":
+		return true
+	}
+	return false
+}
+
+// writePadding writes pad if length is odd, as values must have an even length
+// (P3.5 7.1.1). Under StrictPadding, an odd length is reported as an error
+// instead. writePadding returns false iff it reported an error.
+func writePadding(e *dicomio.Encoder, tag dicomtag.Tag, length int, pad byte, options optSet) bool {
+	if length%2 == 0 {
+		return true
+	}
+	if options.strictPadding {
+		e.SetErrorf("%v: value length must be even, but found %v", dicomtag.DebugString(tag), length)
+		return false
+	}
+	e.WriteByte(pad)
+	return true
+}
+
+// bufferPool holds the buffers of sub-encoders, so that encoding an element
+// doesn't allocate a new one.
+var bufferPool = sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
+
+// Buffers that grew larger than this, e.g., for a big sequence, are left to
+// the garbage collector rather than kept in bufferPool.
+const maxPooledBufferSize = 64 << 10
+
+// newSubEncoder returns an in-memory Encoder with the transfer syntax and
+// character set of e, to measure the length of nested elements, and its
+// buffer. Once done with the encoded bytes, pass the buffer to putBuffer.
+func newSubEncoder(e *dicomio.Encoder) (*dicomio.Encoder, *bytes.Buffer) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	bo, implicit := e.TransferSyntax()
+	sube := dicomio.NewEncoder(buf, bo, implicit)
+	sube.SetCharset(e.Charset())
+	return sube, buf
+}
+
+// putBuffer returns a buffer obtained from newSubEncoder to bufferPool.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// writeRawItem writes data as the payload of an Item, padding it with a zero
+// byte if needed.
+func writeRawItem(e *dicomio.Encoder, data []byte, options optSet) {
+	if int64(len(data)) >= int64(element.VLUndefinedLength) {
+		e.SetErrorf("%v: fragment of %v bytes does not fit in a 32-bit length", dicomtag.DebugString(dicomtag.Item), len(data))
+		return
+	}
+	if len(data)%2 != 0 && options.strictPadding {
+		writePadding(e, dicomtag.Item, len(data), 0, options)
+		return
+	}
+	if !encodeElementHeader(e, dicomtag.Item, "NA", uint32(len(data)+len(data)%2), options) {
+		return
+	}
 	e.WriteBytes(data)
+	writePadding(e, dicomtag.Item, len(data), 0, options)
 }
 
-func writeBasicOffsetTable(e *dicomio.Encoder, offsets []uint32) {
+// basicOffsetTable returns the Basic Offset Table entries for frames made of
+// a single fragment each, given the fragment lengths: the offset of each
+// fragment's Item tag from the first fragment's one (P3.5 A.4).
+func basicOffsetTable(fragmentLengths []int) []uint32 {
+	var offsets []uint32
+	offset := uint32(0)
+	for _, length := range fragmentLengths {
+		offsets = append(offsets, offset)
+		offset += 8 /*item tag and length*/ + uint32(length+length%2)
+	}
+	return offsets
+}
+
+func writeBasicOffsetTable(e *dicomio.Encoder, offsets []uint32, options optSet) {
 	byteOrder, _ := e.TransferSyntax()
 	subEncoder := dicomio.NewBytesEncoder(byteOrder, dicomio.ImplicitVR)
 	for _, offset := range offsets {
 		subEncoder.WriteUInt32(offset)
 	}
-	writeRawItem(e, subEncoder.Bytes())
+	writeRawItem(e, subEncoder.Bytes(), options)
+}
+
+// writeNativePixelData encodes PixelData with a defined length, as per P3.5
+// A.4. Every frame in image.Frames must be a NativeFrame with the same
+// dimensions. Samples are encoded in the byte order of e, and the value is
+// padded with a zero byte if needed to make its length even.
+func writeNativePixelData(e *dicomio.Encoder, tag dicomtag.Tag, vr string, image element.PixelDataInfo, options optSet) {
+	if len(image.Frames) == 0 {
+		encodeElementHeader(e, tag, vr, 0, options)
+		return
+	}
+	first := image.Frames[0].NativeData
+	if first.BitsPerSample != 8 && first.BitsPerSample != 16 {
+		e.SetErrorf("%v: native pixel data of BitsPerSample %v: %w", dicomtag.DebugString(tag), first.BitsPerSample, ErrorUnimplemented)
+		return
+	}
+	numValues := 1
+	if len(first.Data) > 0 {
+		numValues = len(first.Data[0])
+	}
+	length := 0
+	for i, frame := range image.Frames {
+		if frame.Encapsulated || frame.NativeData.BitsPerSample != first.BitsPerSample {
+			e.SetErrorf("%v: frame %d does not match the format of frame 0", dicomtag.DebugString(tag), i)
+			return
+		}
+		length += len(frame.NativeData.Data) * numValues * first.BitsPerSample / 8
+	}
+	if length%2 != 0 && options.strictPadding {
+		writePadding(e, tag, length, 0, options)
+		return
+	}
+	if !encodeElementHeader(e, tag, vr, uint32(length+length%2), options) {
+		return
+	}
+	for i, frame := range image.Frames {
+		if canceled(e, options) {
+			return
+		}
+		for _, pixel := range frame.NativeData.Data {
+			if len(pixel) != numValues {
+				e.SetErrorf("%v: frame %d: expect %d samples per pixel, but found %d",
+					dicomtag.DebugString(tag), i, numValues, len(pixel))
+				return
+			}
+			for _, value := range pixel {
+				if first.BitsPerSample == 8 {
+					e.WriteByte(uint8(value))
+				} else {
+					e.WriteUInt16(uint16(value))
+				}
+			}
+		}
+	}
+	writePadding(e, tag, length, 0, options)
+}
+
+// writePixelDataStream encodes native PixelData whose frames are copied from
+// stream.Frames as they are written, so no frame has to be held in memory.
+// Like writeNativePixelData, the value is padded to an even length.
+func writePixelDataStream(e *dicomio.Encoder, tag dicomtag.Tag, vr string, stream element.PixelDataStream, options optSet) {
+	if stream.FrameLength < 0 {
+		e.SetErrorf("%v: negative FrameLength %d", dicomtag.DebugString(tag), stream.FrameLength)
+		return
+	}
+	swap := swapsPixelWords(tag, vr, options)
+	if swap && stream.FrameLength%2 != 0 {
+		e.SetErrorf("%v: can't swap the words of frames of odd length %d", dicomtag.DebugString(tag), stream.FrameLength)
+		return
+	}
+	length := stream.FrameLength * len(stream.Frames)
+	if length%2 != 0 && options.strictPadding {
+		writePadding(e, tag, length, 0, options)
+		return
+	}
+	if !encodeElementHeader(e, tag, vr, uint32(length+length%2), options) {
+		return
+	}
+	for _, r := range stream.Frames {
+		if canceled(e, options) {
+			return
+		}
+		if swap {
+			r = &wordSwapReader{r: r}
+		}
+		e.WriteFrom(r, int64(stream.FrameLength))
+		if e.Error() != nil {
+			return
+		}
+	}
+	writePadding(e, tag, length, 0, options)
+}
+
+// swapsPixelWords reports whether the raw bytes of a PixelData value with the
+// given VR are byte-swapped as they are written. See WithPixelByteSwap.
+func swapsPixelWords(tag dicomtag.Tag, vr string, options optSet) bool {
+	return tag == dicomtag.PixelData && vr == "OW" && options.pixelByteSwap == swapPixelBytes
+}
+
+// wordSwapReader swaps the bytes of each 16-bit word read from r. A final odd
+// byte is returned as is.
+type wordSwapReader struct {
+	r     io.Reader
+	chunk [4096]byte
+	// Swapped bytes not returned yet, and the error that ended them.
+	swapped []byte
+	err     error
+}
+
+func (s *wordSwapReader) Read(p []byte) (int, error) {
+	if len(s.swapped) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		n, err := io.ReadFull(s.r, s.chunk[:])
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		for i := 0; i+1 < n; i += 2 {
+			s.chunk[i], s.chunk[i+1] = s.chunk[i+1], s.chunk[i]
+		}
+		s.swapped, s.err = s.chunk[:n], err
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, s.swapped)
+	s.swapped = s.swapped[n:]
+	return n, nil
+}
+
+// writeLazyValue writes an element whose value is read from lazy, without
+// holding it in memory, padded with a zero byte if needed.
+func writeLazyValue(e *dicomio.Encoder, tag dicomtag.Tag, vr string, lazy element.LazyValue, options optSet) {
+	length := lazy.Len()
+	if length < 0 || length >= int64(element.VLUndefinedLength) {
+		e.SetErrorf("%v: LazyValue of %d bytes does not fit in a 32-bit length", dicomtag.DebugString(tag), length)
+		return
+	}
+	if length%2 != 0 && options.strictPadding {
+		writePadding(e, tag, int(length), 0, options)
+		return
+	}
+	if !encodeElementHeader(e, tag, vr, uint32(length+length%2), options) {
+		return
+	}
+	if length == 0 {
+		return
+	}
+	r, err := lazy.Open()
+	if err != nil {
+		e.SetErrorf("%v: %v", dicomtag.DebugString(tag), err)
+		return
+	}
+	if swapsPixelWords(tag, vr, options) {
+		r = &wordSwapReader{r: r}
+	}
+	e.WriteFrom(r, length)
+	writePadding(e, tag, int(length), 0, options)
+}
+
+// formatNumber formats a Go integer or float as a value of VR DS or IS, as
+// per P3.5 6.2. A DS value is shortened to at most 16 characters by
+// rounding, and an IS value must fit in 32 bits.
+func formatNumber(vr string, value interface{}) (string, error) {
+	var n int64
+	switch v := value.(type) {
+	case int:
+		n = int64(v)
+	case int8:
+		n = int64(v)
+	case int16:
+		n = int64(v)
+	case int32:
+		n = int64(v)
+	case int64:
+		n = v
+	case uint8:
+		n = int64(v)
+	case uint16:
+		n = int64(v)
+	case uint32:
+		n = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return formatDecimal(float64(v))
+		}
+		n = int64(v)
+	case float32:
+		if vr == "DS" {
+			return formatDecimal(float64(v))
+		}
+		return "", fmt.Errorf("float value %v for VR IS", v)
+	case float64:
+		if vr == "DS" {
+			return formatDecimal(v)
+		}
+		return "", fmt.Errorf("float value %v for VR IS", v)
+	default:
+		return "", fmt.Errorf("value %v of type %T for VR %v", value, value, vr)
+	}
+	if vr == "IS" && (n < math.MinInt32 || n > math.MaxInt32) {
+		return "", fmt.Errorf("value %d out of range for VR IS", n)
+	}
+	if s := strconv.FormatInt(n, 10); len(s) <= 16 {
+		return s, nil
+	}
+	return formatDecimal(float64(n))
+}
+
+// formatDecimal formats v in the shortest representation that reads back as
+// v, or, if that's longer than the 16 characters a DS value may have, rounded
+// to the most significant digits that fit.
+func formatDecimal(v float64) (string, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", fmt.Errorf("value %v can't be represented in VR DS", v)
+	}
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	for prec := 16; len(s) > 16; prec-- {
+		s = strconv.FormatFloat(v, 'g', prec, 64)
+	}
+	return s, nil
+}
+
+// formatAge checks an AS value: three digits followed by D, W, M or Y, e.g.,
+// "045Y" (P3.5 6.2). Unless strict, a value with fewer digits or a lowercase
+// unit is normalized, and other malformed values are returned as is.
+func formatAge(s string, strict bool) (string, error) {
+	isAge := func(s string) bool {
+		if len(s) != 4 || !strings.ContainsAny(s[3:], "DWMY") {
+			return false
+		}
+		for _, c := range s[:3] {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+		return true
+	}
+	if s == "" || isAge(s) {
+		return s, nil
+	}
+	if strict {
+		return "", fmt.Errorf("AS value must be three digits and one of D, W, M or Y, but found '%v'", s)
+	}
+	trimmed := strings.TrimSpace(s)
+	if len(trimmed) >= 2 && len(trimmed) <= 4 {
+		if normalized := strings.Repeat("0", 4-len(trimmed)) + strings.ToUpper(trimmed); isAge(normalized) {
+			return normalized, nil
+		}
+	}
+	return s, nil
+}
+
+// formatUID checks a UI value: at most 64 characters, made of digits and dots
+// (P3.5 9.1). Unless strict, a malformed value is logged, and written
+// truncated to 64 characters if longer.
+func formatUID(s string, strict bool) (string, error) {
+	uid := strings.TrimRight(s, "\x00 ")
+	if uid == "" {
+		return s, nil
+	}
+	err := dicomuid.Validate(uid)
+	if err == nil {
+		return s, nil
+	}
+	if strict {
+		return "", err
+	}
+	if len(uid) > 64 {
+		dicomlog.Vprintf(1, "dicom.Element: %v, truncating to 64 characters", err)
+		return strings.TrimRight(uid[:64], "."), nil
+	}
+	dicomlog.Vprintf(1, "dicom.Element: %v (continuing)", err)
+	return s, nil
+}
+
+// formatTime formats t as a value of VR DA (YYYYMMDD), TM (HHMMSS.FFFFFF) or
+// DT (YYYYMMDDHHMMSS.FFFFFF&ZZXX), as per P3.5 6.2. The fraction is left out
+// for whole seconds.
+func formatTime(vr string, t time.Time) string {
+	fraction := ""
+	if t.Nanosecond() != 0 {
+		fraction = fmt.Sprintf(".%06d", t.Nanosecond()/1000)
+	}
+	switch vr {
+	case "DA":
+		return t.Format("20060102")
+	case "TM":
+		return t.Format("150405") + fraction
+	}
+	return t.Format("20060102150405") + fraction + t.Format("-0700")
+}
+
+var (
+	timePattern     = regexp.MustCompile(`^(\d\d)(?:(\d\d)(?:(\d\d)(?:\.\d{1,6})?)?)?$`)
+	dateTimePattern = regexp.MustCompile(`^(\d{4})(?:(\d\d)(?:(\d\d)(?:(\d\d)(?:(\d\d)(?:(\d\d)(?:\.\d{1,6})?)?)?)?)?)?([+-]\d{4})?$`)
+)
+
+// checkDateTime checks the format of a DA, TM or DT value (P3.5 6.2). Empty
+// values are allowed.
+func checkDateTime(vr, s string) error {
+	s = strings.TrimRight(s, " ")
+	if s == "" {
+		return nil
+	}
+	// Components that are present: year, month, day, hours, minutes, seconds.
+	var c []string
+	switch vr {
+	case "DA":
+		if _, err := time.Parse("20060102", s); err != nil || len(s) != 8 {
+			return fmt.Errorf("DA value must be YYYYMMDD, but found '%v'", s)
+		}
+		return nil
+	case "TM":
+		m := timePattern.FindStringSubmatch(s)
+		if m == nil {
+			return fmt.Errorf("TM value must be HHMMSS.FFFFFF, but found '%v'", s)
+		}
+		c = append([]string{"", "", ""}, m[1:4]...)
+	case "DT":
+		m := dateTimePattern.FindStringSubmatch(s)
+		if m == nil {
+			return fmt.Errorf("DT value must be YYYYMMDDHHMMSS.FFFFFF&ZZXX, but found '%v'", s)
+		}
+		c = m[1:7]
+	}
+	for i, max := range []int{9999, 12, 31, 23, 59, 60} {
+		if c[i] == "" {
+			continue
+		}
+		if n, _ := strconv.Atoi(c[i]); n > max || (n == 0 && (i == 1 || i == 2)) {
+			return fmt.Errorf("%v value '%v' is out of range", vr, s)
+		}
+	}
+	return nil
+}
+
+// coerceValues converts numeric values to the Go type of vrKind. Values that
+// already have that type, and non-numeric ones, are returned as is.
+func coerceValues(values []interface{}, vrKind dicomtag.VRKind) ([]interface{}, error) {
+	coerced := make([]interface{}, len(values))
+	for i, value := range values {
+		var err error
+		if coerced[i], err = coerceValue(value, vrKind); err != nil {
+			return nil, err
+		}
+	}
+	return coerced, nil
+}
+
+func coerceValue(value interface{}, vrKind dicomtag.VRKind) (interface{}, error) {
+	var n int64
+	var f float64
+	isInt := true
+	switch v := value.(type) {
+	case uint16:
+		n = int64(v)
+	case uint32:
+		n = int64(v)
+	case int16:
+		n = int64(v)
+	case int32:
+		n = int64(v)
+	case float32:
+		f, isInt = float64(v), false
+	case float64:
+		f, isInt = v, false
+	default:
+		return value, nil
+	}
+	if isInt {
+		f = float64(n)
+	} else if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		n = int64(f)
+	} else if vrKind != dicomtag.VRFloat32List && vrKind != dicomtag.VRFloat64List {
+		return nil, fmt.Errorf("value %v isn't an integer", value)
+	}
+	inRange := func(min, max int64) error {
+		if n < min || n > max {
+			return fmt.Errorf("value %v out of range", value)
+		}
+		return nil
+	}
+	switch vrKind {
+	case dicomtag.VRUInt16List:
+		return uint16(n), inRange(0, math.MaxUint16)
+	case dicomtag.VRUInt32List:
+		return uint32(n), inRange(0, math.MaxUint32)
+	case dicomtag.VRInt16List:
+		return int16(n), inRange(math.MinInt16, math.MaxInt16)
+	case dicomtag.VRInt32List:
+		return int32(n), inRange(math.MinInt32, math.MaxInt32)
+	case dicomtag.VRFloat32List:
+		return float32(f), nil
+	case dicomtag.VRFloat64List:
+		return f, nil
+	}
+	return value, nil
+}
+
+// resolveUNValues reinterprets the values of a UN element, i.e., its raw
+// bytes, as values of vr, the way the parser would read them.
+func resolveUNValues(tag dicomtag.Tag, vr string, values []interface{}) ([]interface{}, error) {
+	var data []byte
+	if len(values) == 1 {
+		if b, ok := values[0].([]byte); ok {
+			data = b
+		}
+	}
+	if data == nil {
+		// The parser reads UN values as strings split at backslashes.
+		var s []string
+		for _, value := range values {
+			v, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("expect a string or binary value, but found %v", value)
+			}
+			s = append(s, v)
+		}
+		data = []byte(strings.Join(s, "\\"))
+	}
+	kind := dicomtag.GetVRKind(tag, vr)
+	size := 0
+	switch kind {
+	case dicomtag.VRSequence, dicomtag.VRItem, dicomtag.VRPixelData:
+		return nil, fmt.Errorf("VR %v isn't supported", vr)
+	case dicomtag.VRBytes:
+		return []interface{}{data}, nil
+	case dicomtag.VRString, dicomtag.VRStringList, dicomtag.VRDate:
+		s := strings.TrimRight(string(data), " \x00")
+		if s == "" {
+			return nil, nil
+		}
+		if kind == dicomtag.VRString {
+			return []interface{}{s}, nil
+		}
+		var resolved []interface{}
+		for _, v := range strings.Split(s, "\\") {
+			resolved = append(resolved, strings.Trim(v, " "))
+		}
+		return resolved, nil
+	case dicomtag.VRUInt16List, dicomtag.VRInt16List:
+		size = 2
+	case dicomtag.VRUInt32List, dicomtag.VRInt32List, dicomtag.VRFloat32List, dicomtag.VRTagList:
+		size = 4
+	case dicomtag.VRFloat64List:
+		size = 8
+	}
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("length %v isn't a multiple of %v", len(data), size)
+	}
+	d := dicomio.NewBytesDecoder(data, binary.LittleEndian, dicomio.ImplicitVR)
+	var resolved []interface{}
+	for d.Len() > 0 {
+		switch kind {
+		case dicomtag.VRUInt16List:
+			resolved = append(resolved, d.ReadUInt16())
+		case dicomtag.VRInt16List:
+			resolved = append(resolved, d.ReadInt16())
+		case dicomtag.VRUInt32List:
+			resolved = append(resolved, d.ReadUInt32())
+		case dicomtag.VRInt32List:
+			resolved = append(resolved, d.ReadInt32())
+		case dicomtag.VRFloat32List:
+			resolved = append(resolved, d.ReadFloat32())
+		case dicomtag.VRFloat64List:
+			resolved = append(resolved, d.ReadFloat64())
+		case dicomtag.VRTagList:
+			group := d.ReadUInt16()
+			resolved = append(resolved, dicomtag.Tag{Group: group, Element: d.ReadUInt16()})
+		}
+	}
+	return resolved, d.Finish()
+}
+
+// isUnknownSequence reports whether elem is a UN element of undefined length
+// holding items, as the parser reads them (P3.5 6.2.2). Such elements are
+// written like a sequence of undefined length, in the surrounding transfer
+// syntax.
+func isUnknownSequence(vr string, elem *element.Element) bool {
+	if vr != "UN" || !elem.UndefinedLength || len(elem.Value) == 0 {
+		return false
+	}
+	for _, value := range elem.Value {
+		if _, ok := sequenceItem(value, true); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sequenceItem returns the Item element for one value of a SQ element: the
+// value itself, or an Item holding the elements of a SequenceItemValue, with
+// the given length encoding. ok is false for any other value.
+func sequenceItem(value interface{}, undefinedLength bool) (item *element.Element, ok bool) {
+	switch v := value.(type) {
+	case *element.Element:
+		return v, v.Tag == dicomtag.Item
+	case element.SequenceItemValue:
+		if v.DataSet == nil {
+			return nil, false
+		}
+		item = &element.Element{Tag: dicomtag.Item, VR: "NA", UndefinedLength: undefinedLength,
+			Value: make([]interface{}, len(v.DataSet.Elements))}
+		for i, subelem := range v.DataSet.Elements {
+			item.Value[i] = subelem
+		}
+		return item, true
+	}
+	return nil, false
+}
+
+// rawBytesMatch reports whether elem.RawBytes can stand for elem under
+// WithFaithfulCopy: they must start with the tag of elem and its VR vr, and
+// elem encoded normally with the given options must still have the digest
+// recorded when it was read, which catches values changed since then, and
+// elements dropped from its items by WithTagFilter. Elements holding a
+// PixelDataStream are never a match, as encoding them would consume their
+// readers.
+func rawBytesMatch(e *dicomio.Encoder, elem *element.Element, vr string, options optSet) bool {
+	if _, ok := singleValue(elem).(element.PixelDataStream); ok {
+		return false
+	}
+	if elem.RawDigest == nil {
+		return false
+	}
+	bo, implicit := e.TransferSyntax()
+	d := dicomio.NewBytesDecoder(elem.RawBytes, bo, implicit)
+	tag := dicomtag.Tag{Group: d.ReadUInt16(), Element: d.ReadUInt16()}
+	if tag != elem.Tag {
+		return false
+	}
+	if implicit == dicomio.ExplicitVR && tag.Group != dicomtag.GROUP_ItemSeq && d.ReadString(2) != vr {
+		return false
+	}
+	if d.Error() != nil {
+		return false
+	}
+	options.faithfulCopy = false
+	return bytes.Equal(elementDigest(e, elem, options), elem.RawDigest)
+}
+
+// ElementDigest returns the SHA-256 digest of elem encoded by Element with the
+// transfer syntax and character set of e, or nil if it can't be encoded.
+// Nothing is written to e. The parser records it as Element.RawDigest with
+// ParseOptions.KeepRawBytes, so that WithFaithfulCopy can tell whether the
+// element was modified since it was read.
+func ElementDigest(e *dicomio.Encoder, elem *element.Element, opts ...Option) []byte {
+	return elementDigest(e, elem, optsIntoOptSet(opts...))
+}
+
+// elementDigest is ElementDigest with the options already collected. The
+// encoding is hashed as it is produced, without holding it in memory.
+func elementDigest(e *dicomio.Encoder, elem *element.Element, options optSet) []byte {
+	h := sha256.New()
+	bo, implicit := e.TransferSyntax()
+	sube := dicomio.NewEncoder(h, bo, implicit)
+	sube.SetCharset(e.Charset())
+	encodeElement(sube, elem, options)
+	if sube.Error() != nil {
+		return nil
+	}
+	return h.Sum(nil)
+}
+
+// isLegacyVRElement reports whether WithLegacyVRs lets elem be written with a
+// VR of another Go type than the dictionary one.
+func isLegacyVRElement(elem *element.Element) bool {
+	if elem.Tag.Group == dicomtag.MetadataGroup {
+		return true
+	}
+	_, ok := singleValue(elem).([]byte)
+	return ok
+}
+
+// isAllowedVR checks if the DICOM standard allows vr for the tag.
+func isAllowedVR(tag dicomtag.Tag, vr string) bool {
+	vrs, err := dicomtag.AllowedVRs(tag)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range vrs {
+		if allowed == vr {
+			return true
+		}
+	}
+	return false
 }
 
 // Element encodes one data element.  Errors are reported through e.Error()
 // and/or E.Finish().
 //
 // REQUIRES: Each value in values[] must match the VR of the tag. E.g., if tag
-// is for UL, then each value must be uint32.
+// is for UL, then each value must be uint32. As an exception, values of VR DS
+// and IS may also be Go integers, and DS values floats; they are formatted as
+// decimal strings (see formatNumber). Values of VR DA, TM and DT may be
+// time.Time (see formatTime).
 func Element(e *dicomio.Encoder, elem *element.Element, opts ...Option) {
-	options := optsIntoOptSet(opts...)
+	encodeElement(e, elem, optsIntoOptSet(opts...))
+}
+
+// encodeElement is Element with the options already collected, so that
+// nested elements don't build their optSet again.
+func encodeElement(e *dicomio.Encoder, elem *element.Element, options optSet) {
 	vr := elem.VR
-	if !options.skipVRVerification {
-		entry, err := dicomtag.Find(elem.Tag)
-		if vr == "" {
-			if err == nil {
-				vr = entry.VR
-			} else {
-				vr = "UN"
-			}
+	entry, err := dicomtag.Find(elem.Tag)
+	if vr == "" {
+		// Resolving a missing VR from the dictionary is not verification,
+		// so it happens even with SkipVRVerification.
+		if err == nil {
+			vr = entry.VR
+		} else if dicomtag.IsPrivateCreator(elem.Tag) {
+			vr = "LO"
 		} else {
-			if err == nil && entry.VR != vr {
-				if dicomtag.GetVRKind(elem.Tag, entry.VR) != dicomtag.GetVRKind(elem.Tag, vr) {
-					// The golang repl. is different. We can't continue.
-					e.SetErrorf("dicom.Element: VR value mismatch for tag %s. Element.VR=%v, but DICOM standard defines VR to be %v",
-						dicomtag.DebugString(elem.Tag), vr, entry.VR)
-					return
-				}
-				dicomlog.Vprintf(1, "dicom.Element: VR value mismatch for tag %s. Element.VR=%v, but DICOM standard defines VR to be %v (continuing)",
-					dicomtag.DebugString(elem.Tag), vr, entry.VR)
+			vr = "UN"
+		}
+	} else if !options.skipVRVerification {
+		if err == nil && vr != entry.VR && !isAllowedVR(elem.Tag, vr) && options.coerceVR {
+			coerced, err := coerceValues(elem.Value, dicomtag.GetVRKind(elem.Tag, entry.VR))
+			if err != nil {
+				e.SetErrorf("%v: can't coerce VR %v to %v: %v", dicomtag.DebugString(elem.Tag), vr, entry.VR, err)
+				return
 			}
+			dicomlog.Vprintf(1, "dicom.Element: coercing VR of tag %s from %v to %v",
+				dicomtag.DebugString(elem.Tag), vr, entry.VR)
+			vr = entry.VR
+			elem = &element.Element{Tag: elem.Tag, VR: vr, Value: coerced, UndefinedLength: elem.UndefinedLength}
+		} else if err == nil && vr != entry.VR && !isAllowedVR(elem.Tag, vr) {
+			if dicomtag.GetVRKind(elem.Tag, entry.VR) != dicomtag.GetVRKind(elem.Tag, vr) && !(options.legacyVRs && isLegacyVRElement(elem)) {
+				// The golang repl. is different. We can't continue.
+				e.SetError(&VRMismatchError{Tag: elem.Tag, VR: vr, DictionaryVR: entry.VR})
+				return
+			}
+			dicomlog.Vprintf(1, "dicom.Element: VR value mismatch for tag %s. Element.VR=%v, but DICOM standard defines VR to be %v (continuing)",
+				dicomtag.DebugString(elem.Tag), vr, entry.VR)
+		}
+	}
+	if vr == "UN" && options.unResolution != nil && !isUnknownSequence(vr, elem) {
+		if resolved := options.unResolution(elem.Tag); resolved != "" && resolved != "UN" {
+			values, err := resolveUNValues(elem.Tag, resolved, elem.Value)
+			if err != nil {
+				e.SetErrorf("%v: can't resolve UN to %v: %v", dicomtag.DebugString(elem.Tag), resolved, err)
+				return
+			}
+			vr = resolved
+			elem = &element.Element{Tag: elem.Tag, VR: vr, Value: values}
 		}
 	}
 	doassert(vr != "", vr)
+	if options.faithfulCopy && elem.RawBytes != nil && rawBytesMatch(e, elem, vr, options) {
+		e.WriteBytes(elem.RawBytes)
+		return
+	}
+	if lazy, ok := singleValue(elem).(element.LazyValue); ok {
+		if vr != "OB" && vr != "OW" && vr != "UN" {
+			e.SetErrorf("%v: LazyValue cannot be written with VR %v", dicomtag.DebugString(elem.Tag), vr)
+			return
+		}
+		if elem.UndefinedLength {
+			e.SetErrorf("%v: LazyValue of undefined length: %w", dicomtag.DebugString(elem.Tag), ErrorUnimplemented)
+			return
+		}
+		writeLazyValue(e, elem.Tag, vr, lazy, options)
+		return
+	}
 	if elem.Tag == dicomtag.PixelData {
 		if len(elem.Value) != 1 {
 			// TODO(saito) Use of PixelDataInfo is a temp hack. Come up with a more proper solution.
 			e.SetError(fmt.Errorf("PixelData element must have one value of type PixelDataInfo"))
+			return
+		}
+		if stream, ok := elem.Value[0].(element.PixelDataStream); ok {
+			if elem.UndefinedLength {
+				e.SetErrorf("%v: PixelDataStream of undefined length: %w", dicomtag.DebugString(elem.Tag), ErrorUnimplemented)
+				return
+			}
+			writePixelDataStream(e, elem.Tag, vr, stream, options)
+			return
 		}
 		image, ok := elem.Value[0].(element.PixelDataInfo)
 		if !ok {
 			e.SetError(fmt.Errorf("PixelData element must have one value of type PixelDataInfo"))
+			return
 		}
-		if elem.UndefinedLength {
-			encodeElementHeader(e, elem.Tag, vr, element.VLUndefinedLength)
-			writeBasicOffsetTable(e, image.Offsets)
-			for _, frame := range image.Frames {
-				writeRawItem(e, frame.EncapsulatedData.Data)
+		if elem.UndefinedLength || image.IsEncapsulated {
+			encodeElementHeader(e, elem.Tag, vr, element.VLUndefinedLength, options)
+			// Unless given, e.g., for frames made of several fragments, the
+			// offsets are computed assuming one fragment per frame.
+			offsets := image.Offsets
+			if options.emptyBasicOffsetTable {
+				offsets = nil
+			} else if offsets == nil {
+				var fragmentLengths []int
+				for _, frame := range image.Frames {
+					fragmentLengths = append(fragmentLengths, len(frame.EncapsulatedData.Data))
+				}
+				offsets = basicOffsetTable(fragmentLengths)
 			}
-			encodeElementHeader(e, dicomtag.SequenceDelimitationItem, "" /*not used*/, 0)
-		} else {
-			//TODO(suyash) Revisit the below changes and this test when diving deeper into writing functionality and pre-existing tests
-			// We should be dealing with NativeFrames here since we've got a defined value length for this PixelData
-			// as per Part 5 Sec A.4 of the DICOM spec. We will also assume that all Frames in image.Frames are NativeFrames.
-			numFrames := len(image.Frames)
-			numPixels := len(image.Frames[0].NativeData.Data)
-			numValues := len(image.Frames[0].NativeData.Data[0])
-			length := numFrames * numPixels * numValues * image.Frames[0].NativeData.BitsPerSample / 8 // length in bytes
-
-			doassert(len(image.Frames) == 1, image.Frames) //TODO(suyash) not sure why this is set to 1...we should be able to handle multi frame writes
-			encodeElementHeader(e, elem.Tag, vr, uint32(length))
-			buf := new(bytes.Buffer)
-			buf.Grow(length)
-			for frame := 0; frame < numFrames; frame++ {
-				for pixel := 0; pixel < numPixels; pixel++ {
-					for value := 0; value < numValues; value++ {
-						if image.Frames[frame].NativeData.BitsPerSample == 8 {
-							binary.Write(buf, binary.LittleEndian, uint8(image.Frames[frame].NativeData.Data[pixel][value])) //TODO: revisit little endian
-						} else if image.Frames[frame].NativeData.BitsPerSample == 16 {
-							binary.Write(buf, binary.LittleEndian, uint16(image.Frames[frame].NativeData.Data[pixel][value])) //TODO: revisit little endian
-						}
-					}
+			writeBasicOffsetTable(e, offsets, options)
+			for _, frame := range image.Frames {
+				if canceled(e, options) {
+					return
 				}
+				writeRawItem(e, frame.EncapsulatedData.Data, options)
 			}
-			e.WriteBytes(buf.Bytes())
+			if options.trailingEmptyFragment {
+				writeRawItem(e, nil, options)
+			}
+			encodeElementHeader(e, dicomtag.SequenceDelimitationItem, "" /*not used*/, 0, options)
+		} else {
+			writeNativePixelData(e, elem.Tag, vr, image, options)
 		}
 		return
 	}
-	if vr == "SQ" {
-		if elem.UndefinedLength {
-			encodeElementHeader(e, elem.Tag, vr, element.VLUndefinedLength)
+	if vr == "SQ" || isUnknownSequence(vr, elem) {
+		// An unknown sequence must keep its undefined length, or it would be
+		// read back as a UN value of raw bytes.
+		if elem.UndefinedLength && (!options.explicitSequenceLength || vr == "UN") {
+			encodeElementHeader(e, elem.Tag, vr, element.VLUndefinedLength, options)
 			for _, value := range elem.Value {
-				subelem, ok := value.(*element.Element)
-				if !ok || subelem.Tag != dicomtag.Item {
+				subelem, ok := sequenceItem(value, elem.UndefinedLength)
+				if !ok {
 					e.SetError(fmt.Errorf("SQ element must be an Item, but found %v", value))
 					return
 				}
-				Element(e, subelem, opts...)
+				encodeElement(e, subelem, options)
 			}
-			encodeElementHeader(e, dicomtag.SequenceDelimitationItem, "" /*not used*/, 0)
+			encodeElementHeader(e, dicomtag.SequenceDelimitationItem, "" /*not used*/, 0, options)
 		} else {
-			sube := dicomio.NewBytesEncoder(e.TransferSyntax())
+			sube, buf := newSubEncoder(e)
 			for _, value := range elem.Value {
-				subelem, ok := value.(*element.Element)
-				if !ok || subelem.Tag != dicomtag.Item {
+				subelem, ok := sequenceItem(value, elem.UndefinedLength)
+				if !ok {
 					e.SetErrorf("SQ element must be an Item, but found %v", value)
 					return
 				}
-				Element(sube, subelem, opts...)
+				encodeElement(sube, subelem, options)
 			}
 			if sube.Error() != nil {
 				e.SetError(sube.Error())
 				return
 			}
 			bytes := sube.Bytes()
-			encodeElementHeader(e, elem.Tag, vr, uint32(len(bytes)))
+			if !encodeElementHeader(e, elem.Tag, vr, uint32(len(bytes)), options) {
+				return
+			}
 			e.WriteBytes(bytes)
+			putBuffer(buf)
+		}
+	} else if elem.Tag == dicomtag.ItemDelimitationItem || elem.Tag == dicomtag.SequenceDelimitationItem {
+		if len(elem.Value) > 0 {
+			e.SetErrorf("%v: delimitation items take no value, but found %v", dicomtag.DebugString(elem.Tag), elem.Value)
+			return
 		}
+		encodeElementHeader(e, elem.Tag, vr, 0, options)
 	} else if vr == "NA" { // Item
-		if elem.UndefinedLength {
-			encodeElementHeader(e, elem.Tag, vr, element.VLUndefinedLength)
+		options.depth++
+		if tooDeep(options) {
+			e.SetErrorf("%v: items nested more than %v levels deep", dicomtag.DebugString(elem.Tag), options.depth-1)
+			return
+		}
+		if elem.UndefinedLength && !options.explicitSequenceLength {
+			encodeElementHeader(e, elem.Tag, vr, element.VLUndefinedLength, options)
 			for _, value := range elem.Value {
 				subelem, ok := value.(*element.Element)
 				if !ok {
 					e.SetErrorf("Item values must be an element.Element, but found %v", value)
 					return
 				}
-				Element(e, subelem, opts...)
+				if filteredOut(subelem.Tag, options) {
+					continue
+				}
+				encodeElement(e, subelem, options)
 			}
-			encodeElementHeader(e, dicomtag.ItemDelimitationItem, "" /*not used*/, 0)
+			encodeElementHeader(e, dicomtag.ItemDelimitationItem, "" /*not used*/, 0, options)
 		} else {
-			sube := dicomio.NewBytesEncoder(e.TransferSyntax())
+			sube, buf := newSubEncoder(e)
 			for _, value := range elem.Value {
 				subelem, ok := value.(*element.Element)
 				if !ok {
 					e.SetErrorf("Item values must be an element.Element, but found %v", value)
 					return
 				}
-				Element(sube, subelem, opts...)
+				if filteredOut(subelem.Tag, options) {
+					continue
+				}
+				encodeElement(sube, subelem, options)
 			}
 			if sube.Error() != nil {
 				e.SetError(sube.Error())
 				return
 			}
 			bytes := sube.Bytes()
-			encodeElementHeader(e, elem.Tag, vr, uint32(len(bytes)))
+			if !encodeElementHeader(e, elem.Tag, vr, uint32(len(bytes)), options) {
+				return
+			}
 			e.WriteBytes(bytes)
+			putBuffer(buf)
 		}
 	} else {
 		if elem.UndefinedLength {
-			e.SetErrorf("Encoding undefined-length element not yet supported: %v", elem)
+			e.SetErrorf("%v: %v element of undefined length: %w", dicomtag.DebugString(elem.Tag), vr, ErrorUnimplemented)
 			return
 		}
-		sube := dicomio.NewBytesEncoder(e.TransferSyntax())
+		sube, buf := newSubEncoder(e)
 		switch vr {
 		case "US":
 			for _, value := range elem.Value {
@@ -286,7 +1524,7 @@ func Element(e *dicomio.Encoder, elem *element.Element, opts ...Option) {
 				}
 				sube.WriteUInt16(v)
 			}
-		case "UL":
+		case "UL", "OL":
 			for _, value := range elem.Value {
 				v, ok := value.(uint32)
 				if !ok {
@@ -316,7 +1554,7 @@ func Element(e *dicomio.Encoder, elem *element.Element, opts ...Option) {
 				}
 				sube.WriteInt16(v)
 			}
-		case "FL":
+		case "FL", "OF":
 			for _, value := range elem.Value {
 				v, ok := value.(float32)
 				if !ok {
@@ -326,7 +1564,7 @@ func Element(e *dicomio.Encoder, elem *element.Element, opts ...Option) {
 				}
 				sube.WriteFloat32(v)
 			}
-		case "FD":
+		case "FD", "OD":
 			for _, value := range elem.Value {
 				v, ok := value.(float64)
 				if !ok {
@@ -336,7 +1574,10 @@ func Element(e *dicomio.Encoder, elem *element.Element, opts ...Option) {
 				}
 				sube.WriteFloat64(v)
 			}
-		case "OW", "OB": // TODO(saito) Check that size is even. Byte swap??
+		case "OW", "OB":
+			if len(elem.Value) == 0 {
+				break // An empty value.
+			}
 			if len(elem.Value) != 1 {
 				e.SetErrorf("%v: expect a single value but found %v",
 					dicomtag.DebugString(elem.Tag), elem.Value)
@@ -363,44 +1604,105 @@ func Element(e *dicomio.Encoder, elem *element.Element, opts ...Option) {
 				doassert(d.Finish() == nil, d.Error())
 			} else { // vr=="OB"
 				sube.WriteBytes(bytes)
-				if len(bytes)%2 == 1 {
-					sube.WriteByte(0)
+				writePadding(sube, elem.Tag, len(bytes), 0, options)
+			}
+		case "AT":
+			for _, value := range elem.Value {
+				v, ok := value.(dicomtag.Tag)
+				if !ok {
+					e.SetErrorf("%v: expect dicomtag.Tag, but found %v",
+						dicomtag.DebugString(elem.Tag), value)
+					continue
 				}
+				sube.WriteUInt16(v.Group)
+				sube.WriteUInt16(v.Element)
 			}
-		case "AT", "NA":
+		case "AE", "AS", "CS", "DA", "DS", "DT", "IS", "LO", "LT", "PN",
+			"SH", "ST", "TM", "UC", "UI", "UR", "UT", "NA":
 			fallthrough
 		default:
+			if raw, ok := singleValue(elem).([]byte); ok && options.legacyVRs {
+				sube.WriteBytes(raw)
+				writePadding(sube, elem.Tag, len(raw), 0, options)
+				break
+			}
+			if (vr == "LT" || vr == "UT" || vr == "UR") && len(elem.Value) > 1 {
+				// Backslashes are part of the text or URI of these VRs
+				// (P3.5 6.2).
+				e.SetErrorf("%v: VR %v takes a single value, but found %v", dicomtag.DebugString(elem.Tag), vr, len(elem.Value))
+				return
+			}
 			s := ""
 			for i, value := range elem.Value {
 				substr, ok := value.(string)
+				if !ok && (vr == "DS" || vr == "IS") {
+					var err error
+					if substr, err = formatNumber(vr, value); err != nil {
+						e.SetErrorf("%v: %v", dicomtag.DebugString(elem.Tag), err)
+						continue
+					}
+					ok = true
+				}
+				if t, isTime := value.(time.Time); isTime && (vr == "DA" || vr == "TM" || vr == "DT") {
+					substr, ok = formatTime(vr, t), true
+				}
+				if name, isName := value.(element.PersonName); isName && vr == "PN" {
+					substr, ok = name.String(), true
+				}
 				if !ok {
 					e.SetErrorf("%v: Non-string value found", dicomtag.DebugString(elem.Tag))
 					continue
 				}
+				if vr == "AS" {
+					var err error
+					if substr, err = formatAge(substr, options.strictValues); err != nil {
+						e.SetErrorf("%v: %v", dicomtag.DebugString(elem.Tag), err)
+						continue
+					}
+				}
+				if vr == "UI" {
+					var err error
+					if substr, err = formatUID(substr, options.strictValues); err != nil {
+						e.SetErrorf("%v: %v", dicomtag.DebugString(elem.Tag), err)
+						continue
+					}
+				}
+				if options.strictValues && (vr == "DA" || vr == "TM" || vr == "DT") {
+					if err := checkDateTime(vr, substr); err != nil {
+						e.SetErrorf("%v: %v", dicomtag.DebugString(elem.Tag), err)
+						continue
+					}
+				}
 				if i > 0 {
 					s += "\\"
 				}
 				s += substr
 			}
-			sube.WriteString(s)
-			if len(s)%2 == 1 {
-				switch vr {
-				// Values with VRs constructed of character strings, except in the case of the VR UI, shall be padded with SPACE characters
-				// per http://dicom.nema.org/medical/dicom/current/output/html/part05.html#sect_6.2
-				case "DT", "LO", "LT", "PN", "SH", "ST", "UT":
-					sube.WriteString(" ")
-				default:
-					sube.WriteByte(0)
-				}
+			// Values with VRs constructed of character strings, except in the case of the VR UI, shall be padded with SPACE characters
+			// per http://dicom.nema.org/medical/dicom/current/output/html/part05.html#sect_6.2
+			pad := byte(' ')
+			if vr == "UI" || vr == "UN" {
+				pad = 0
 			}
+			switch vr {
+			case "LO", "LT", "PN", "SH", "ST", "UC", "UT":
+				// Only these VRs may use a character set other than the
+				// default repertoire (P3.5 6.1.2.3).
+				s = e.EncodeString(s)
+			}
+			sube.WriteString(s)
+			writePadding(sube, elem.Tag, len(s), pad, options)
 		}
 		if sube.Error() != nil {
 			e.SetError(sube.Error())
 			return
 		}
 		bytes := sube.Bytes()
-		encodeElementHeader(e, elem.Tag, vr, uint32(len(bytes)))
+		if !encodeElementHeader(e, elem.Tag, vr, uint32(len(bytes)), options) {
+			return
+		}
 		e.WriteBytes(bytes)
+		putBuffer(buf)
 	}
 }
 
@@ -409,45 +1711,195 @@ func Element(e *dicomio.Encoder, elem *element.Element, opts ...Option) {
 //
 // The transfer syntax (byte order, etc) of the file is determined by the
 // TransferSyntax element in "ds". If ds is missing that or a few other
-// essential elements, this function returns an error.
+// essential elements, this function returns an error. MediaStorageSOPClassUID
+// and MediaStorageSOPInstanceUID are taken from SOPClassUID and
+// SOPInstanceUID when "ds" doesn't have them.
+//
+// DataSet doesn't modify ds or its elements, nor any other shared state, so
+// several goroutines may write the same dataset at once, as long as none of
+// them modifies it; use element.DataSet.Clone to change elements for one
+// writer only. A PixelDataStream can't be written more than once, as its
+// readers are consumed.
 //
 //  ds := ... read or create dicom.Dataset ...
 //  out, err := os.Create("test.dcm")
 //  err := write.DataSet(out, ds)
 func DataSet(out io.Writer, ds *element.DataSet, opts ...Option) error {
-	e := dicomio.NewEncoder(out, nil, dicomio.UnknownVR)
+	return DataSetWithContext(context.Background(), out, ds, opts...)
+}
+
+// DataSetWithContext is similar to DataSet, but it stops writing and returns
+// ctx.Err() once ctx is done, checking between elements and between pixel
+// data frames. Whatever was written to out until then is left as is.
+func DataSetWithContext(ctx context.Context, out io.Writer, ds *element.DataSet, opts ...Option) error {
+	opts = append(opts[:len(opts):len(opts)], withContext(ctx))
 	var metaElems []*element.Element
 	for _, elem := range ds.Elements {
 		if elem.Tag.Group == dicomtag.MetadataGroup {
 			metaElems = append(metaElems, elem)
 		}
 	}
-	FileHeader(e, metaElems)
-	if e.Error() != nil {
-		return e.Error()
+	defaultMeta := len(metaElems) == 0 && optsIntoOptSet(opts...).defaultMeta
+	if options := optsIntoOptSet(opts...); options.validate {
+		var msgs []string
+		for _, issue := range ds.Validate() {
+			if issue.Tag == dicomtag.TransferSyntaxUID && (options.transferSyntaxUID != "" || options.transferSyntaxLabel != "") {
+				continue // Overridden by WithTransferSyntax or WithTransferSyntaxLabel.
+			}
+			if issue.Tag.Group == dicomtag.MetadataGroup && defaultMeta {
+				continue // Synthesized below.
+			}
+			msgs = append(msgs, issue.String())
+		}
+		if len(msgs) > 0 {
+			return fmt.Errorf("write.DataSet: invalid dataset: %v", strings.Join(msgs, "; "))
+		}
+	}
+	if defaultMeta {
+		metaElems = append(metaElems, element.MustNewElement(dicomtag.TransferSyntaxUID, dicomuid.ExplicitVRLittleEndian))
+	}
+	metaElems = deriveMetaElem(metaElems, ds, dicomtag.MediaStorageSOPClassUID, dicomtag.SOPClassUID)
+	metaElems = deriveMetaElem(metaElems, ds, dicomtag.MediaStorageSOPInstanceUID, dicomtag.SOPInstanceUID)
+	if defaultMeta {
+		if _, err := element.FindByTag(metaElems, dicomtag.MediaStorageSOPClassUID); err != nil {
+			metaElems = append(metaElems, element.MustNewElement(dicomtag.MediaStorageSOPClassUID, "1.2.840.10008.5.1.4.1.1.7"))
+		}
+		if _, err := element.FindByTag(metaElems, dicomtag.MediaStorageSOPInstanceUID); err != nil {
+			uid, err := newUUIDUID()
+			if err != nil {
+				return err
+			}
+			metaElems = append(metaElems, element.MustNewElement(dicomtag.MediaStorageSOPInstanceUID, uid))
+		}
 	}
-	endian, implicit, err := ds.TransferSyntax()
+	w, err := NewElementWriter(out, metaElems, opts...)
 	if err != nil {
 		return err
 	}
-	e.PushTransferSyntax(endian, implicit)
-	for _, elem := range ds.Elements {
-		if elem.Tag.Group != dicomtag.MetadataGroup {
-			Element(e, elem, opts...)
+	elems := ds.Elements
+	if !optsIntoOptSet(opts...).keepElementOrder {
+		elems = append([]*element.Element(nil), elems...)
+		sort.SliceStable(elems, func(i, j int) bool {
+			return tagLess(elems[i].Tag, elems[j].Tag)
+		})
+	}
+	groupLengths := optsIntoOptSet(opts...).groupLengths
+	for i, elem := range elems {
+		if elem.Tag.Group == dicomtag.MetadataGroup {
+			continue
+		}
+		if elem.Tag.Element == 0x0000 && groupLengths != keepGroupLengths {
+			if groupLengths == stripGroupLengths {
+				continue
+			}
+			length, err := w.groupLength(elems[i+1:], elem.Tag.Group)
+			if err != nil {
+				return err
+			}
+			elem = &element.Element{Tag: elem.Tag, VR: "UL", Value: []interface{}{length}}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.WriteElement(elem); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// DataSetBody is similar to DataSet, but it writes neither the 128-byte
+// preamble, the "DICM" magic nor the meta group, e.g., to embed the dataset in
+// a network message; it is a shorthand for DataSet with WithoutPreamble and
+// OmitMetaGroup. The dataset is encoded in the transfer syntax of its
+// TransferSyntaxUID element, or the one given with WithTransferSyntax.
+func DataSetBody(out io.Writer, ds *element.DataSet, opts ...Option) error {
+	return DataSet(out, ds, append(opts[:len(opts):len(opts)], WithoutPreamble, OmitMetaGroup)...)
+}
+
+// CommandSet writes the command set of a DIMSE message (P3.7 6.3.1), i.e.,
+// elements of group 0000, to out in Implicit VR Little Endian, as for every
+// message regardless of the transfer syntax of its dataset. The elements are
+// written in the order of their tags, preceded by CommandGroupLength, which
+// is computed; one given in elems is ignored.
+//
+//  err := write.CommandSet(out, []*element.Element{
+//    element.MustNewElement(dicomtag.AffectedSOPClassUID, sopClassUID),
+//    element.MustNewElement(dicomtag.CommandField, uint16(0x0001)), // C-STORE-RQ
+//    ...
+//  })
+func CommandSet(out io.Writer, elems []*element.Element, opts ...Option) error {
+	options := optsIntoOptSet(opts...)
+	var sorted []*element.Element
+	for _, elem := range elems {
+		if elem.Tag.Group != dicomtag.CommandGroupLength.Group {
+			return fmt.Errorf("write.CommandSet: %v is not a command element", dicomtag.DebugString(elem.Tag))
 		}
+		if elem.Tag != dicomtag.CommandGroupLength {
+			sorted = append(sorted, elem)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return tagLess(sorted[i].Tag, sorted[j].Tag)
+	})
+	body := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ImplicitVR)
+	for _, elem := range sorted {
+		encodeElement(body, elem, options)
+	}
+	if body.Error() != nil {
+		return body.Error()
 	}
-	e.PopTransferSyntax()
+	e := dicomio.NewEncoder(out, binary.LittleEndian, dicomio.ImplicitVR)
+	encodeElement(e, element.MustNewElement(dicomtag.CommandGroupLength, uint32(len(body.Bytes()))), options)
+	e.WriteBytes(body.Bytes())
 	return e.Error()
 }
 
+func tagLess(a, b dicomtag.Tag) bool {
+	if a.Group != b.Group {
+		return a.Group < b.Group
+	}
+	return a.Element < b.Element
+}
+
+// deriveMetaElem appends a metaTag element to metaElems, copying the values
+// of the sourceTag element in ds, if metaElems doesn't already have one.
+func deriveMetaElem(metaElems []*element.Element, ds *element.DataSet, metaTag, sourceTag dicomtag.Tag) []*element.Element {
+	if _, err := element.FindByTag(metaElems, metaTag); err == nil {
+		return metaElems
+	}
+	source, err := ds.FindElementByTag(sourceTag)
+	if err != nil {
+		return metaElems
+	}
+	return append(metaElems, &element.Element{Tag: metaTag, VR: source.VR, Value: source.Value})
+}
+
+// newUUIDUID returns a UID made of a random (version 4) UUID under the "2.25"
+// root, as per P3.5 B.2.
+func newUUIDUID() (string, error) {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return "", err
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40 // Version 4.
+	uuid[8] = uuid[8]&0x3f | 0x80 // Variant 1.
+	return "2.25." + new(big.Int).SetBytes(uuid[:]).String(), nil
+}
+
 // DataSetToFile writes "ds" to the given file. If the file already exists,
-// existing contents are clobbered. Else, the file is newly created.
+// existing contents are clobbered. Else, the file is newly created. The file
+// is synced to disk before DataSetToFile returns, and is closed even on error.
 func DataSetToFile(path string, ds *element.DataSet, opts ...Option) error {
 	out, err := os.Create(path)
 	if err != nil {
 		return err
 	}
-	if err := DataSet(out, ds); err != nil {
+	if err := DataSet(out, ds, opts...); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
 		out.Close()
 		return err
 	}
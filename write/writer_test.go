@@ -1,17 +1,37 @@
 package write_test
 
 import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/constants"
 	"github.com/suyashkumar/dicom/dicomio"
 	"github.com/suyashkumar/dicom/dicomtag"
 	"github.com/suyashkumar/dicom/dicomuid"
 	"github.com/suyashkumar/dicom/element"
+	"github.com/suyashkumar/dicom/frame"
 	"github.com/suyashkumar/dicom/write"
 )
 
@@ -103,13 +123,48 @@ func TestNewElement(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestNewElementConversions(t *testing.T) {
+	cases := []struct {
+		tag   dicomtag.Tag
+		value interface{}
+		want  []interface{}
+	}{
+		{dicomtag.Rows, 512, []interface{}{uint16(512)}},
+		{dicomtag.TriggerSamplePosition, []int{10, 11}, []interface{}{uint32(10), uint32(11)}},
+		{dicomtag.ReferencePixelX0, -2, []interface{}{int32(-2)}},
+		{dicomtag.EventTimeOffset, 3, []interface{}{float64(3)}},
+		{dicomtag.InstanceNumber, 7, []interface{}{"7"}},
+		{dicomtag.PatientName, "Doe^John", []interface{}{"Doe^John"}},
+		{dicomtag.ImageType, []string{"ORIGINAL", "PRIMARY"}, []interface{}{"ORIGINAL", "PRIMARY"}},
+		{dicomtag.EncapsulatedDocument, []byte{1, 2}, []interface{}{[]byte{1, 2}}},
+	}
+	for _, c := range cases {
+		elem, err := element.NewElement(c.tag, c.value)
+		require.NoError(t, err, dicomtag.DebugString(c.tag))
+		assert.Equal(t, c.want, elem.Value, dicomtag.DebugString(c.tag))
+
+		// The element can be written and read back.
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, elem)
+		require.NoError(t, e.Error(), dicomtag.DebugString(c.tag))
+		d := dicomio.NewBytesDecoder(e.Bytes(), binary.LittleEndian, dicomio.ExplicitVR)
+		elem2 := dicom.NewUninitializedParserFromDecoder(d, nil).ParseNext(dicom.ParseOptions{})
+		require.NoError(t, d.Error())
+		assert.Equal(t, c.want, elem2.Value, dicomtag.DebugString(c.tag))
+	}
+
+	_, err := element.NewElement(dicomtag.Rows, 70000)
+	assert.Error(t, err)
+	_, err = element.NewElement(dicomtag.Rows, -1)
+	assert.Error(t, err)
+	_, err = element.NewElement(dicomtag.PatientName, 1)
+	assert.Error(t, err)
+}
+
 func TestOptions(t *testing.T) {
 	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
 	elem := &element.Element{
-		Tag: dicomtag.Tag{
-			0x0028,
-			0x0120,
-		},
+		Tag: dicomtag.Rows,
 		Value: []interface{}{
 			int16(-2000),
 		},
@@ -123,3 +178,2802 @@ func TestOptions(t *testing.T) {
 	err = e.Error()
 	require.Error(t, err)
 }
+
+func TestVRMismatchError(t *testing.T) {
+	rows := &element.Element{Tag: dicomtag.Rows, VR: "SS", Value: []interface{}{int16(-2000)}}
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, &element.Element{
+		Tag:   dicomtag.ReferencedImageSequence,
+		VR:    "SQ",
+		Value: []interface{}{newItem(false, rows)},
+	})
+	var out bytes.Buffer
+	err := write.DataSet(&out, ds)
+	var mismatch *write.VRMismatchError
+	require.True(t, errors.As(err, &mismatch), "%v", err)
+	assert.Equal(t, write.VRMismatchError{Tag: dicomtag.Rows, VR: "SS", DictionaryVR: "US"}, *mismatch)
+	assert.Contains(t, err.Error(), "VR value mismatch")
+
+	out.Reset()
+	assert.NoError(t, write.DataSet(&out, ds, write.SkipVRVerification))
+
+	out.Reset()
+	err = write.DataSet(&out, ds, write.WithMaxElementLength(2))
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &mismatch))
+}
+
+// mustRoundTrip writes ds with the given options, parses the output back and
+// returns the parsed dataset.
+func mustRoundTrip(t *testing.T, ds *element.DataSet, opts ...write.Option) *element.DataSet {
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds, opts...))
+	p, err := dicom.NewParserFromBytes(out.Bytes(), nil)
+	require.NoError(t, err)
+	ds2, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	return ds2
+}
+
+func TestDataSetRoundTrip(t *testing.T) {
+	for _, path := range []string{
+		"../examples/CT-MONO2-16-ort.dcm",
+		"../examples/IM-0001-0001.dcm",
+		"../examples/I_000000.dcm",
+	} {
+		p, err := dicom.NewParserFromFile(path, nil)
+		require.NoError(t, err)
+		ds, err := p.Parse(dicom.ParseOptions{})
+		require.NoError(t, err)
+		ds2 := mustRoundTrip(t, ds)
+		require.Equal(t, len(ds.Elements), len(ds2.Elements), path)
+		for i, elem := range ds.Elements {
+			if elem.Tag == dicomtag.FileMetaInformationGroupLength {
+				continue
+			}
+			assert.Equal(t, elem.String(), ds2.Elements[i].String(), path)
+		}
+		assert.Empty(t, ds.Diff(ds2), path)
+	}
+}
+
+func TestSkipVRVerificationResolvesMissingVR(t *testing.T) {
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{
+		Tag:   dicomtag.Rows,
+		Value: []interface{}{uint16(512)},
+	}, write.SkipVRVerification)
+	require.NoError(t, e.Error())
+	d := dicomio.NewBytesDecoder(e.Bytes(), binary.LittleEndian, dicomio.ExplicitVR)
+	elem := dicom.NewUninitializedParserFromDecoder(d, nil).ParseNext(dicom.ParseOptions{})
+	require.NoError(t, d.Error())
+	assert.Equal(t, "US", elem.VR)
+	assert.Equal(t, []interface{}{uint16(512)}, elem.Value)
+}
+
+func TestPixelDataWrongPayload(t *testing.T) {
+	for _, values := range [][]interface{}{nil, {"not pixel data"}} {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, &element.Element{Tag: dicomtag.PixelData, Value: values})
+		assert.Error(t, e.Error())
+	}
+}
+
+func TestOddLengthElementReturnsError(t *testing.T) {
+	ds := &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.TransferSyntaxUID, dicomuid.ExplicitVRLittleEndian),
+		element.MustNewElement(dicomtag.MediaStorageSOPClassUID, "1.2.840.10008.5.1.4.1.1.1.2"),
+		element.MustNewElement(dicomtag.MediaStorageSOPInstanceUID, "1.2.3.4.5.6.7"),
+		{
+			Tag:             dicomtag.PixelData,
+			VR:              "OB",
+			UndefinedLength: true,
+			Value: []interface{}{element.PixelDataInfo{
+				IsEncapsulated: true,
+				Frames: []frame.Frame{{
+					Encapsulated:     true,
+					EncapsulatedData: frame.EncapsulatedFrame{Data: []byte{1, 2, 3}},
+				}},
+			}},
+		},
+	}}
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, ds, write.StrictPadding))
+}
+
+func TestUndefinedLengthSequenceHeader(t *testing.T) {
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{
+		Tag:             dicomtag.ReferencedImageSequence,
+		VR:              "SQ",
+		UndefinedLength: true,
+		Value: []interface{}{&element.Element{
+			Tag:             dicomtag.Item,
+			UndefinedLength: true,
+			Value: []interface{}{
+				element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3.4"),
+			},
+		}},
+	})
+	require.NoError(t, e.Error())
+	data := e.Bytes()
+	// (0008,1140) SQ 0000 FFFFFFFF
+	assert.Equal(t, []byte{0x08, 0x00, 0x40, 0x11, 'S', 'Q', 0, 0, 0xff, 0xff, 0xff, 0xff}, data[:12])
+	// (FFFE,E000) FFFFFFFF
+	assert.Equal(t, []byte{0xfe, 0xff, 0x00, 0xe0, 0xff, 0xff, 0xff, 0xff}, data[12:20])
+	// (FFFE,E00D) 00000000 (FFFE,E0DD) 00000000
+	assert.Equal(t, []byte{0xfe, 0xff, 0x0d, 0xe0, 0, 0, 0, 0, 0xfe, 0xff, 0xdd, 0xe0, 0, 0, 0, 0}, data[len(data)-16:])
+}
+
+func TestNumericVRByteOrder(t *testing.T) {
+	cases := []struct {
+		tag   dicomtag.Tag
+		vr    string
+		value interface{}
+		le    []byte // expected little-endian encoding
+	}{
+		{dicomtag.Rows, "US", uint16(0x0102), []byte{0x02, 0x01}},
+		{dicomtag.PixelPaddingValue, "SS", int16(-2), []byte{0xfe, 0xff}},
+		{dicomtag.SimpleFrameList, "UL", uint32(0x01020304), []byte{0x04, 0x03, 0x02, 0x01}},
+		{dicomtag.ReferencePixelX0, "SL", int32(-2), []byte{0xfe, 0xff, 0xff, 0xff}},
+		{dicomtag.RecommendedDisplayFrameRateInFloat, "FL", float32(1), []byte{0x00, 0x00, 0x80, 0x3f}},
+		{dicomtag.EventTimeOffset, "FD", float64(1), []byte{0, 0, 0, 0, 0, 0, 0xf0, 0x3f}},
+	}
+	for _, c := range cases {
+		for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			e := dicomio.NewBytesEncoder(bo, dicomio.ImplicitVR)
+			write.Element(e, &element.Element{Tag: c.tag, VR: c.vr, Value: []interface{}{c.value}}, write.SkipVRVerification)
+			require.NoError(t, e.Error(), c.vr)
+			want := append([]byte(nil), c.le...)
+			if bo == binary.BigEndian {
+				for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+					want[i], want[j] = want[j], want[i]
+				}
+			}
+			// Skip the 4-byte tag and the 4-byte implicit VL.
+			assert.Equal(t, want, e.Bytes()[8:], "%v %v", c.vr, bo)
+		}
+	}
+}
+
+func TestSignedVRRoundTrip(t *testing.T) {
+	for _, elem := range []*element.Element{
+		{Tag: dicomtag.PixelPaddingValue, VR: "SS", Value: []interface{}{int16(-1), int16(-32768), int16(32767), int16(0)}},
+		{Tag: dicomtag.ReferencePixelX0, VR: "SL", Value: []interface{}{int32(-1), int32(-2147483648), int32(2147483647)}},
+	} {
+		for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			e := dicomio.NewBytesEncoder(bo, dicomio.ExplicitVR)
+			write.Element(e, elem)
+			require.NoError(t, e.Error(), elem.VR)
+			d := dicomio.NewBytesDecoder(e.Bytes(), bo, dicomio.ExplicitVR)
+			elem2 := dicom.NewUninitializedParserFromDecoder(d, nil).ParseNext(dicom.ParseOptions{})
+			require.NoError(t, d.Error(), elem.VR)
+			assert.Equal(t, elem.Value, elem2.Value, "%v %v", elem.VR, bo)
+		}
+	}
+
+	// Unsigned values are not silently reinterpreted as signed ones.
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: dicomtag.PixelPaddingValue, VR: "SS", Value: []interface{}{uint16(0xffff)}})
+	assert.Error(t, e.Error())
+}
+
+// newTestDataSet returns a dataset with the required meta elements for the
+// given transfer syntax, followed by elems.
+func newTestDataSet(transferSyntaxUID string, elems ...*element.Element) *element.DataSet {
+	return &element.DataSet{Elements: append([]*element.Element{
+		element.MustNewElement(dicomtag.TransferSyntaxUID, transferSyntaxUID),
+		element.MustNewElement(dicomtag.MediaStorageSOPClassUID, "1.2.840.10008.5.1.4.1.1.7"),
+		element.MustNewElement(dicomtag.MediaStorageSOPInstanceUID, "1.2.3.4.5.6.7"),
+	}, elems...)}
+}
+
+// newItem returns an Item element holding elems.
+func newItem(undefinedLength bool, elems ...*element.Element) *element.Element {
+	item := &element.Element{Tag: dicomtag.Item, VR: "NA", UndefinedLength: undefinedLength}
+	for _, elem := range elems {
+		item.Value = append(item.Value, elem)
+	}
+	return item
+}
+
+func TestNestedSequenceRoundTrip(t *testing.T) {
+	for _, undefinedLength := range []bool{true, false} {
+		inner := element.MustNewElement(dicomtag.ReferencedSOPSequence,
+			newItem(undefinedLength,
+				element.MustNewElement(dicomtag.ReferencedSOPClassUID, "1.2.840.10008.5.1.4.1.1.2"),
+				element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3.4.5")))
+		inner.UndefinedLength = undefinedLength
+		outer := element.MustNewElement(dicomtag.ReferencedSeriesSequence,
+			newItem(undefinedLength,
+				element.MustNewElement(dicomtag.SeriesInstanceUID, "1.2.3"),
+				inner),
+			newItem(undefinedLength,
+				element.MustNewElement(dicomtag.SeriesInstanceUID, "1.2.4")))
+		outer.UndefinedLength = undefinedLength
+		ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, outer)
+
+		ds2 := mustRoundTrip(t, ds)
+		elem, err := ds2.FindElementByTag(dicomtag.ReferencedSeriesSequence)
+		require.NoError(t, err)
+		assert.Equal(t, outer.String(), elem.String())
+	}
+}
+
+func TestItemEncoding(t *testing.T) {
+	uid := element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3.4")
+	for _, undefinedLength := range []bool{true, false} {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, newItem(undefinedLength, uid))
+		require.NoError(t, e.Error())
+		data := e.Bytes()
+		// The (0008,1155) UI element takes 8 header bytes plus 8 value bytes.
+		vl := binary.LittleEndian.Uint32(data[4:8])
+		if undefinedLength {
+			assert.Equal(t, element.VLUndefinedLength, vl)
+			assert.Equal(t, 8+16+8, len(data))
+			assert.Equal(t, []byte{0xfe, 0xff, 0x0d, 0xe0, 0, 0, 0, 0}, data[len(data)-8:])
+		} else {
+			assert.Equal(t, uint32(16), vl)
+			assert.Equal(t, 8+16, len(data))
+		}
+
+		d := dicomio.NewBytesDecoder(data, binary.LittleEndian, dicomio.ExplicitVR)
+		p := dicom.NewUninitializedParserFromDecoder(d, nil)
+		item := p.ParseNext(dicom.ParseOptions{})
+		require.NoError(t, p.Finish())
+		assert.Equal(t, undefinedLength, item.UndefinedLength)
+		require.Len(t, item.Value, 1)
+		assert.Equal(t, uid.String(), item.Value[0].(*element.Element).String())
+	}
+}
+
+// newNativePixelDataSet returns a dataset holding native pixel data for the
+// given frames, along with the image attributes the parser needs to read it.
+func newNativePixelDataSet(rows, cols, bitsAllocated int, frames ...[][]int) *element.DataSet {
+	image := element.PixelDataInfo{}
+	for _, data := range frames {
+		image.Frames = append(image.Frames, frame.Frame{
+			NativeData: frame.NativeFrame{
+				Data:          data,
+				Rows:          rows,
+				Cols:          cols,
+				BitsPerSample: bitsAllocated,
+			},
+		})
+	}
+	return newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.SamplesPerPixel, uint16(1)),
+		element.MustNewElement(dicomtag.NumberOfFrames, fmt.Sprint(len(frames))),
+		element.MustNewElement(dicomtag.Rows, uint16(rows)),
+		element.MustNewElement(dicomtag.Columns, uint16(cols)),
+		element.MustNewElement(dicomtag.BitsAllocated, uint16(bitsAllocated)),
+		element.MustNewElement(dicomtag.PixelData, image))
+}
+
+func TestNativePixelDataRoundTrip(t *testing.T) {
+	// 3x3 8-bit pixels need a padding byte.
+	ds := newNativePixelDataSet(3, 3, 8,
+		[][]int{{0}, {1}, {2}, {3}, {4}, {5}, {6}, {7}, {255}})
+	ds2 := mustRoundTrip(t, ds)
+	elem, err := ds2.FindElementByTag(dicomtag.PixelData)
+	require.NoError(t, err)
+	got := elem.Value[0].(element.PixelDataInfo)
+	require.Len(t, got.Frames, 1)
+	assert.Equal(t, ds.Elements[len(ds.Elements)-1].Value[0].(element.PixelDataInfo).Frames[0].NativeData,
+		got.Frames[0].NativeData)
+
+	// Two 16-bit frames.
+	ds = newNativePixelDataSet(2, 1, 16, [][]int{{1}, {65535}}, [][]int{{300}, {4}})
+	ds2 = mustRoundTrip(t, ds)
+	elem, err = ds2.FindElementByTag(dicomtag.PixelData)
+	require.NoError(t, err)
+	assert.Equal(t, ds.Elements[len(ds.Elements)-1].Value[0], elem.Value[0])
+}
+
+func TestEncapsulatedPixelDataRoundTrip(t *testing.T) {
+	frames := [][]byte{
+		{0xff, 0xd8, 0x01, 0x02, 0xff, 0xd9},
+		{0xff, 0xd8, 0x03, 0x04, 0x05, 0x06, 0xff, 0xd9},
+	}
+	image := element.PixelDataInfo{IsEncapsulated: true, Offsets: []uint32{0, 14}}
+	for _, data := range frames {
+		image.Frames = append(image.Frames, frame.Frame{
+			Encapsulated:     true,
+			EncapsulatedData: frame.EncapsulatedFrame{Data: data},
+		})
+	}
+	// UndefinedLength is left unset; IsEncapsulated alone selects the encapsulated encoding.
+	ds := newTestDataSet("1.2.840.10008.1.2.4.50" /* JPEG Baseline */, element.MustNewElement(dicomtag.PixelData, image))
+	ds2 := mustRoundTrip(t, ds)
+	elem, err := ds2.FindElementByTag(dicomtag.PixelData)
+	require.NoError(t, err)
+	assert.True(t, elem.UndefinedLength)
+	got := elem.Value[0].(element.PixelDataInfo)
+	assert.Equal(t, image.Offsets, got.Offsets)
+	require.Len(t, got.Frames, len(frames))
+	for i, data := range frames {
+		assert.Equal(t, data, got.Frames[i].EncapsulatedData.Data)
+	}
+}
+
+func TestBasicOffsetTable(t *testing.T) {
+	frames := [][]byte{
+		{0xff, 0xd8, 0x01, 0xff, 0xd9}, // padded to 6 bytes
+		{0xff, 0xd8, 0x02, 0x03, 0xff, 0xd9},
+		{0xff, 0xd8, 0x04, 0x05, 0x06, 0x07, 0xff, 0xd9},
+	}
+	image := element.PixelDataInfo{IsEncapsulated: true}
+	for _, data := range frames {
+		image.Frames = append(image.Frames, frame.Frame{
+			Encapsulated:     true,
+			EncapsulatedData: frame.EncapsulatedFrame{Data: data},
+		})
+	}
+	pixelData := element.MustNewElement(dicomtag.PixelData, image)
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, pixelData)
+	require.NoError(t, e.Error())
+	data := e.Bytes()
+
+	// Header(12), then the BOT item with three offsets.
+	bot := data[12:]
+	require.Equal(t, uint32(12), binary.LittleEndian.Uint32(bot[4:8]))
+	var offsets []uint32
+	for i := 0; i < 3; i++ {
+		offsets = append(offsets, binary.LittleEndian.Uint32(bot[8+4*i:]))
+	}
+	assert.Equal(t, []uint32{0, 14, 28}, offsets)
+	fragments := bot[20:]
+	for i, offset := range offsets {
+		// Each offset points at the Item tag of the frame's fragment.
+		assert.Equal(t, []byte{0xfe, 0xff, 0x00, 0xe0}, fragments[offset:offset+4])
+		assert.Equal(t, frames[i], fragments[offset+8:offset+8+uint32(len(frames[i]))])
+	}
+
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, pixelData, write.EmptyBasicOffsetTable)
+	require.NoError(t, e.Error())
+	assert.Equal(t, []byte{0xfe, 0xff, 0x00, 0xe0, 0, 0, 0, 0}, e.Bytes()[12:20])
+}
+
+func TestFileHeaderDerivedFromDataSet(t *testing.T) {
+	ds := &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.TransferSyntaxUID, dicomuid.ImplicitVRLittleEndian),
+		element.MustNewElement(dicomtag.SOPClassUID, "1.2.840.10008.5.1.4.1.1.7"),
+		element.MustNewElement(dicomtag.SOPInstanceUID, "1.2.3.4.5.6.7"),
+	}}
+	ds2 := mustRoundTrip(t, ds)
+	for tag, want := range map[dicomtag.Tag]string{
+		dicomtag.MediaStorageSOPClassUID:    "1.2.840.10008.5.1.4.1.1.7",
+		dicomtag.MediaStorageSOPInstanceUID: "1.2.3.4.5.6.7",
+		dicomtag.TransferSyntaxUID:          dicomuid.ImplicitVRLittleEndian,
+		dicomtag.ImplementationClassUID:     constants.GoDICOMImplementationClassUID,
+		dicomtag.ImplementationVersionName:  constants.GoDICOMImplementationVersionName,
+		dicomtag.SOPInstanceUID:             "1.2.3.4.5.6.7",
+	} {
+		elem, err := ds2.FindElementByTag(tag)
+		require.NoError(t, err, dicomtag.DebugString(tag))
+		assert.Equal(t, want, elem.MustGetString(), dicomtag.DebugString(tag))
+	}
+
+	// Without SOP UIDs anywhere, the header can't be written.
+	ds.Elements = ds.Elements[:1]
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, ds))
+}
+
+func TestFileHeaderPartlyDerivedFromDataSet(t *testing.T) {
+	// The meta group has the instance UID, but the class UID only comes from
+	// the main dataset.
+	ds := &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.TransferSyntaxUID, dicomuid.ExplicitVRLittleEndian),
+		element.MustNewElement(dicomtag.MediaStorageSOPInstanceUID, "1.2.3.4"),
+		element.MustNewElement(dicomtag.SOPClassUID, "1.2.840.10008.5.1.4.1.1.7"),
+		element.MustNewElement(dicomtag.SOPInstanceUID, "1.2.3.4.5.6.7"),
+	}}
+	ds2 := mustRoundTrip(t, ds)
+	for tag, want := range map[dicomtag.Tag]string{
+		dicomtag.MediaStorageSOPClassUID: "1.2.840.10008.5.1.4.1.1.7",
+		// The meta version wins over SOPInstanceUID.
+		dicomtag.MediaStorageSOPInstanceUID: "1.2.3.4",
+	} {
+		elem, err := ds2.FindElementByTag(tag)
+		require.NoError(t, err, dicomtag.DebugString(tag))
+		assert.Equal(t, want, elem.MustGetString(), dicomtag.DebugString(tag))
+	}
+
+	// Only the UID missing from both sources is reported.
+	ds.Elements = ds.Elements[:2]
+	var out bytes.Buffer
+	err := write.DataSet(&out, ds)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "MediaStorageSOPClassUID")
+	assert.NotContains(t, err.Error(), "MediaStorageSOPInstanceUID")
+}
+
+func TestDefaultFileMetaInformationVersion(t *testing.T) {
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian)
+	_, err := ds.FindElementByTag(dicomtag.FileMetaInformationVersion)
+	require.Error(t, err)
+	ds2 := mustRoundTrip(t, ds)
+	elem, err := ds2.FindElementByTag(dicomtag.FileMetaInformationVersion)
+	require.NoError(t, err)
+	assert.Equal(t, "OB", elem.VR)
+	assert.Equal(t, []interface{}{[]byte{0x00, 0x01}}, elem.Value)
+
+	// A given version is kept.
+	ds.Elements = append(ds.Elements, element.MustNewElement(dicomtag.FileMetaInformationVersion, []byte{0x00, 0x02}))
+	ds2 = mustRoundTrip(t, ds)
+	elem, err = ds2.FindElementByTag(dicomtag.FileMetaInformationVersion)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte{0x00, 0x02}}, elem.Value)
+}
+
+func TestFileMetaInformationGroupLength(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, newTestDataSet(dicomuid.ImplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.PatientName, "Doe^John"))))
+	data := out.Bytes()
+	require.Equal(t, "DICM", string(data[128:132]))
+	// (0002,0000) UL 0004 <length>
+	assert.Equal(t, []byte{0x02, 0x00, 0x00, 0x00, 'U', 'L', 0x04, 0x00}, data[132:140])
+	groupLength := int(binary.LittleEndian.Uint32(data[140:144]))
+
+	// Walk the explicit-VR meta elements that follow and measure their size.
+	metaEnd := 144
+	for binary.LittleEndian.Uint16(data[metaEnd:]) == dicomtag.MetadataGroup {
+		vr := string(data[metaEnd+4 : metaEnd+6])
+		if vr == "OB" || vr == "UN" || vr == "SQ" {
+			metaEnd += 12 + int(binary.LittleEndian.Uint32(data[metaEnd+8:]))
+		} else {
+			metaEnd += 8 + int(binary.LittleEndian.Uint16(data[metaEnd+6:]))
+		}
+	}
+	assert.Equal(t, metaEnd-144, groupLength)
+}
+
+func TestFileMetaInformationGroupLengthDecodes(t *testing.T) {
+	for _, test := range []struct {
+		uid        string
+		patientTag []byte // PatientName, as encoded in the body.
+	}{
+		{dicomuid.ExplicitVRLittleEndian, []byte{0x10, 0x00, 0x10, 0x00}},
+		{dicomuid.ImplicitVRLittleEndian, []byte{0x10, 0x00, 0x10, 0x00}},
+		{dicomuid.ExplicitVRBigEndian, []byte{0x00, 0x10, 0x00, 0x10}},
+	} {
+		var out bytes.Buffer
+		require.NoError(t, write.DataSet(&out, newTestDataSet(test.uid,
+			element.MustNewElement(dicomtag.PatientName, "Doe^John"))))
+		data := out.Bytes()
+		bodyStart := bytes.Index(data, test.patientTag)
+		require.True(t, bodyStart > 144, test.uid)
+
+		// The first meta element reads back as a UL holding the length of
+		// the elements that follow it, up to the body.
+		d := dicomio.NewBytesDecoder(data[132:], binary.LittleEndian, dicomio.ExplicitVR)
+		assert.Equal(t, dicomtag.FileMetaInformationGroupLength, dicomtag.Tag{Group: d.ReadUInt16(), Element: d.ReadUInt16()}, test.uid)
+		assert.Equal(t, "UL", d.ReadString(2), test.uid)
+		assert.Equal(t, uint16(4), d.ReadUInt16(), test.uid)
+		assert.Equal(t, uint32(bodyStart-144), d.ReadUInt32(), test.uid)
+		require.NoError(t, d.Error())
+
+		p, err := dicom.NewParserFromBytes(data, nil)
+		require.NoError(t, err)
+		ds, err := p.Parse(dicom.ParseOptions{})
+		require.NoError(t, err)
+		elem := ds.Elements[0]
+		assert.Equal(t, dicomtag.FileMetaInformationGroupLength, elem.Tag, test.uid)
+		assert.Equal(t, "UL", elem.VR, test.uid)
+		assert.Equal(t, []interface{}{uint32(bodyStart - 144)}, elem.Value, test.uid)
+	}
+}
+
+func TestMetaGroupStaysExplicitLittleEndian(t *testing.T) {
+	for _, uid := range []string{dicomuid.ImplicitVRLittleEndian, dicomuid.ExplicitVRBigEndian} {
+		var out bytes.Buffer
+		ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, element.MustNewElement(dicomtag.PatientName, "Doe^John"))
+		require.NoError(t, write.DataSet(&out, ds, write.WithTransferSyntax(uid)))
+		data := out.Bytes()
+
+		// Every meta element has a little-endian tag, followed by the VR from
+		// the dictionary.
+		metaEnd := 132
+		for binary.LittleEndian.Uint16(data[metaEnd:]) == dicomtag.MetadataGroup {
+			tag := dicomtag.Tag{Group: dicomtag.MetadataGroup, Element: binary.LittleEndian.Uint16(data[metaEnd+2:])}
+			entry, err := dicomtag.Find(tag)
+			require.NoError(t, err, uid)
+			vr := string(data[metaEnd+4 : metaEnd+6])
+			require.Equal(t, entry.VR, vr, "%v %v", uid, dicomtag.DebugString(tag))
+			if vr == "OB" {
+				metaEnd += 12 + int(binary.LittleEndian.Uint32(data[metaEnd+8:]))
+			} else {
+				metaEnd += 8 + int(binary.LittleEndian.Uint16(data[metaEnd+6:]))
+			}
+		}
+		// The body follows in the transfer syntax given.
+		if uid == dicomuid.ImplicitVRLittleEndian {
+			assert.Equal(t, []byte{0x10, 0x00, 0x10, 0x00, 0x08, 0x00, 0x00, 0x00}, data[metaEnd:metaEnd+8])
+		} else {
+			assert.Equal(t, []byte{0x00, 0x10, 0x00, 0x10, 'P', 'N', 0x00, 0x08}, data[metaEnd:metaEnd+8])
+		}
+	}
+}
+
+func TestWithTransferSyntax(t *testing.T) {
+	p, err := dicom.NewParserFromFile("../examples/CT-MONO2-16-ort.dcm", nil)
+	require.NoError(t, err)
+	ds, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	orig, err := ds.FindElementByTag(dicomtag.TransferSyntaxUID)
+	require.NoError(t, err)
+	origUID := orig.MustGetString()
+	for _, uid := range []string{dicomuid.ExplicitVRLittleEndian, dicomuid.ExplicitVRBigEndian} {
+		ds2 := mustRoundTrip(t, ds, write.WithTransferSyntax(uid))
+		require.Equal(t, len(ds.Elements), len(ds2.Elements))
+		for i, elem := range ds.Elements {
+			switch elem.Tag {
+			case dicomtag.FileMetaInformationGroupLength:
+			case dicomtag.TransferSyntaxUID:
+				assert.Equal(t, uid, ds2.Elements[i].MustGetString())
+			default:
+				assert.Equal(t, elem.String(), ds2.Elements[i].String())
+			}
+		}
+	}
+	// The input dataset itself is left untouched.
+	assert.Equal(t, origUID, orig.MustGetString())
+
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, ds, write.WithTransferSyntax("1.2.3.4")))
+	assert.Error(t, write.DataSet(&out, ds, write.WithTransferSyntax(dicomuid.VerificationSOPClass)))
+}
+
+func TestWithTransferSyntaxLabel(t *testing.T) {
+	const jpegBaseline = "1.2.840.10008.1.2.4.50"
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, element.MustNewElement(dicomtag.PatientName, "Foo^Bar"))
+	var want, out bytes.Buffer
+	require.NoError(t, write.DataSet(&want, ds))
+	require.NoError(t, write.DataSet(&out, ds, write.WithTransferSyntaxLabel(jpegBaseline)))
+	p, err := dicom.NewParserFromBytes(out.Bytes(), nil)
+	require.NoError(t, err)
+	ds2, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	elem, err := ds2.FindElementByTag(dicomtag.TransferSyntaxUID)
+	require.NoError(t, err)
+	assert.Equal(t, jpegBaseline, elem.MustGetString())
+	// The elements are still encoded in Explicit VR Little Endian.
+	assert.Equal(t, want.Bytes()[len(want.Bytes())-16:], out.Bytes()[len(out.Bytes())-16:])
+
+	assert.Error(t, write.DataSet(&out, ds, write.WithTransferSyntaxLabel("1.2.3.4")))
+	assert.Error(t, write.DataSet(&out, ds, write.WithTransferSyntaxLabel(dicomuid.VerificationSOPClass)))
+}
+
+func TestWithTransferSyntaxLabelMismatch(t *testing.T) {
+	// A malformed file whose header claims Explicit VR Little Endian, while
+	// its body is in Implicit VR Little Endian.
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, element.MustNewElement(dicomtag.PatientName, "Foo^Bar"))
+	var implicit, out bytes.Buffer
+	require.NoError(t, write.DataSet(&implicit, ds, write.ForceImplicitVR))
+	require.NoError(t, write.DataSet(&out, ds, write.ForceImplicitVR, write.WithTransferSyntaxLabel(dicomuid.ExplicitVRLittleEndian)))
+
+	p, err := dicom.NewParserFromBytes(implicit.Bytes(), nil)
+	require.NoError(t, err)
+	ds2, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	groupLength, err := ds2.GetInt(dicomtag.FileMetaInformationGroupLength)
+	require.NoError(t, err)
+	// Preamble, "DICM", and the FileMetaInformationGroupLength element.
+	metaLength := 128 + 4 + 12 + int(groupLength)
+	assert.True(t, bytes.HasSuffix(out.Bytes(), implicit.Bytes()[metaLength:]))
+
+	p, err = dicom.NewParserFromBytes(out.Bytes(), nil)
+	require.NoError(t, err)
+	ds3, err := p.Parse(dicom.ParseOptions{})
+	if err == nil {
+		_, err = ds3.FindElementByTag(dicomtag.PatientName)
+	}
+	assert.Error(t, err)
+}
+
+func TestPadding(t *testing.T) {
+	cases := []struct {
+		elem *element.Element
+		want []byte // expected value bytes
+	}{
+		{element.MustNewElement(dicomtag.PatientName, "Foo"), []byte("Foo ")},
+		{element.MustNewElement(dicomtag.Modality, "CTX"), []byte("CTX ")},
+		{element.MustNewElement(dicomtag.SOPInstanceUID, "1.2.3"), []byte("1.2.3\x00")},
+		{element.MustNewElement(dicomtag.EncapsulatedDocument, []byte{1, 2, 3}), []byte{1, 2, 3, 0}},
+	}
+	for _, c := range cases {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ImplicitVR)
+		write.Element(e, c.elem)
+		require.NoError(t, e.Error())
+		// Skip the 4-byte tag and the 4-byte implicit VL.
+		assert.Equal(t, c.want, e.Bytes()[8:], dicomtag.DebugString(c.elem.Tag))
+
+		e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ImplicitVR)
+		write.Element(e, c.elem, write.StrictPadding)
+		assert.Error(t, e.Error(), dicomtag.DebugString(c.elem.Tag))
+	}
+}
+
+func TestEncapsulatedFragmentPadding(t *testing.T) {
+	image := element.PixelDataInfo{
+		IsEncapsulated: true,
+		Frames: []frame.Frame{{
+			Encapsulated:     true,
+			EncapsulatedData: frame.EncapsulatedFrame{Data: []byte{1, 2, 3}},
+		}},
+	}
+	ds := newTestDataSet("1.2.840.10008.1.2.4.50" /* JPEG Baseline */, element.MustNewElement(dicomtag.PixelData, image))
+	ds2 := mustRoundTrip(t, ds)
+	elem, err := ds2.FindElementByTag(dicomtag.PixelData)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 0}, elem.Value[0].(element.PixelDataInfo).Frames[0].EncapsulatedData.Data)
+
+	ds = newNativePixelDataSet(1, 3, 8, [][]int{{1}, {2}, {3}})
+	var out bytes.Buffer
+	assert.NoError(t, write.DataSet(&out, ds))
+	assert.Error(t, write.DataSet(&out, ds, write.StrictPadding))
+}
+
+func TestAmbiguousVR(t *testing.T) {
+	for _, vr := range []string{"US", "SS"} {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		elem := &element.Element{Tag: dicomtag.SmallestImagePixelValue, VR: vr}
+		if vr == "US" {
+			elem.Value = []interface{}{uint16(10)}
+		} else {
+			elem.Value = []interface{}{int16(-10)}
+		}
+		write.Element(e, elem)
+		require.NoError(t, e.Error(), vr)
+		d := dicomio.NewBytesDecoder(e.Bytes(), binary.LittleEndian, dicomio.ExplicitVR)
+		elem2 := dicom.NewUninitializedParserFromDecoder(d, nil).ParseNext(dicom.ParseOptions{})
+		require.NoError(t, d.Error())
+		assert.Equal(t, elem.VR, elem2.VR)
+		assert.Equal(t, elem.Value, elem2.Value)
+	}
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: dicomtag.SmallestImagePixelValue, VR: "FL", Value: []interface{}{float32(1)}})
+	assert.Error(t, e.Error())
+}
+
+func TestForceImplicitVR(t *testing.T) {
+	ds := newNativePixelDataSet(2, 2, 16, [][]int{{1}, {2}, {3}, {4}})
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds, write.ForceImplicitVR))
+	data := out.Bytes()
+
+	p, err := dicom.NewParserFromBytes(data, nil)
+	require.NoError(t, err)
+	ds2, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	elem, err := ds2.FindElementByTag(dicomtag.TransferSyntaxUID)
+	require.NoError(t, err)
+	assert.Equal(t, dicomuid.ImplicitVRLittleEndian, elem.MustGetString())
+	elem, err = ds2.FindElementByTag(dicomtag.PixelData)
+	require.NoError(t, err)
+	assert.Equal(t, ds.Elements[len(ds.Elements)-1].Value, elem.Value)
+
+	// The body starts right after the meta group, with (0028,0002) followed by
+	// a 4-byte VL and no VR.
+	body := data[144+int(binary.LittleEndian.Uint32(data[140:144])):]
+	assert.Equal(t, []byte{0x28, 0x00, 0x02, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0x00}, body[:10])
+}
+
+func TestAttributeTagRoundTrip(t *testing.T) {
+	pointers := element.MustNewElement(dicomtag.FrameIncrementPointer,
+		dicomtag.FrameTime, dicomtag.Tag{Group: 0x0008, Element: 0x0000})
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		e := dicomio.NewBytesEncoder(bo, dicomio.ExplicitVR)
+		write.Element(e, pointers)
+		require.NoError(t, e.Error())
+		data := e.Bytes()
+		assert.Equal(t, dicomtag.FrameTime.Group, bo.Uint16(data[8:]))
+		assert.Equal(t, dicomtag.FrameTime.Element, bo.Uint16(data[10:]))
+
+		d := dicomio.NewBytesDecoder(data, bo, dicomio.ExplicitVR)
+		elem := dicom.NewUninitializedParserFromDecoder(d, nil).ParseNext(dicom.ParseOptions{})
+		require.NoError(t, d.Error())
+		assert.Equal(t, pointers.Value, elem.Value)
+	}
+}
+
+func TestByteVRs(t *testing.T) {
+	lut := &element.Element{Tag: dicomtag.LUTData, VR: "OW", Value: []interface{}{[]byte{0x01, 0x02, 0x03, 0x04}}}
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		e := dicomio.NewBytesEncoder(bo, dicomio.ExplicitVR)
+		write.Element(e, lut)
+		require.NoError(t, e.Error())
+		data := e.Bytes()
+		// OW values are stored in native byte order and written as 16-bit words.
+		assert.Equal(t, binary.LittleEndian.Uint16([]byte{0x01, 0x02}), bo.Uint16(data[12:]))
+		assert.Equal(t, binary.LittleEndian.Uint16([]byte{0x03, 0x04}), bo.Uint16(data[14:]))
+
+		d := dicomio.NewBytesDecoder(data, bo, dicomio.ExplicitVR)
+		elem := dicom.NewUninitializedParserFromDecoder(d, nil).ParseNext(dicom.ParseOptions{})
+		require.NoError(t, d.Error())
+		assert.Equal(t, lut.Value, elem.Value)
+	}
+
+	// OB values of odd length are padded with a zero byte.
+	private := dicomtag.Tag{Group: 0x0009, Element: 0x1010}
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: private, VR: "OB", Value: []interface{}{[]byte{1, 2, 3}}})
+	require.NoError(t, e.Error())
+	assert.Equal(t, []byte{0x09, 0x00, 0x10, 0x10, 'O', 'B', 0, 0, 4, 0, 0, 0, 1, 2, 3, 0}, e.Bytes())
+
+	// OW values are made of 16-bit words, so an odd length is a bug in the
+	// data rather than something to pad.
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: dicomtag.LUTData, VR: "OW", Value: []interface{}{[]byte{1, 2, 3}}})
+	assert.Error(t, e.Error())
+}
+
+func TestStringVRs(t *testing.T) {
+	for _, tc := range []struct {
+		tag   dicomtag.Tag
+		vr    string
+		value []interface{}
+		want  string
+	}{
+		{dicomtag.RetrieveAETitle, "AE", []interface{}{"STORESCP"}, "STORESCP"},
+		{dicomtag.PatientAge, "AS", []interface{}{"042Y"}, "042Y"},
+		{dicomtag.ImageType, "CS", []interface{}{"ORIGINAL", "PRIMARY", "AXIAL"}, "ORIGINAL\\PRIMARY\\AXIAL"},
+		{dicomtag.StudyDate, "DA", []interface{}{"20180102"}, "20180102"},
+		{dicomtag.PixelSpacing, "DS", []interface{}{"0.5", "0.25"}, "0.5\\0.25"},
+		{dicomtag.AcquisitionDateTime, "DT", []interface{}{"20180102030405"}, "20180102030405"},
+		{dicomtag.InstanceNumber, "IS", []interface{}{"1"}, "1 "},
+		{dicomtag.InstitutionName, "LO", []interface{}{"General"}, "General "},
+		{dicomtag.AdditionalPatientHistory, "LT", []interface{}{"No history"}, "No history"},
+		{dicomtag.PatientName, "PN", []interface{}{"Doe^John"}, "Doe^John"},
+		{dicomtag.StationName, "SH", []interface{}{"CT01"}, "CT01"},
+		{dicomtag.DerivationDescription, "ST", []interface{}{"Resampled"}, "Resampled "},
+		{dicomtag.StudyTime, "TM", []interface{}{"101112"}, "101112"},
+		{dicomtag.Tag{Group: 0x0009, Element: 0x1010}, "UC", []interface{}{"extra"}, "extra "},
+		{dicomtag.SOPInstanceUID, "UI", []interface{}{"1.2.3"}, "1.2.3\x00"},
+		{dicomtag.Tag{Group: 0x0009, Element: 0x1011}, "UR", []interface{}{"http://x/"}, "http://x/ "},
+		{dicomtag.TextValue, "UT", []interface{}{"Some text"}, "Some text "},
+	} {
+		for _, implicit := range []dicomio.IsImplicitVR{dicomio.ImplicitVR, dicomio.ExplicitVR} {
+			e := dicomio.NewBytesEncoder(binary.LittleEndian, implicit)
+			write.Element(e, &element.Element{Tag: tc.tag, VR: tc.vr, Value: tc.value})
+			require.NoError(t, e.Error(), tc.vr)
+			data := e.Bytes()
+			assert.Equal(t, tc.want, string(data[len(data)-len(tc.want):]), tc.vr)
+
+			d := dicomio.NewBytesDecoder(data, binary.LittleEndian, implicit)
+			elem := dicom.NewUninitializedParserFromDecoder(d, nil).ParseNext(dicom.ParseOptions{})
+			require.NoError(t, d.Error(), tc.vr)
+			if implicit == dicomio.ExplicitVR {
+				assert.Equal(t, tc.vr, elem.VR)
+			}
+			if tc.vr != "LT" && tc.vr != "UT" {
+				assert.Equal(t, tc.value, elem.Value, tc.vr)
+			}
+		}
+	}
+
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: dicomtag.PatientName, VR: "PN", Value: []interface{}{"Doe^John", 1}})
+	assert.Error(t, e.Error())
+
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: dicomtag.DerivationDescription, VR: "ST", Value: []interface{}{string(make([]byte, 0x10000))}})
+	assert.Error(t, e.Error())
+}
+
+func TestPersonName(t *testing.T) {
+	name := element.PersonName{
+		Alphabetic:  element.PersonNameGroup{FamilyName: "Yamada", GivenName: "Tarou"},
+		Ideographic: element.PersonNameGroup{FamilyName: "山田", GivenName: "太郎"},
+		Phonetic:    element.PersonNameGroup{FamilyName: "やまだ", GivenName: "たろう"},
+	}
+	for _, charset := range []string{"ISO_IR 192", "ISO 2022 IR 87"} {
+		ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+			element.MustNewElement(dicomtag.SpecificCharacterSet, charset),
+			element.MustNewElement(dicomtag.PatientName, name))
+		var out bytes.Buffer
+		require.NoError(t, write.DataSet(&out, ds))
+		p, err := dicom.NewParserFromBytes(out.Bytes(), nil)
+		require.NoError(t, err)
+		ds2, err := p.Parse(dicom.ParseOptions{})
+		require.NoError(t, err)
+		elem, err := ds2.FindElementByTag(dicomtag.PatientName)
+		require.NoError(t, err)
+		s := elem.MustGetString()
+		assert.Equal(t, name.String(), strings.TrimRight(s, " "), charset)
+		assert.Equal(t, name, element.ParsePersonName(s), charset)
+	}
+}
+
+func TestUIDPadding(t *testing.T) {
+	uid := "1.2.840.10008.5.1.4.1.1.7" // odd length
+	require.Equal(t, 1, len(uid)%2)
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, element.MustNewElement(dicomtag.SOPClassUID, uid))
+	require.NoError(t, e.Error())
+	data := e.Bytes()
+	// Tag(4) + VR(2) + VL(2) + value.
+	vl := binary.LittleEndian.Uint16(data[6:8])
+	assert.Equal(t, uint16(len(uid)+1), vl)
+	assert.Equal(t, 8+int(vl), len(data))
+	assert.Equal(t, byte(0), data[len(data)-1])
+
+	d := dicomio.NewBytesDecoder(data, binary.LittleEndian, dicomio.ExplicitVR)
+	elem := dicom.NewUninitializedParserFromDecoder(d, nil).ParseNext(dicom.ParseOptions{})
+	require.NoError(t, d.Error())
+	assert.Equal(t, []interface{}{uid}, elem.Value)
+}
+
+func TestWithMaxElementLength(t *testing.T) {
+	huge := element.MustNewElement(dicomtag.EncapsulatedDocument, make([]byte, 1024))
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, huge, write.WithMaxElementLength(1023))
+	assert.Error(t, e.Error())
+
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, huge, write.WithMaxElementLength(1024))
+	assert.NoError(t, e.Error())
+
+	// The limit applies to elements nested in sequences, too.
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		&element.Element{
+			Tag:             dicomtag.ReferencedImageSequence,
+			VR:              "SQ",
+			UndefinedLength: true,
+			Value:           []interface{}{newItem(true, huge)},
+		})
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, ds, write.WithMaxElementLength(512)))
+	out.Reset()
+	assert.NoError(t, write.DataSet(&out, ds, write.WithMaxElementLength(2048)))
+
+	// So does native pixel data, which is encoded straight to the output.
+	pixels := make([][]int, 16*16)
+	for i := range pixels {
+		pixels[i] = []int{i}
+	}
+	ds = newNativePixelDataSet(16, 16, 16, pixels)
+	out.Reset()
+	assert.Error(t, write.DataSet(&out, ds, write.WithMaxElementLength(256)))
+
+	// And to the Basic Offset Table item, here of 3 offsets for fragments of
+	// 2 bytes.
+	encapsulated := element.PixelDataInfo{IsEncapsulated: true}
+	for i := 0; i < 3; i++ {
+		encapsulated.Frames = append(encapsulated.Frames, frame.Frame{
+			Encapsulated:     true,
+			EncapsulatedData: frame.EncapsulatedFrame{Data: []byte{1, 2}},
+		})
+	}
+	pixelData := element.MustNewElement(dicomtag.PixelData, encapsulated)
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, pixelData, write.WithMaxElementLength(8))
+	assert.Error(t, e.Error())
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, pixelData, write.WithMaxElementLength(12))
+	assert.NoError(t, e.Error())
+}
+
+func TestDeflatedExplicitVRLittleEndian(t *testing.T) {
+	p, err := dicom.NewParserFromFile("../examples/CT-MONO2-16-ort.dcm", nil)
+	require.NoError(t, err)
+	ds, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds, write.WithTransferSyntax(dicomuid.DeflatedExplicitVRLittleEndian)))
+	data := out.Bytes()
+
+	// The meta group is written as is, and the rest is deflated.
+	headerLen := 144 + int(binary.LittleEndian.Uint32(data[140:144]))
+	body, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data[headerLen:])))
+	require.NoError(t, err)
+	inflated := append(data[:headerLen:headerLen], body...)
+	assert.True(t, len(inflated) > len(data))
+
+	p, err = dicom.NewParserFromBytes(inflated, nil)
+	require.NoError(t, err)
+	ds2, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	require.Equal(t, len(ds.Elements), len(ds2.Elements))
+	for i, elem := range ds.Elements {
+		switch elem.Tag {
+		case dicomtag.FileMetaInformationGroupLength:
+		case dicomtag.TransferSyntaxUID:
+			assert.Equal(t, dicomuid.DeflatedExplicitVRLittleEndian, ds2.Elements[i].MustGetString())
+		default:
+			assert.Equal(t, elem.String(), ds2.Elements[i].String())
+		}
+	}
+}
+
+func TestDataSetBody(t *testing.T) {
+	ds := newNativePixelDataSet(2, 2, 16, [][]int{{1}, {2}, {3}, {4}})
+	var file, body bytes.Buffer
+	require.NoError(t, write.DataSet(&file, ds))
+	require.NoError(t, write.DataSetBody(&body, ds))
+	// The body is the file without the preamble, the "DICM" magic and the
+	// meta group.
+	data := file.Bytes()
+	headerLen := 144 + int(binary.LittleEndian.Uint32(data[140:144]))
+	assert.Equal(t, data[headerLen:], body.Bytes())
+
+	// Options with spare capacity aren't overwritten.
+	opts := make([]write.Option, 1, 3)
+	opts[0] = write.KeepElementOrder
+	body.Reset()
+	require.NoError(t, write.DataSetBody(&body, ds, opts...))
+	assert.Nil(t, opts[:3][1])
+	assert.Equal(t, data[headerLen:], body.Bytes())
+
+	// Without a meta group, the transfer syntax can be given as an option.
+	noMeta := &element.DataSet{Elements: ds.Elements[1:]}
+	require.Equal(t, dicomtag.TransferSyntaxUID, ds.Elements[0].Tag)
+	body.Reset()
+	assert.Error(t, write.DataSetBody(&body, noMeta))
+	body.Reset()
+	require.NoError(t, write.DataSetBody(&body, noMeta, write.ForceImplicitVR))
+	d := dicomio.NewBytesDecoder(body.Bytes(), binary.LittleEndian, dicomio.ImplicitVR)
+	p := dicom.NewUninitializedParserFromDecoder(d, nil)
+	elem := p.ParseNext(dicom.ParseOptions{})
+	require.NoError(t, d.Error())
+	assert.Equal(t, dicomtag.SamplesPerPixel, elem.Tag)
+}
+
+func TestCommandSet(t *testing.T) {
+	// A C-STORE-RQ, given out of order.
+	elems := []*element.Element{
+		element.MustNewElement(dicomtag.AffectedSOPInstanceUID, "1.2.3.4"),
+		element.MustNewElement(dicomtag.AffectedSOPClassUID, "1.2.840.10008.5.1.4.1.1.7"),
+		element.MustNewElement(dicomtag.CommandField, uint16(0x0001)),
+		element.MustNewElement(dicomtag.MessageID, uint16(7)),
+		element.MustNewElement(dicomtag.Priority, uint16(0)),
+		element.MustNewElement(dicomtag.CommandDataSetType, uint16(0x0000)),
+		element.MustNewElement(dicomtag.CommandGroupLength, uint32(1)), // Recomputed.
+	}
+	var out bytes.Buffer
+	require.NoError(t, write.CommandSet(&out, elems))
+	data := out.Bytes()
+	// (0000,0000), without a VR, holding the length of the rest.
+	assert.Equal(t, []byte{0, 0, 0, 0, 4, 0, 0, 0}, data[:8])
+	assert.Equal(t, uint32(len(data)-12), binary.LittleEndian.Uint32(data[8:]))
+	// AffectedSOPClassUID comes first, padded with a zero byte.
+	assert.Equal(t, append([]byte{0, 0, 2, 0, 26, 0, 0, 0}, "1.2.840.10008.5.1.4.1.1.7\x00"...), data[12:46])
+
+	d := dicomio.NewBytesDecoder(data, binary.LittleEndian, dicomio.ImplicitVR)
+	p := dicom.NewUninitializedParserFromDecoder(d, nil)
+	var tags []dicomtag.Tag
+	for d.Len() > 0 {
+		elem := p.ParseNext(dicom.ParseOptions{})
+		require.NoError(t, d.Error())
+		tags = append(tags, elem.Tag)
+		if elem.Tag == dicomtag.CommandField {
+			assert.Equal(t, []interface{}{uint16(0x0001)}, elem.Value)
+		}
+	}
+	assert.Equal(t, []dicomtag.Tag{
+		dicomtag.CommandGroupLength,
+		dicomtag.AffectedSOPClassUID,
+		dicomtag.CommandField,
+		dicomtag.MessageID,
+		dicomtag.Priority,
+		dicomtag.CommandDataSetType,
+		dicomtag.AffectedSOPInstanceUID,
+	}, tags)
+
+	assert.Error(t, write.CommandSet(&out, []*element.Element{element.MustNewElement(dicomtag.PatientName, "Foo")}))
+}
+
+func TestExplicitVRBigEndianRoundTrip(t *testing.T) {
+	ds := newNativePixelDataSet(2, 2, 16, [][]int{{1}, {0x0102}, {3}, {0xfffe}})
+	ds.Elements = append(ds.Elements,
+		&element.Element{Tag: dicomtag.PixelPaddingValue, VR: "SS", Value: []interface{}{int16(-2)}},
+		element.MustNewElement(dicomtag.SimpleFrameList, uint32(0x01020304), uint32(5)),
+		element.MustNewElement(dicomtag.ReferencePixelX0, int32(-2)),
+		element.MustNewElement(dicomtag.RecommendedDisplayFrameRateInFloat, float32(1.5)),
+		element.MustNewElement(dicomtag.EventTimeOffset, float64(-0.25)),
+		element.MustNewElement(dicomtag.FrameIncrementPointer, dicomtag.FrameTime),
+		&element.Element{Tag: dicomtag.LUTData, VR: "OW", Value: []interface{}{[]byte{1, 2, 3, 4}}},
+		element.MustNewElement(dicomtag.PatientName, "Doe^John"))
+	ds.Elements[0] = element.MustNewElement(dicomtag.TransferSyntaxUID, dicomuid.ExplicitVRBigEndian)
+
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds))
+	data := out.Bytes()
+	// The meta group is always little endian; the body is big endian, starting
+	// with (0008,1161) UL 0x01020304.
+	headerLen := 144 + int(binary.LittleEndian.Uint32(data[140:144]))
+	assert.Equal(t, []byte{0x00, 0x08, 0x11, 0x61, 'U', 'L', 0x00, 0x08, 0x01, 0x02, 0x03, 0x04}, data[headerLen:headerLen+12])
+
+	p, err := dicom.NewParserFromBytes(data, nil)
+	require.NoError(t, err)
+	ds2, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	for _, elem := range ds.Elements {
+		elem2, err := ds2.FindElementByTag(elem.Tag)
+		require.NoError(t, err, dicomtag.DebugString(elem.Tag))
+		assert.Equal(t, elem.Value, elem2.Value, dicomtag.DebugString(elem.Tag))
+	}
+}
+
+func TestWithoutPreamble(t *testing.T) {
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, element.MustNewElement(dicomtag.PatientName, "Doe^John"))
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds, write.WithoutPreamble))
+	data := out.Bytes()
+	// (0002,0000) UL, 4 bytes.
+	assert.Equal(t, []byte{0x02, 0x00, 0x00, 0x00, 'U', 'L', 0x04, 0x00}, data[:8])
+
+	e := dicomio.NewBytesEncoder(nil, dicomio.UnknownVR)
+	write.FileHeader(e, ds.Elements[:3], write.WithoutPreamble)
+	require.NoError(t, e.Error())
+	header := e.Bytes()
+	assert.Equal(t, header, data[:len(header)])
+	assert.Equal(t, 12+int(binary.LittleEndian.Uint32(header[8:12])), len(header))
+}
+
+func TestSpecificCharacterSet(t *testing.T) {
+	name := element.MustNewElement(dicomtag.PatientName, "Müller^Jürgen")
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.SpecificCharacterSet, "ISO_IR 100"),
+		name)
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds))
+	// ü is 0xfc in ISO-8859-1. The value has an odd length, so it's padded.
+	// The VL is that of the transcoded and padded value, not of the UTF-8
+	// string.
+	assert.True(t, bytes.HasSuffix(out.Bytes(), []byte("PN\x0e\x00M\xfcller^J\xfcrgen ")), "%q", out.Bytes())
+
+	p, err := dicom.NewParserFromBytes(out.Bytes(), nil)
+	require.NoError(t, err)
+	ds2, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	elem, err := ds2.FindElementByTag(dicomtag.PatientName)
+	require.NoError(t, err)
+	assert.Equal(t, name.Value, elem.Value)
+
+	// WithDefaultCharset applies when the dataset has no SpecificCharacterSet.
+	ds = newTestDataSet(dicomuid.ExplicitVRLittleEndian, name)
+	out.Reset()
+	require.NoError(t, write.DataSet(&out, ds, write.WithDefaultCharset("ISO_IR 100")))
+	assert.True(t, bytes.HasSuffix(out.Bytes(), []byte("M\xfcller^J\xfcrgen ")), "%q", out.Bytes())
+	out.Reset()
+	assert.Error(t, write.DataSet(&out, ds, write.WithDefaultCharset("no such charset")))
+
+	// Characters the character set can't represent are an error.
+	ds = newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.SpecificCharacterSet, "ISO_IR 100"),
+		element.MustNewElement(dicomtag.PatientName, "山田^太郎"))
+	out.Reset()
+	assert.Error(t, write.DataSet(&out, ds))
+}
+
+func TestDataSetNotModified(t *testing.T) {
+	// The writer resolves VRs, lengths and meta elements in local variables,
+	// leaving the caller's dataset alone.
+	newDataSet := func() *element.DataSet {
+		return &element.DataSet{Elements: []*element.Element{
+			element.MustNewElement(dicomtag.TransferSyntaxUID, dicomuid.ExplicitVRLittleEndian),
+			element.MustNewElement(dicomtag.SOPClassUID, "1.2.840.10008.5.1.4.1.1.7"),
+			element.MustNewElement(dicomtag.SOPInstanceUID, "1.2.3.4.5.6.7"),
+			{Tag: dicomtag.PatientName, Value: []interface{}{"Foo"}},
+			{
+				Tag:   dicomtag.ReferencedImageSequence,
+				VR:    "SQ",
+				Value: []interface{}{newItem(false, &element.Element{Tag: dicomtag.Rows, Value: []interface{}{uint16(3)}})},
+			},
+		}}
+	}
+	ds := newDataSet()
+	var out1, out2 bytes.Buffer
+	require.NoError(t, write.DataSet(&out1, ds, write.WithTransferSyntax(dicomuid.ImplicitVRLittleEndian)))
+	assert.Equal(t, newDataSet(), ds)
+	require.NoError(t, write.DataSet(&out2, ds, write.WithTransferSyntax(dicomuid.ImplicitVRLittleEndian)))
+	assert.Equal(t, newDataSet(), ds)
+	assert.Equal(t, out1.Bytes(), out2.Bytes())
+}
+
+func TestValidate(t *testing.T) {
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.PatientName, "Foo"),
+		&element.Element{
+			Tag: dicomtag.ReferencedImageSequence,
+			VR:  "SQ",
+			Value: []interface{}{newItem(false,
+				element.MustNewElement(dicomtag.Rows, uint16(1)),
+				element.MustNewElement(dicomtag.Columns, uint16(1)))},
+		})
+	var out bytes.Buffer
+	assert.NoError(t, write.DataSet(&out, ds, write.WithValidation))
+
+	ds = &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.TransferSyntaxUID, "1.2.3"),
+		element.MustNewElement(dicomtag.SOPInstanceUID, "1.2.3.4.5.6.7"),
+		element.MustNewElement(dicomtag.PatientName, "Foo"),
+		element.MustNewElement(dicomtag.PatientName, "Bar"),
+		{Tag: dicomtag.LUTData, VR: "OW", Value: []interface{}{[]byte{1, 2, 3}}},
+		{
+			Tag: dicomtag.ReferencedImageSequence,
+			VR:  "SQ",
+			Value: []interface{}{
+				newItem(false, &element.Element{Tag: dicomtag.Rows, VR: "SS", Value: []interface{}{int16(1)}}),
+				newItem(false, element.MustNewElement(dicomtag.Rows, uint16(1))),
+			},
+		},
+	}}
+	out.Reset()
+	err := write.DataSet(&out, ds, write.WithValidation)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate tag")
+	assert.Equal(t, 0, out.Len())
+}
+
+func TestSequenceDelimiter(t *testing.T) {
+	delimiter := []byte{0xfe, 0xff, 0xdd, 0xe0, 0, 0, 0, 0}
+	for _, tc := range []struct {
+		outer, inner bool // UndefinedLength of the two sequences
+		want         int  // Number of delimiters
+	}{
+		{false, false, 0},
+		{true, false, 1},
+		{false, true, 1},
+		{true, true, 2},
+	} {
+		inner := element.MustNewElement(dicomtag.ReferencedSOPSequence,
+			newItem(false, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3.4.5")))
+		inner.UndefinedLength = tc.inner
+		outer := element.MustNewElement(dicomtag.ReferencedSeriesSequence, newItem(false, inner))
+		outer.UndefinedLength = tc.outer
+		for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			e := dicomio.NewBytesEncoder(bo, dicomio.ExplicitVR)
+			write.Element(e, outer)
+			require.NoError(t, e.Error())
+			want := delimiter
+			if bo == binary.BigEndian {
+				want = []byte{0xff, 0xfe, 0xe0, 0xdd, 0, 0, 0, 0}
+			}
+			assert.Equal(t, tc.want, bytes.Count(e.Bytes(), want), "%+v %v", tc, bo)
+			if tc.outer {
+				// The delimiter ends the sequence.
+				assert.True(t, bytes.HasSuffix(e.Bytes(), want), "%+v %v", tc, bo)
+			}
+		}
+	}
+}
+
+func TestExplicitSequenceLength(t *testing.T) {
+	inner := element.MustNewElement(dicomtag.ReferencedSOPSequence,
+		newItem(true, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3.4.5")))
+	inner.UndefinedLength = true
+	outer := element.MustNewElement(dicomtag.ReferencedSeriesSequence,
+		newItem(true, element.MustNewElement(dicomtag.SeriesInstanceUID, "1.2.3"), inner))
+	outer.UndefinedLength = true
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, outer)
+
+	var delimited, explicit bytes.Buffer
+	require.NoError(t, write.DataSet(&delimited, ds))
+	require.NoError(t, write.DataSet(&explicit, ds, write.WithExplicitSequenceLength))
+	delimiter := []byte{0xfe, 0xff, 0xdd, 0xe0}
+	assert.True(t, bytes.Contains(delimited.Bytes(), delimiter))
+	assert.False(t, bytes.Contains(explicit.Bytes(), delimiter))
+	assert.False(t, bytes.Contains(explicit.Bytes(), []byte{0xff, 0xff, 0xff, 0xff}))
+
+	// Both read back as the same dataset, save for the length flags.
+	var values []string
+	for _, data := range [][]byte{delimited.Bytes(), explicit.Bytes()} {
+		p, err := dicom.NewParserFromBytes(data, nil)
+		require.NoError(t, err)
+		ds2, err := p.Parse(dicom.ParseOptions{})
+		require.NoError(t, err)
+		elem, err := ds2.FindElementByTag(dicomtag.ReferencedSeriesSequence)
+		require.NoError(t, err)
+		item := elem.Value[0].(*element.Element)
+		sop := item.Value[1].(*element.Element).Value[0].(*element.Element).Value[0].(*element.Element)
+		values = append(values, fmt.Sprint(item.Value[0].(*element.Element).Value, sop.Value))
+	}
+	assert.Equal(t, values[0], values[1])
+	assert.Equal(t, "[1.2.3] [1.2.3.4.5]", values[0])
+}
+
+func TestElementOrder(t *testing.T) {
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.Rows, uint16(1)),
+		element.MustNewElement(dicomtag.PatientID, "1234"),
+		element.MustNewElement(dicomtag.Modality, "CT"),
+		element.MustNewElement(dicomtag.PatientName, "Foo"),
+		element.MustNewElement(dicomtag.Columns, uint16(1)))
+	// Put a meta element last; it's still written in the header.
+	ds.Elements = append(ds.Elements[1:], ds.Elements[0])
+	want := append([]*element.Element(nil), ds.Elements...)
+
+	readTags := func(opts ...write.Option) []dicomtag.Tag {
+		var out bytes.Buffer
+		require.NoError(t, write.DataSet(&out, ds, opts...))
+		p, err := dicom.NewParserFromBytes(out.Bytes(), nil)
+		require.NoError(t, err)
+		ds2, err := p.Parse(dicom.ParseOptions{})
+		require.NoError(t, err)
+		var tags []dicomtag.Tag
+		for _, elem := range ds2.Elements {
+			if elem.Tag.Group != dicomtag.MetadataGroup {
+				tags = append(tags, elem.Tag)
+			}
+		}
+		return tags
+	}
+	assert.Equal(t, []dicomtag.Tag{dicomtag.Modality, dicomtag.PatientName, dicomtag.PatientID, dicomtag.Rows, dicomtag.Columns},
+		readTags())
+	// The caller's dataset is left in its order.
+	assert.Equal(t, want, ds.Elements)
+	assert.Equal(t, []dicomtag.Tag{dicomtag.Rows, dicomtag.PatientID, dicomtag.Modality, dicomtag.PatientName, dicomtag.Columns},
+		readTags(write.KeepElementOrder))
+}
+
+func TestEmptyElements(t *testing.T) {
+	for _, elem := range []*element.Element{
+		{Tag: dicomtag.PatientName, VR: "PN"},
+		{Tag: dicomtag.PatientName, VR: "PN", Value: []interface{}{""}},
+		{Tag: dicomtag.ReferencedImageSequence, VR: "SQ"},
+		{Tag: dicomtag.EncapsulatedDocument, VR: "OB"},
+		{Tag: dicomtag.LUTData, VR: "OW", Value: []interface{}{[]byte{}}},
+		{Tag: dicomtag.Rows, VR: "US"},
+		{Tag: dicomtag.FrameIncrementPointer, VR: "AT"},
+		{Tag: dicomtag.SOPInstanceUID, VR: "UI"},
+	} {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ImplicitVR)
+		write.Element(e, elem)
+		require.NoError(t, e.Error(), elem.VR)
+		data := e.Bytes()
+		// Only the 4-byte tag and a zero 4-byte implicit VL.
+		assert.Equal(t, []byte{0, 0, 0, 0}, data[4:], elem.VR)
+
+		e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, elem)
+		require.NoError(t, e.Error(), elem.VR)
+		d := dicomio.NewBytesDecoder(e.Bytes(), binary.LittleEndian, dicomio.ExplicitVR)
+		elem2 := dicom.NewUninitializedParserFromDecoder(d, nil).ParseNext(dicom.ParseOptions{})
+		require.NoError(t, d.Error(), elem.VR)
+		assert.Equal(t, elem.VR, elem2.VR)
+		assert.Equal(t, int64(0), d.Len())
+	}
+
+	// An empty undefined-length sequence has only the delimiter.
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ImplicitVR)
+	write.Element(e, &element.Element{Tag: dicomtag.ReferencedImageSequence, VR: "SQ", UndefinedLength: true})
+	require.NoError(t, e.Error())
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0xfe, 0xff, 0xdd, 0xe0, 0, 0, 0, 0}, e.Bytes()[4:])
+}
+
+func TestImplementationIdentifiers(t *testing.T) {
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian)
+	ds2 := mustRoundTrip(t, ds,
+		write.WithImplementationClassUID("1.2.3.4.5"),
+		write.WithImplementationVersionName("MYAPP_2_0"))
+	elem, err := ds2.FindElementByTag(dicomtag.ImplementationClassUID)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4.5", elem.MustGetString())
+	elem, err = ds2.FindElementByTag(dicomtag.ImplementationVersionName)
+	require.NoError(t, err)
+	assert.Equal(t, "MYAPP_2_0", elem.MustGetString())
+
+	// The options take precedence over the dataset's elements.
+	ds.Elements = append(ds.Elements, element.MustNewElement(dicomtag.ImplementationClassUID, "1.2.3"))
+	ds2 = mustRoundTrip(t, ds, write.WithImplementationClassUID("1.2.3.4.5"))
+	elem, err = ds2.FindElementByTag(dicomtag.ImplementationClassUID)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4.5", elem.MustGetString())
+
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, ds, write.WithImplementationClassUID("1.2.x")))
+	out.Reset()
+	assert.Error(t, write.DataSet(&out, ds, write.WithImplementationVersionName("A_VERY_LONG_NAME_1")))
+}
+
+// patternReader yields n bytes of a repeating pattern without holding them in
+// memory.
+type patternReader struct{ off, n int }
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.off >= r.n {
+		return 0, io.EOF
+	}
+	if len(p) > r.n-r.off {
+		p = p[:r.n-r.off]
+	}
+	for i := range p {
+		p[i] = byte((r.off + i) % 251)
+	}
+	r.off += len(p)
+	return len(p), nil
+}
+
+// countingWriter discards its input, counting the bytes written.
+type countingWriter struct{ n int }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestPixelDataStream(t *testing.T) {
+	// A stream produces the same bytes as the equivalent PixelDataInfo.
+	ds := newNativePixelDataSet(2, 1, 16, [][]int{{1}, {65535}}, [][]int{{300}, {4}})
+	var want bytes.Buffer
+	require.NoError(t, write.DataSet(&want, ds))
+	*ds.Elements[len(ds.Elements)-1] = *element.MustNewElement(dicomtag.PixelData, element.PixelDataStream{
+		Frames: []io.Reader{
+			bytes.NewReader([]byte{1, 0, 0xff, 0xff}),
+			bytes.NewReader([]byte{0x2c, 0x01, 4, 0}),
+		},
+		FrameLength: 4,
+	})
+	var got bytes.Buffer
+	require.NoError(t, write.DataSet(&got, ds))
+	assert.Equal(t, want.Bytes(), got.Bytes())
+
+	// A reader that ends early is an error.
+	stream := element.PixelDataStream{Frames: []io.Reader{bytes.NewReader([]byte{1, 2})}, FrameLength: 4}
+	*ds.Elements[len(ds.Elements)-1] = *element.MustNewElement(dicomtag.PixelData, stream)
+	got.Reset()
+	assert.Error(t, write.DataSet(&got, ds))
+}
+
+func TestPixelDataStreamLargeFrame(t *testing.T) {
+	const rows, cols = 2560, 2048
+	const frameLength = rows * cols * 2 // 10 MiB of 16-bit samples
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.Rows, uint16(rows)),
+		element.MustNewElement(dicomtag.Columns, uint16(cols)),
+		element.MustNewElement(dicomtag.BitsAllocated, uint16(16)),
+		element.MustNewElement(dicomtag.PixelData, element.PixelDataStream{
+			Frames:      []io.Reader{&patternReader{n: frameLength}},
+			FrameLength: frameLength,
+		}))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	out := &countingWriter{}
+	require.NoError(t, write.DataSet(out, ds))
+	runtime.ReadMemStats(&after)
+	assert.True(t, out.n > frameLength, "wrote only %d bytes", out.n)
+	allocated := after.TotalAlloc - before.TotalAlloc
+	assert.True(t, allocated < frameLength/4, "allocated %d bytes to write a %d-byte frame", allocated, frameLength)
+}
+
+func TestGroupLengths(t *testing.T) {
+	groupLength := dicomtag.Tag{Group: 0x0008, Element: 0x0000}
+	studyElems := []*element.Element{
+		element.MustNewElement(dicomtag.SOPClassUID, "1.2.840.10008.5.1.4.1.1.7"),
+		element.MustNewElement(dicomtag.StudyDate, "20180101"),
+	}
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		append(studyElems,
+			&element.Element{Tag: groupLength, VR: "UL", Value: []interface{}{uint32(4)}},
+			element.MustNewElement(dicomtag.PatientName, "Foo^Bar"))...)
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	for _, elem := range studyElems {
+		write.Element(e, elem)
+	}
+	wantLength := uint32(len(e.Bytes()))
+
+	ds2 := mustRoundTrip(t, ds, write.WithGroupLengths)
+	elem, err := ds2.FindElementByTag(groupLength)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{wantLength}, elem.Value)
+
+	// By default, the stale length is written as is.
+	ds2 = mustRoundTrip(t, ds)
+	elem, err = ds2.FindElementByTag(groupLength)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{uint32(4)}, elem.Value)
+
+	ds2 = mustRoundTrip(t, ds, write.WithoutGroupLengths)
+	_, err = ds2.FindElementByTag(groupLength)
+	assert.Error(t, err)
+	_, err = ds2.FindElementByTag(dicomtag.PatientName)
+	assert.NoError(t, err)
+	_, err = ds2.FindElementByTag(dicomtag.FileMetaInformationGroupLength)
+	assert.NoError(t, err)
+}
+
+func TestNumericStrings(t *testing.T) {
+	tests := []struct {
+		vr     string
+		values []interface{}
+		want   []string
+	}{
+		{"DS", []interface{}{1.5, float32(0.25), 3, -2}, []string{"1.5", "0.25", "3", "-2"}},
+		{"DS", []interface{}{0.1 + 0.2}, []string{"0.3"}},
+		{"DS", []interface{}{1e-7}, []string{"1e-07"}},
+		{"DS", []interface{}{0.000012345678901234567}, []string{"1.2345678901e-05"}},
+		{"DS", []interface{}{1.234567890123456e-300}, []string{"1.23456789e-300"}},
+		{"DS", []interface{}{-1234567890.123456789}, []string{"-1234567890.1235"}},
+		{"DS", []interface{}{int64(12345678901234567)}, []string{"1.2345678901e+16"}},
+		{"DS", []interface{}{"1.0", 2.0}, []string{"1.0", "2"}},
+		{"IS", []interface{}{42, int32(-7), uint16(65535)}, []string{"42", "-7", "65535"}},
+	}
+	for _, test := range tests {
+		ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+			&element.Element{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1012}, VR: test.vr, Value: test.values})
+		ds2 := mustRoundTrip(t, ds)
+		elem, err := ds2.FindElementByTag(dicomtag.Tag{Group: 0x0009, Element: 0x1012})
+		require.NoError(t, err)
+		got, err := elem.GetStrings()
+		require.NoError(t, err)
+		assert.Equal(t, test.want, got, "%v %v", test.vr, test.values)
+		for _, s := range got {
+			assert.True(t, len(s) <= 16, "%q is too long", s)
+		}
+	}
+
+	for _, test := range []struct {
+		vr    string
+		value interface{}
+	}{
+		{"DS", math.NaN()},
+		{"DS", math.Inf(1)},
+		{"IS", 1.5},
+		{"IS", int64(1) << 40},
+		{"DS", true},
+	} {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, &element.Element{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1012}, VR: test.vr, Value: []interface{}{test.value}})
+		assert.Error(t, e.Error(), "%v %v", test.vr, test.value)
+	}
+}
+
+// cancelingReader cancels a context once it has been read from.
+type cancelingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return r.r.Read(p)
+}
+
+func TestDataSetWithContext(t *testing.T) {
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.PatientName, "Foo^Bar"))
+	var out bytes.Buffer
+	require.NoError(t, write.DataSetWithContext(context.Background(), &out, ds))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out.Reset()
+	assert.Equal(t, context.Canceled, write.DataSetWithContext(ctx, &out, ds))
+
+	// Cancellation is also noticed between pixel data frames.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	ds = newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.PixelData, element.PixelDataStream{
+			Frames: []io.Reader{
+				&cancelingReader{r: bytes.NewReader([]byte{1, 2}), cancel: cancel},
+				bytes.NewReader([]byte{3, 4}),
+			},
+			FrameLength: 2,
+		}))
+	out.Reset()
+	assert.Equal(t, context.Canceled, write.DataSetWithContext(ctx, &out, ds))
+	assert.False(t, bytes.HasSuffix(out.Bytes(), []byte{3, 4}))
+}
+
+func TestTagFilter(t *testing.T) {
+	private := dicomtag.Tag{Group: 0x0009, Element: 0x1010}
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.PatientName, "Foo^Bar"),
+		&element.Element{Tag: private, VR: "LO", Value: []interface{}{"secret"}},
+		&element.Element{Tag: dicomtag.ReferencedImageSequence, VR: "SQ", Value: []interface{}{
+			newItem(false,
+				element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3"),
+				&element.Element{Tag: private, VR: "LO", Value: []interface{}{"secret"}}),
+		}})
+	isPublic := func(tag dicomtag.Tag) bool { return tag.Group%2 == 0 }
+	ds2 := mustRoundTrip(t, ds, write.WithTagFilter(isPublic))
+	for _, elem := range ds2.Elements {
+		assert.NotEqual(t, private, elem.Tag)
+	}
+	_, err := ds2.FindElementByTag(dicomtag.PatientName)
+	assert.NoError(t, err)
+	_, err = ds2.FindElementByTag(dicomtag.TransferSyntaxUID)
+	assert.NoError(t, err)
+	seq, err := ds2.FindElementByTag(dicomtag.ReferencedImageSequence)
+	require.NoError(t, err)
+	require.Len(t, seq.Value, 1)
+	item := seq.Value[0].(*element.Element)
+	require.Len(t, item.Value, 1)
+	assert.Equal(t, dicomtag.ReferencedSOPInstanceUID, item.Value[0].(*element.Element).Tag)
+
+	// The dataset itself is unchanged.
+	assert.Len(t, ds.Elements, 6)
+
+	// The meta group is written even if the filter rejects it.
+	ds2 = mustRoundTrip(t, ds, write.WithTagFilter(func(dicomtag.Tag) bool { return false }))
+	_, err = ds2.FindElementByTag(dicomtag.TransferSyntaxUID)
+	assert.NoError(t, err)
+	_, err = ds2.FindElementByTag(dicomtag.PatientName)
+	assert.Error(t, err)
+}
+
+func TestWithoutPixelData(t *testing.T) {
+	ds := newNativePixelDataSet(2, 2, 16, [][]int{{1}, {2}, {3}, {4}})
+	pixelGroupLength := dicomtag.Tag{Group: 0x7fe0, Element: 0x0000}
+	ds.Elements = append(ds.Elements, &element.Element{Tag: pixelGroupLength, VR: "UL", Value: []interface{}{uint32(20)}})
+	ds2 := mustRoundTrip(t, ds, write.WithoutPixelData, write.WithGroupLengths)
+	_, err := ds2.FindElementByTag(dicomtag.PixelData)
+	assert.Error(t, err)
+	elem, err := ds2.FindElementByTag(dicomtag.BitsAllocated)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{uint16(16)}, elem.Value)
+	// The group is empty without PixelData.
+	elem, err = ds2.FindElementByTag(pixelGroupLength)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{uint32(0)}, elem.Value)
+	// Other elements are all kept.
+	for _, elem := range ds.Elements {
+		if elem.Tag != dicomtag.PixelData {
+			_, err := ds2.FindElementByTag(elem.Tag)
+			assert.NoError(t, err, dicomtag.DebugString(elem.Tag))
+		}
+	}
+}
+
+func TestPrivateVR(t *testing.T) {
+	require.NoError(t, dicomtag.RegisterPrivateTag("ACME 1.0",
+		dicomtag.TagInfo{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1001}, VR: "DS", Name: "AcmeGain", VM: "1"}))
+	creator := dicomtag.Tag{Group: 0x0009, Element: 0x0011}
+	gain := dicomtag.Tag{Group: 0x0009, Element: 0x1101}
+	unknown := dicomtag.Tag{Group: 0x0009, Element: 0x1102}
+	explicit := dicomtag.Tag{Group: 0x0009, Element: 0x1103}
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		&element.Element{Tag: creator, Value: []interface{}{"ACME 1.0"}},
+		&element.Element{Tag: gain, Value: []interface{}{"1.5"}},
+		&element.Element{Tag: unknown, Value: []interface{}{"ab"}},
+		&element.Element{Tag: explicit, VR: "SH", Value: []interface{}{"kept"}})
+	ds2 := mustRoundTrip(t, ds)
+	for tag, vr := range map[dicomtag.Tag]string{
+		creator:  "LO",
+		gain:     "DS",
+		unknown:  "UN",
+		explicit: "SH",
+	} {
+		elem, err := ds2.FindElementByTag(tag)
+		require.NoError(t, err)
+		assert.Equal(t, vr, elem.VR, "%v", tag)
+	}
+}
+
+func TestItemHeadersInExplicitVR(t *testing.T) {
+	newSequence := func(undefinedLength bool) *element.Element {
+		seq := element.MustNewElement(dicomtag.ReferencedSOPSequence,
+			newItem(undefinedLength, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2")))
+		seq.UndefinedLength = undefinedLength
+		return seq
+	}
+	tests := []struct {
+		bo              binary.ByteOrder
+		undefinedLength bool
+		want            []byte
+	}{
+		{binary.LittleEndian, true, []byte{
+			0x08, 0x00, 0x99, 0x11, 'S', 'Q', 0, 0, 0xff, 0xff, 0xff, 0xff,
+			0xfe, 0xff, 0x00, 0xe0, 0xff, 0xff, 0xff, 0xff, // Item, no VR
+			0x08, 0x00, 0x55, 0x11, 'U', 'I', 4, 0, '1', '.', '2', 0,
+			0xfe, 0xff, 0x0d, 0xe0, 0, 0, 0, 0, // ItemDelimitationItem
+			0xfe, 0xff, 0xdd, 0xe0, 0, 0, 0, 0, // SequenceDelimitationItem
+		}},
+		{binary.BigEndian, true, []byte{
+			0x00, 0x08, 0x11, 0x99, 'S', 'Q', 0, 0, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xfe, 0xe0, 0x00, 0xff, 0xff, 0xff, 0xff,
+			0x00, 0x08, 0x11, 0x55, 'U', 'I', 0, 4, '1', '.', '2', 0,
+			0xff, 0xfe, 0xe0, 0x0d, 0, 0, 0, 0,
+			0xff, 0xfe, 0xe0, 0xdd, 0, 0, 0, 0,
+		}},
+		{binary.LittleEndian, false, []byte{
+			0x08, 0x00, 0x99, 0x11, 'S', 'Q', 0, 0, 20, 0, 0, 0,
+			0xfe, 0xff, 0x00, 0xe0, 12, 0, 0, 0,
+			0x08, 0x00, 0x55, 0x11, 'U', 'I', 4, 0, '1', '.', '2', 0,
+		}},
+		{binary.BigEndian, false, []byte{
+			0x00, 0x08, 0x11, 0x99, 'S', 'Q', 0, 0, 0, 0, 0, 20,
+			0xff, 0xfe, 0xe0, 0x00, 0, 0, 0, 12,
+			0x00, 0x08, 0x11, 0x55, 'U', 'I', 0, 4, '1', '.', '2', 0,
+		}},
+	}
+	for _, test := range tests {
+		e := dicomio.NewBytesEncoder(test.bo, dicomio.ExplicitVR)
+		write.Element(e, newSequence(test.undefinedLength))
+		require.NoError(t, e.Error())
+		assert.Equal(t, test.want, e.Bytes(), "%v, undefined length: %v", test.bo, test.undefinedLength)
+	}
+}
+
+func TestImplicitVRSequence(t *testing.T) {
+	for _, undefinedLength := range []bool{false, true} {
+		// Neither the sequence nor the elements in its item have a VR; it
+		// comes from the dictionary.
+		seq := &element.Element{Tag: dicomtag.ReferencedSOPSequence, UndefinedLength: undefinedLength, Value: []interface{}{
+			newItem(undefinedLength,
+				&element.Element{Tag: dicomtag.ReferencedSOPClassUID, Value: []interface{}{"1.2.840.10008.5.1.4.1.1.7"}},
+				&element.Element{Tag: dicomtag.ReferencedSOPInstanceUID, Value: []interface{}{"1.2.3"}}),
+		}}
+		var out bytes.Buffer
+		require.NoError(t, write.DataSet(&out, newTestDataSet(dicomuid.ImplicitVRLittleEndian, seq)))
+		// The sequence is written without a VR, in either mode.
+		data := out.Bytes()
+		i := bytes.Index(data, []byte{0x08, 0x00, 0x99, 0x11})
+		require.True(t, i > 0)
+		assert.Equal(t, []byte{0xfe, 0xff, 0x00, 0xe0}, data[i+8:i+12], "undefined length: %v", undefinedLength)
+
+		p, err := dicom.NewParserFromBytes(data, nil)
+		require.NoError(t, err)
+		ds2, err := p.Parse(dicom.ParseOptions{})
+		require.NoError(t, err)
+		elem, err := ds2.FindElementByTag(dicomtag.ReferencedSOPSequence)
+		require.NoError(t, err)
+		assert.Equal(t, "SQ", elem.VR)
+		assert.True(t, seq.Equal(elem), "%v", elem)
+	}
+}
+
+func TestItemSeqGroupHeaders(t *testing.T) {
+	uid := element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2")
+	tests := []struct {
+		elem *element.Element
+		want []byte
+	}{
+		// An item has a length, but never a VR.
+		{newItem(false, uid), []byte{
+			0xfe, 0xff, 0x00, 0xe0, 12, 0, 0, 0,
+			0x08, 0x00, 0x55, 0x11, 'U', 'I', 4, 0, '1', '.', '2', 0,
+		}},
+		// Delimitation items have neither a VR nor a value.
+		{&element.Element{Tag: dicomtag.ItemDelimitationItem}, []byte{0xfe, 0xff, 0x0d, 0xe0, 0, 0, 0, 0}},
+		{&element.Element{Tag: dicomtag.SequenceDelimitationItem}, []byte{0xfe, 0xff, 0xdd, 0xe0, 0, 0, 0, 0}},
+	}
+	for _, implicit := range []dicomio.IsImplicitVR{dicomio.ExplicitVR, dicomio.ImplicitVR} {
+		for _, test := range tests {
+			e := dicomio.NewBytesEncoder(binary.LittleEndian, implicit)
+			write.Element(e, test.elem)
+			require.NoError(t, e.Error())
+			want := test.want
+			if implicit == dicomio.ImplicitVR && test.elem.Tag == dicomtag.Item {
+				// Only the element in the item loses its VR.
+				want = append(append([]byte(nil), want[:12]...), 4, 0, 0, 0, '1', '.', '2', 0)
+			}
+			assert.Equal(t, want, e.Bytes(), "%v", dicomtag.DebugString(test.elem.Tag))
+		}
+	}
+
+	for _, elem := range []*element.Element{
+		{Tag: dicomtag.ItemDelimitationItem, VR: "NA", Value: []interface{}{uid}},
+		{Tag: dicomtag.SequenceDelimitationItem, VR: "NA", Value: []interface{}{uid}},
+		{Tag: dicomtag.Tag{Group: 0xfffe, Element: 0xe001}, VR: "NA"},
+	} {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, elem)
+		assert.Error(t, e.Error(), "%v", dicomtag.DebugString(elem.Tag))
+	}
+}
+
+// newLargeDataSet returns a dataset of 3000 small private elements.
+func newLargeDataSet() *element.DataSet {
+	var elems []*element.Element
+	for i := 0; i < 1000; i++ {
+		elems = append(elems,
+			&element.Element{Tag: dicomtag.Tag{Group: 0x0009, Element: uint16(0x1000 + i)}, VR: "LO", Value: []interface{}{"value"}},
+			&element.Element{Tag: dicomtag.Tag{Group: 0x0011, Element: uint16(0x1000 + i)}, VR: "US", Value: []interface{}{uint16(i)}},
+			&element.Element{Tag: dicomtag.Tag{Group: 0x0013, Element: uint16(0x1000 + i)}, VR: "SQ", Value: []interface{}{
+				newItem(false, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3")),
+			}})
+	}
+	return newTestDataSet(dicomuid.ExplicitVRLittleEndian, elems...)
+}
+
+func BenchmarkWriteLargeDataset(b *testing.B) {
+	ds := newLargeDataSet()
+	var out bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		if err := write.DataSet(&out, ds); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteToFile(b *testing.B) {
+	ds := newLargeDataSet()
+	for _, bc := range []struct {
+		name string
+		opts []write.Option
+	}{
+		{"Buffered", nil},
+		{"Unbuffered", []write.Option{write.WithBufferSize(0)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			out, err := ioutil.TempFile("", "dicom")
+			require.NoError(b, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := out.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				if err := write.DataSet(out, ds, bc.opts...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// writeCounter records the size of every Write, failing past limit bytes if
+// limit > 0.
+type writeCounter struct {
+	sizes []int
+	n     int
+	limit int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	if w.limit > 0 && w.n+len(p) > w.limit {
+		return 0, errors.New("disk full")
+	}
+	w.sizes = append(w.sizes, len(p))
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestWithBufferSize(t *testing.T) {
+	ds := newLargeDataSet()
+	var want bytes.Buffer
+	require.NoError(t, write.DataSet(&want, ds, write.WithBufferSize(0)))
+	for _, tc := range []struct {
+		opts     []write.Option
+		maxWrite int
+	}{
+		{nil, 32 << 10},
+		{[]write.Option{write.WithBufferSize(1000)}, 1000},
+	} {
+		w := &writeCounter{}
+		require.NoError(t, write.DataSet(w, ds, tc.opts...))
+		assert.Equal(t, want.Len(), w.n)
+		assert.True(t, len(w.sizes) <= want.Len()/tc.maxWrite+1, "%v writes", len(w.sizes))
+		for _, size := range w.sizes[:len(w.sizes)-1] {
+			assert.True(t, size >= tc.maxWrite, "%v", size)
+		}
+	}
+	// Unbuffered, there's at least a write per element.
+	w := &writeCounter{}
+	require.NoError(t, write.DataSet(w, ds, write.WithBufferSize(0)))
+	assert.True(t, len(w.sizes) > 3000, "%v writes", len(w.sizes))
+
+	// An error is returned even if it only shows when the buffer is flushed.
+	ds = newTestDataSet(dicomuid.ExplicitVRLittleEndian, element.MustNewElement(dicomtag.PatientName, "Foo^Bar"))
+	assert.Error(t, write.DataSet(&writeCounter{limit: 100}, ds))
+}
+
+func TestUnknownSequenceRoundTrip(t *testing.T) {
+	// Some files have a sequence that the writer didn't know, encoded as
+	// UN with undefined length.
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, newTestDataSet(dicomuid.ExplicitVRLittleEndian)))
+	data := append(append([]byte(nil), out.Bytes()...),
+		0x09, 0x00, 0x10, 0x10, 'U', 'N', 0, 0, 0xff, 0xff, 0xff, 0xff,
+		0xfe, 0xff, 0x00, 0xe0, 0xff, 0xff, 0xff, 0xff,
+		0x08, 0x00, 0x55, 0x11, 'U', 'I', 4, 0, '1', '.', '2', 0,
+		0xfe, 0xff, 0x0d, 0xe0, 0, 0, 0, 0,
+		0xfe, 0xff, 0xdd, 0xe0, 0, 0, 0, 0)
+	p, err := dicom.NewParserFromBytes(data, nil)
+	require.NoError(t, err)
+	ds, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	elem, err := ds.FindElementByTag(dicomtag.Tag{Group: 0x0009, Element: 0x1010})
+	require.NoError(t, err)
+	assert.Equal(t, "UN", elem.VR)
+	require.Len(t, elem.Value, 1)
+
+	out.Reset()
+	require.NoError(t, write.DataSet(&out, ds))
+	assert.Equal(t, data, out.Bytes())
+
+	// Only its items get an explicit length.
+	ds2 := mustRoundTrip(t, ds, write.WithExplicitSequenceLength)
+	elem, err = ds2.FindElementByTag(dicomtag.Tag{Group: 0x0009, Element: 0x1010})
+	require.NoError(t, err)
+	assert.Equal(t, "UN", elem.VR)
+	assert.True(t, elem.UndefinedLength)
+	require.Len(t, elem.Value, 1)
+}
+
+func TestDataSetString(t *testing.T) {
+	ds := &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.ImageType, "ORIGINAL", "PRIMARY"),
+		element.MustNewElement(dicomtag.Rows, uint16(512)),
+		element.MustNewElement(dicomtag.ReferencedImageSequence,
+			newItem(true, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3"))),
+		{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1010}, VR: "OB", Value: []interface{}{[]byte{1, 2, 3}}},
+		{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1011}, VR: "OB", Value: []interface{}{make([]byte, 1000)}},
+	}}
+	lines := strings.Split(ds.String(), "\n")
+	require.Len(t, lines, 7)
+	assert.Equal(t, []string{
+		`(0008,0008)[ImageType] CS VL=16 (2)[ORIGINAL\PRIMARY]`,
+		`(0028,0010)[Rows] US VL=2 [512]`,
+		`(0008,1140)[ReferencedImageSequence] SQ (#1)`,
+		`  (fffe,e000)[Item] NA VL=u (#1)`,
+		`    (0008,1155)[ReferencedSOPInstanceUID] UI VL=6 [1.2.3]`,
+		`(0009,1010)[private] OB VL=4 [010203]`,
+	}, lines[:6])
+	// Long values are truncated.
+	assert.True(t, strings.HasPrefix(lines[6], `(0009,1011)[private] OB VL=1000 [0000`), lines[6])
+	assert.True(t, strings.HasSuffix(lines[6], `(...)`), lines[6])
+}
+
+func TestOtherBinaryVRs(t *testing.T) {
+	doseGrid := dicomtag.Tag{Group: 0x0009, Element: 0x1020}
+	floats := dicomtag.Tag{Group: 0x0009, Element: 0x1021}
+	longs := dicomtag.Tag{Group: 0x0009, Element: 0x1022}
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		e := dicomio.NewBytesEncoder(bo, dicomio.ExplicitVR)
+		write.Element(e, &element.Element{Tag: doseGrid, VR: "OD", Value: []interface{}{1.5, -2.0}})
+		require.NoError(t, e.Error())
+		want := make([]byte, 12+16)
+		bo.PutUint16(want[0:], doseGrid.Group)
+		bo.PutUint16(want[2:], doseGrid.Element)
+		copy(want[4:], "OD")
+		bo.PutUint32(want[8:], 16)
+		bo.PutUint64(want[12:], math.Float64bits(1.5))
+		bo.PutUint64(want[20:], math.Float64bits(-2.0))
+		assert.Equal(t, want, e.Bytes(), "%v", bo)
+	}
+
+	ds := newTestDataSet(dicomuid.ExplicitVRBigEndian,
+		&element.Element{Tag: doseGrid, VR: "OD", Value: []interface{}{0.25, 1e-10, 3.0}},
+		&element.Element{Tag: floats, VR: "OF", Value: []interface{}{float32(0.5)}},
+		&element.Element{Tag: longs, VR: "OL", Value: []interface{}{uint32(1), uint32(0xdeadbeef)}})
+	ds2 := mustRoundTrip(t, ds)
+	for _, elem := range ds.Elements[3:] {
+		got, err := ds2.FindElementByTag(elem.Tag)
+		require.NoError(t, err)
+		assert.Equal(t, elem.Value, got.Value)
+	}
+
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: doseGrid, VR: "OD", Value: []interface{}{float32(1)}})
+	assert.Error(t, e.Error())
+}
+
+func TestRawVL(t *testing.T) {
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, element.MustNewElement(dicomtag.PatientName, "Foo^Bar"),
+		write.WithRawVL(dicomtag.PatientName, 3))
+	require.NoError(t, e.Error())
+	assert.Equal(t, []byte{0x10, 0x00, 0x10, 0x00, 'P', 'N', 3, 0, 'F', 'o', 'o', '^', 'B', 'a', 'r', ' '}, e.Bytes())
+
+	// Even an undefined length, and elements with other tags keep their VL.
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ImplicitVR)
+	opt := write.WithRawVL(dicomtag.PatientID, element.VLUndefinedLength)
+	write.Element(e, element.MustNewElement(dicomtag.PatientID, "12"), opt)
+	write.Element(e, element.MustNewElement(dicomtag.PatientName, "AB"), opt)
+	require.NoError(t, e.Error())
+	assert.Equal(t, []byte{
+		0x10, 0x00, 0x20, 0x00, 0xff, 0xff, 0xff, 0xff, '1', '2',
+		0x10, 0x00, 0x10, 0x00, 2, 0, 0, 0, 'A', 'B',
+	}, e.Bytes())
+
+	// The reader sees the bogus length.
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, element.MustNewElement(dicomtag.PatientName, "Foo^Bar"))
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds, write.WithRawVL(dicomtag.PatientName, 4)))
+	p, err := dicom.NewParserFromBytes(out.Bytes(), nil)
+	require.NoError(t, err)
+	ds2, err := p.Parse(dicom.ParseOptions{})
+	assert.Error(t, err)
+	elem, err := ds2.FindElementByTag(dicomtag.PatientName)
+	require.NoError(t, err)
+	assert.Equal(t, "Foo^", elem.MustGetString())
+}
+
+func TestElementBodies(t *testing.T) {
+	// Every value is encoded into a sub-encoder first, to know its length.
+	// Make sure the body follows the header in the output.
+	for _, test := range []struct {
+		elem *element.Element
+		body []byte
+	}{
+		{element.MustNewElement(dicomtag.PatientName, "Foo^Bar"), []byte("Foo^Bar ")},
+		{element.MustNewElement(dicomtag.Rows, uint16(512)), []byte{0x00, 0x02}},
+		{element.MustNewElement(dicomtag.SimpleFrameList, uint32(1), uint32(2)), []byte{1, 0, 0, 0, 2, 0, 0, 0}},
+		{element.MustNewElement(dicomtag.FrameIncrementPointer, dicomtag.FrameTime), []byte{0x18, 0x00, 0x63, 0x10}},
+		{&element.Element{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1010}, VR: "OB", Value: []interface{}{[]byte{1, 2, 3, 4}}},
+			[]byte{1, 2, 3, 4}},
+		{&element.Element{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1011}, VR: "FD", Value: []interface{}{1.5}},
+			[]byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f}},
+		{&element.Element{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1012}, VR: "SS", Value: []interface{}{int16(-2)}},
+			[]byte{0xfe, 0xff}},
+	} {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ImplicitVR)
+		write.Element(e, test.elem)
+		require.NoError(t, e.Error())
+		data := e.Bytes()
+		require.True(t, len(data) >= 8, "%v", test.elem)
+		assert.Equal(t, uint32(len(test.body)), binary.LittleEndian.Uint32(data[4:8]), "%v", test.elem)
+		assert.Equal(t, test.body, data[8:], "%v", test.elem)
+	}
+}
+
+func TestCoerceVR(t *testing.T) {
+	// Rows is US. Mislabeled as SS, its uint16 value is a VRMismatchError...
+	rows := &element.Element{Tag: dicomtag.Rows, VR: "SS", Value: []interface{}{uint16(40000)}}
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, rows)
+	var mismatch *write.VRMismatchError
+	assert.True(t, errors.As(e.Error(), &mismatch))
+
+	// ...unless the dictionary VR is used instead.
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, rows, write.CoerceVR)
+	require.NoError(t, e.Error())
+	assert.Equal(t, []byte{0x28, 0x00, 0x10, 0x00, 'U', 'S', 2, 0, 0x40, 0x9c}, e.Bytes())
+	assert.Equal(t, "SS", rows.VR)
+
+	// Values of another Go type are converted.
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: dicomtag.Rows, VR: "SS", Value: []interface{}{int16(512)}}, write.CoerceVR)
+	require.NoError(t, e.Error())
+	assert.Equal(t, []byte{0x28, 0x00, 0x10, 0x00, 'U', 'S', 2, 0, 0x00, 0x02}, e.Bytes())
+
+	// Unless they don't fit.
+	for _, value := range []interface{}{int16(-1), float32(1.5)} {
+		e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, &element.Element{Tag: dicomtag.Rows, VR: "SS", Value: []interface{}{value}}, write.CoerceVR)
+		assert.Error(t, e.Error(), "%v", value)
+	}
+
+	// Through a file.
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, rows)
+	ds2 := mustRoundTrip(t, ds, write.CoerceVR)
+	elem, err := ds2.FindElementByTag(dicomtag.Rows)
+	require.NoError(t, err)
+	assert.Equal(t, "US", elem.VR)
+	assert.Equal(t, []interface{}{uint16(40000)}, elem.Value)
+}
+
+func TestLegacyVRs(t *testing.T) {
+	tests := []struct {
+		elem *element.Element
+		want []byte
+	}{
+		// A UN-labeled PN, as written by some legacy archives.
+		{&element.Element{Tag: dicomtag.PatientName, VR: "UN", Value: []interface{}{[]byte("Doe^John")}},
+			append([]byte{0x10, 0x00, 0x10, 0x00, 'U', 'N', 0, 0, 8, 0, 0, 0}, "Doe^John"...)},
+		// OB-mislabeled elements, padded like OB.
+		{&element.Element{Tag: dicomtag.PatientName, VR: "OB", Value: []interface{}{[]byte("Doe")}},
+			[]byte{0x10, 0x00, 0x10, 0x00, 'O', 'B', 0, 0, 4, 0, 0, 0, 'D', 'o', 'e', 0}},
+		{&element.Element{Tag: dicomtag.Rows, VR: "OB", Value: []interface{}{[]byte{0x00, 0x02}}},
+			[]byte{0x28, 0x00, 0x10, 0x00, 'O', 'B', 0, 0, 2, 0, 0, 0, 0x00, 0x02}},
+	}
+	for _, test := range tests {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, test.elem)
+		assert.Error(t, e.Error(), "%v", test.elem)
+
+		e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, test.elem, write.WithLegacyVRs)
+		require.NoError(t, e.Error())
+		assert.Equal(t, test.want, e.Bytes())
+	}
+
+	// Mismatches other than raw bytes are still errors.
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: dicomtag.Rows, VR: "FL", Value: []interface{}{float32(1)}}, write.WithLegacyVRs)
+	var mismatch *write.VRMismatchError
+	assert.True(t, errors.As(e.Error(), &mismatch))
+
+	// Through a file, including a meta element with a nonstandard VR.
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		&element.Element{Tag: dicomtag.FileMetaInformationVersion, VR: "UN", Value: []interface{}{[]byte{0x00, 0x01}}},
+		tests[0].elem)
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, ds))
+	ds2 := mustRoundTrip(t, ds, write.WithLegacyVRs)
+	for _, tag := range []dicomtag.Tag{dicomtag.FileMetaInformationVersion, dicomtag.PatientName} {
+		elem, err := ds2.FindElementByTag(tag)
+		require.NoError(t, err)
+		assert.Equal(t, "UN", elem.VR, "%v", tag)
+	}
+	name, err := ds2.GetString(dicomtag.PatientName)
+	require.NoError(t, err)
+	assert.Equal(t, "Doe^John", name)
+}
+
+func TestPixelDataWordSize(t *testing.T) {
+	for _, bits := range []int{8, 16} {
+		ds := newNativePixelDataSet(2, 2, bits, [][]int{{1}, {2}, {3}, {255}})
+		ds2 := mustRoundTrip(t, ds, write.ForceImplicitVR)
+		elem, err := ds2.FindElementByTag(dicomtag.PixelData)
+		require.NoError(t, err)
+		assert.Equal(t, ds.Elements[len(ds.Elements)-1].Value, elem.Value, "%d bits", bits)
+
+		// Without a VR, PixelData gets the one matching BitsAllocated.
+		ds.Elements[len(ds.Elements)-1].VR = ""
+		ds2 = mustRoundTrip(t, ds)
+		elem, err = ds2.FindElementByTag(dicomtag.PixelData)
+		require.NoError(t, err)
+		assert.Equal(t, map[int]string{8: "OB", 16: "OW"}[bits], elem.VR)
+	}
+
+	// BitsAllocated must match the frames.
+	ds := newNativePixelDataSet(2, 2, 8, [][]int{{1}, {2}, {3}, {4}})
+	bitsAllocated, err := ds.FindElementByTag(dicomtag.BitsAllocated)
+	require.NoError(t, err)
+	bitsAllocated.Value = []interface{}{uint16(16)}
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, ds, write.ForceImplicitVR))
+}
+
+func TestTrailingEmptyFragment(t *testing.T) {
+	image := element.PixelDataInfo{IsEncapsulated: true, Frames: []frame.Frame{{
+		Encapsulated:     true,
+		EncapsulatedData: frame.EncapsulatedFrame{Data: []byte{0xff, 0xd8, 0xff, 0xd9}},
+	}}}
+	pixelData := element.MustNewElement(dicomtag.PixelData, image)
+	delimiter := []byte{0xfe, 0xff, 0xdd, 0xe0, 0, 0, 0, 0}
+	emptyItem := []byte{0xfe, 0xff, 0x00, 0xe0, 0, 0, 0, 0}
+	fragment := []byte{0xfe, 0xff, 0x00, 0xe0, 4, 0, 0, 0, 0xff, 0xd8, 0xff, 0xd9}
+
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, pixelData)
+	require.NoError(t, e.Error())
+	assert.True(t, bytes.HasSuffix(e.Bytes(), append(fragment, delimiter...)))
+
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, pixelData, write.TrailingEmptyFragment)
+	require.NoError(t, e.Error())
+	assert.True(t, bytes.HasSuffix(e.Bytes(), append(append(fragment, emptyItem...), delimiter...)))
+}
+
+// TestConcurrentDataSet is meant to be run with -race, too.
+func TestConcurrentDataSet(t *testing.T) {
+	p, err := dicom.NewParserFromFile("../examples/CT-MONO2-16-ort.dcm", nil)
+	require.NoError(t, err)
+	ds, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	name, err := ds.GetString(dicomtag.PatientName)
+	require.NoError(t, err)
+	// A sequence whose item is a SequenceItemValue, sorted before PixelData.
+	ds.Elements = append(ds.Elements, element.MustNewElement(dicomtag.ReferencedSeriesSequence,
+		element.SequenceItemValue{DataSet: &element.DataSet{Elements: []*element.Element{
+			element.MustNewElement(dicomtag.SeriesInstanceUID, "1.2.3"),
+		}}}))
+	var want bytes.Buffer
+	require.NoError(t, write.DataSet(&want, ds))
+
+	const n = 8
+	shared := make([]bytes.Buffer, n)
+	cloned := make([]bytes.Buffer, n)
+	errs := make([]error, 2*n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = write.DataSet(&shared[i], ds)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			clone := ds.Clone()
+			elem, err := clone.FindElementByTag(dicomtag.PatientName)
+			if err != nil {
+				errs[n+i] = err
+				return
+			}
+			elem.Value = []interface{}{fmt.Sprintf("Name%d", i)}
+			seq, err := clone.FindElementByTag(dicomtag.ReferencedSeriesSequence)
+			if err != nil {
+				errs[n+i] = err
+				return
+			}
+			seq.Value[0].(element.SequenceItemValue).DataSet.Elements[0].Value[0] = fmt.Sprintf("1.2.%d", 10+i)
+			errs[n+i] = write.DataSet(&cloned[i], clone)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	for i := 0; i < n; i++ {
+		assert.True(t, bytes.Equal(want.Bytes(), shared[i].Bytes()), "%d", i)
+		p, err := dicom.NewParserFromBytes(cloned[i].Bytes(), nil)
+		require.NoError(t, err)
+		ds2, err := p.Parse(dicom.ParseOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			fmt.Sprintf(`(0008,1115)[ReferencedSeriesSequence] item 0: (0020,000e)[SeriesInstanceUID]: "1.2.3" vs "1.2.%d"`, 10+i),
+			fmt.Sprintf(`(0010,0010)[PatientName]: "%s" vs "Name%d"`, name, i),
+		}, ds.Diff(ds2))
+	}
+}
+
+func TestVideoTransferSyntax(t *testing.T) {
+	const mpeg4 = "1.2.840.10008.1.2.4.102" // MPEG-4 AVC/H.264 High Profile / Level 4.1
+	// The whole clip in one odd-length fragment.
+	stream := make([]byte, 100001)
+	for i := range stream {
+		stream[i] = byte(i)
+	}
+	image := element.PixelDataInfo{IsEncapsulated: true, Frames: []frame.Frame{{
+		Encapsulated:     true,
+		EncapsulatedData: frame.EncapsulatedFrame{Data: stream},
+	}}}
+	ds := newTestDataSet(mpeg4,
+		element.MustNewElement(dicomtag.NumberOfFrames, "30"),
+		&element.Element{Tag: dicomtag.PixelData, VR: "OB", Value: []interface{}{image}})
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds))
+	// PixelData, an empty Basic Offset Table, and the fragment.
+	data := out.Bytes()
+	i := bytes.Index(data, []byte{0xe0, 0x7f, 0x10, 0x00, 'O', 'B', 0, 0, 0xff, 0xff, 0xff, 0xff})
+	require.True(t, i > 0)
+	assert.Equal(t, []byte{0xfe, 0xff, 0x00, 0xe0, 0, 0, 0, 0, 0xfe, 0xff, 0x00, 0xe0, 0xa2, 0x86, 0x01, 0x00},
+		data[i+12:i+28])
+
+	p, err := dicom.NewParserFromBytes(data, nil)
+	require.NoError(t, err)
+	ds2, err := p.Parse(dicom.ParseOptions{})
+	require.NoError(t, err)
+	elem, err := ds2.FindElementByTag(dicomtag.TransferSyntaxUID)
+	require.NoError(t, err)
+	assert.Equal(t, mpeg4, elem.MustGetString())
+	elem, err = ds2.FindElementByTag(dicomtag.PixelData)
+	require.NoError(t, err)
+	got := elem.Value[0].(element.PixelDataInfo)
+	require.Len(t, got.Frames, 1)
+	// The bit stream is kept as is, with a zero byte of padding.
+	assert.Equal(t, append(stream, 0), got.Frames[0].EncapsulatedData.Data)
+}
+
+func TestSequenceItemValue(t *testing.T) {
+	series := func(uid string) element.SequenceItemValue {
+		return element.SequenceItemValue{DataSet: &element.DataSet{Elements: []*element.Element{
+			element.MustNewElement(dicomtag.SeriesInstanceUID, uid),
+			element.MustNewElement(dicomtag.ReferencedImageSequence, element.SequenceItemValue{
+				DataSet: &element.DataSet{Elements: []*element.Element{
+					element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, uid+".1"),
+				}},
+			}),
+		}}}
+	}
+	seq := element.MustNewElement(dicomtag.ReferencedSeriesSequence, series("1.2.3"), series("1.2.4"))
+	for _, undefinedLength := range []bool{false, true} {
+		seq.UndefinedLength = undefinedLength
+		ds2 := mustRoundTrip(t, newTestDataSet(dicomuid.ExplicitVRLittleEndian, seq))
+		elem, err := ds2.FindElementByTag(dicomtag.ReferencedSeriesSequence)
+		require.NoError(t, err)
+		// Written the same as Item elements.
+		want := element.MustNewElement(dicomtag.ReferencedSeriesSequence)
+		for _, uid := range []string{"1.2.3", "1.2.4"} {
+			want.Value = append(want.Value, newItem(undefinedLength,
+				element.MustNewElement(dicomtag.SeriesInstanceUID, uid),
+				element.MustNewElement(dicomtag.ReferencedImageSequence,
+					newItem(false, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, uid+".1")))))
+		}
+		want.UndefinedLength = undefinedLength
+		assert.True(t, want.Equal(elem), "%v", elem)
+		assert.Equal(t, undefinedLength, elem.Value[0].(*element.Element).UndefinedLength)
+		// Either representation compares equal.
+		assert.True(t, seq.Equal(elem))
+	}
+}
+
+func TestWithHash(t *testing.T) {
+	ds := newTestDataSet(dicomuid.DeflatedExplicitVRLittleEndian, element.MustNewElement(dicomtag.PatientName, "Doe^John"))
+	h := sha256.New()
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds, write.WithHash(h)))
+	want := sha256.Sum256(out.Bytes())
+	assert.Equal(t, want[:], h.Sum(nil))
+}
+
+func TestAgeString(t *testing.T) {
+	for _, c := range []struct {
+		age, want string
+	}{
+		{"018M", "018M"},
+		{"100Y", "100Y"},
+		{"5Y", "005Y"},
+		{"45w", "045W"},
+	} {
+		ds2 := mustRoundTrip(t, newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+			element.MustNewElement(dicomtag.PatientAge, c.age)))
+		elem, err := ds2.FindElementByTag(dicomtag.PatientAge)
+		require.NoError(t, err)
+		assert.Equal(t, c.want, elem.MustGetString(), c.age)
+
+		var out bytes.Buffer
+		err = write.DataSet(&out, newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+			element.MustNewElement(dicomtag.PatientAge, c.age)), write.StrictValues)
+		if c.age == c.want {
+			assert.NoError(t, err, c.age)
+		} else {
+			assert.Error(t, err, c.age)
+		}
+	}
+	// Ages that can't be normalized are kept, unless under StrictValues.
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, element.MustNewElement(dicomtag.PatientAge, "1000Y"))
+	elem, err := mustRoundTrip(t, ds).FindElementByTag(dicomtag.PatientAge)
+	require.NoError(t, err)
+	assert.Equal(t, "1000Y", elem.MustGetString())
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, ds, write.StrictValues))
+}
+
+func TestUIDValues(t *testing.T) {
+	long := "1.2.840.10008." + strings.Repeat("1234567890.", 4) + "12345.678" // 67 characters
+	for _, c := range []struct {
+		uid, want string
+		valid     bool
+	}{
+		{"1.2.840.10008.5.1.4.1.1.7", "1.2.840.10008.5.1.4.1.1.7", true},
+		// Truncated, without the dot that would end it.
+		{long, long[:63], false},
+		// Kept, but logged.
+		{"1.2.3.abc", "1.2.3.abc", false},
+	} {
+		ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, element.MustNewElement(dicomtag.SOPInstanceUID, c.uid))
+		elem, err := mustRoundTrip(t, ds).FindElementByTag(dicomtag.SOPInstanceUID)
+		require.NoError(t, err)
+		assert.Equal(t, c.want, elem.MustGetString(), c.uid)
+
+		var out bytes.Buffer
+		err = write.DataSet(&out, ds, write.StrictValues)
+		if c.valid {
+			assert.NoError(t, err, c.uid)
+		} else {
+			assert.Error(t, err, c.uid)
+		}
+	}
+}
+
+func TestDateTimeValues(t *testing.T) {
+	at := time.Date(2019, time.March, 7, 14, 5, 9, 250000000, time.FixedZone("", -5*3600))
+	for _, c := range []struct {
+		tag  dicomtag.Tag
+		vr   string
+		want string
+	}{
+		{dicomtag.StudyDate, "DA", "20190307"},
+		{dicomtag.StudyTime, "TM", "140509.250000"},
+		{dicomtag.AcquisitionDateTime, "DT", "20190307140509.250000-0500"},
+	} {
+		ds2 := mustRoundTrip(t, newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+			&element.Element{Tag: c.tag, VR: c.vr, Value: []interface{}{at}}), write.StrictValues)
+		elem, err := ds2.FindElementByTag(c.tag)
+		require.NoError(t, err)
+		assert.Equal(t, c.want, elem.MustGetString())
+	}
+	// Whole seconds have no fraction.
+	ds2 := mustRoundTrip(t, newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		&element.Element{Tag: dicomtag.StudyTime, VR: "TM", Value: []interface{}{at.Truncate(time.Second)}}))
+	elem, err := ds2.FindElementByTag(dicomtag.StudyTime)
+	require.NoError(t, err)
+	assert.Equal(t, "140509", elem.MustGetString())
+
+	// Strings are checked under StrictValues.
+	for _, c := range []struct {
+		tag   dicomtag.Tag
+		value string
+		ok    bool
+	}{
+		{dicomtag.StudyDate, "20190307", true},
+		{dicomtag.StudyDate, "2019.03.07", false},
+		{dicomtag.StudyDate, "20190230", false},
+		{dicomtag.StudyTime, "14", true},
+		{dicomtag.StudyTime, "1405", true},
+		{dicomtag.StudyTime, "140509.1", true},
+		{dicomtag.StudyTime, "14:05:09", false},
+		{dicomtag.StudyTime, "250000", false},
+		{dicomtag.AcquisitionDateTime, "2019", true},
+		{dicomtag.AcquisitionDateTime, "20190307140509.123456+0100", true},
+		{dicomtag.AcquisitionDateTime, "20191307", false},
+		{dicomtag.AcquisitionDateTime, "2019-03-07", false},
+	} {
+		ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian, element.MustNewElement(c.tag, c.value))
+		var out bytes.Buffer
+		require.NoError(t, write.DataSet(&out, ds), c.value)
+		if err := write.DataSet(&out, ds, write.StrictValues); c.ok {
+			assert.NoError(t, err, c.value)
+		} else {
+			assert.Error(t, err, c.value)
+		}
+	}
+}
+
+func TestMultiValuedStringLength(t *testing.T) {
+	for _, c := range []struct {
+		values []string
+		vl     uint16
+	}{
+		{[]string{"ORIGINAL", "PRIMARY"}, 16},
+		{[]string{"ORIGINAL", "PRIMARY", "AXIAL"}, 22},
+		{[]string{"DERIVED", "SECONDARY"}, 18}, // 17 bytes, padded.
+		{[]string{"A", "", "B"}, 4},
+	} {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, element.MustNewElement(dicomtag.ImageType, c.values))
+		require.NoError(t, e.Error())
+		data := e.Bytes()
+		// The VL counts every value, the backslashes between them, and the
+		// padding.
+		assert.Equal(t, c.vl, binary.LittleEndian.Uint16(data[6:8]), "%v", c.values)
+		assert.Len(t, data, 8+int(c.vl))
+		assert.Equal(t, strings.Join(c.values, `\`), strings.TrimRight(string(data[8:]), " "))
+	}
+}
+
+func TestMaxSequenceDepth(t *testing.T) {
+	nested := func(depth int) *element.DataSet {
+		elem := element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3")
+		for i := 0; i < depth; i++ {
+			elem = element.MustNewElement(dicomtag.ReferencedImageSequence, newItem(i%2 == 0, elem))
+		}
+		return newTestDataSet(dicomuid.ExplicitVRLittleEndian, elem)
+	}
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, nested(100)))
+	assert.Error(t, write.DataSet(&out, nested(101)))
+	require.NoError(t, write.DataSet(&out, nested(101), write.WithMaxSequenceDepth(101)))
+	assert.Error(t, write.DataSet(&out, nested(3), write.WithMaxSequenceDepth(2)))
+
+	// A sequence that contains itself.
+	seq := element.MustNewElement(dicomtag.ReferencedImageSequence)
+	seq.Value = append(seq.Value, newItem(false, seq))
+	assert.Error(t, write.DataSet(&out, newTestDataSet(dicomuid.ExplicitVRLittleEndian, seq)))
+}
+
+func TestURValue(t *testing.T) {
+	retrieveURL := dicomtag.Tag{Group: 0x0008, Element: 0x1190}
+	url := `https://pacs.example.com/studies/1.2.3?x=a\bc`
+	ds2 := mustRoundTrip(t, newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		&element.Element{Tag: retrieveURL, VR: "UR", Value: []interface{}{url}}))
+	elem, err := ds2.FindElementByTag(retrieveURL)
+	require.NoError(t, err)
+	assert.Equal(t, "UR", elem.VR)
+	// A single value, backslash included, without the padding space.
+	assert.Equal(t, []interface{}{url}, elem.Value)
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, elem)
+	require.NoError(t, e.Error())
+	// UR has a 32-bit VL.
+	assert.Equal(t, append([]byte{0x08, 0x00, 0x90, 0x11, 'U', 'R', 0, 0, 46, 0, 0, 0}, url+" "...), e.Bytes())
+
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		&element.Element{Tag: retrieveURL, VR: "UR", Value: []interface{}{"https://a", "https://b"}})))
+}
+
+func TestUnlimitedTextVRs(t *testing.T) {
+	ut := dicomtag.Tag{Group: 0x0009, Element: 0x1030}
+	uc := dicomtag.Tag{Group: 0x0009, Element: 0x1031}
+	text := strings.Repeat(`line\`, 20000) + "x" // 100001 bytes
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		&element.Element{Tag: ut, VR: "UT", Value: []interface{}{text}},
+		&element.Element{Tag: uc, VR: "UC", Value: []interface{}{"foo", "bar"}})
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds))
+	// UT has a 32-bit VL, counting one byte of padding.
+	data := out.Bytes()
+	i := bytes.Index(data, []byte{0x09, 0x00, 0x30, 0x10, 'U', 'T', 0, 0})
+	require.True(t, i > 0)
+	assert.Equal(t, uint32(100002), binary.LittleEndian.Uint32(data[i+8:]))
+
+	ds2 := mustRoundTrip(t, ds)
+	elem, err := ds2.FindElementByTag(ut)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{text + " "}, elem.Value)
+	elem, err = ds2.FindElementByTag(uc)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"foo", "bar"}, elem.Value)
+
+	// Backslashes are part of a UT value, so it has only one.
+	ds = newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		&element.Element{Tag: ut, VR: "UT", Value: []interface{}{"foo", "bar"}})
+	assert.Error(t, write.DataSet(&out, ds))
+}
+
+func TestWithDefaultMeta(t *testing.T) {
+	ds := &element.DataSet{Elements: []*element.Element{element.MustNewElement(dicomtag.PatientName, "Doe^John")}}
+	var out bytes.Buffer
+	assert.Error(t, write.DataSet(&out, ds))
+
+	ds2 := mustRoundTrip(t, ds, write.WithDefaultMeta, write.WithValidation)
+	for tag, want := range map[dicomtag.Tag]string{
+		dicomtag.TransferSyntaxUID:       dicomuid.ExplicitVRLittleEndian,
+		dicomtag.MediaStorageSOPClassUID: "1.2.840.10008.5.1.4.1.1.7",
+		dicomtag.PatientName:             "Doe^John",
+	} {
+		elem, err := ds2.FindElementByTag(tag)
+		require.NoError(t, err, dicomtag.DebugString(tag))
+		assert.Equal(t, want, elem.MustGetString(), dicomtag.DebugString(tag))
+	}
+	elem, err := ds2.FindElementByTag(dicomtag.MediaStorageSOPInstanceUID)
+	require.NoError(t, err)
+	uid := elem.MustGetString()
+	assert.True(t, strings.HasPrefix(uid, "2.25."), uid)
+	assert.NoError(t, dicomuid.Validate(uid))
+	// The meta group has a length other than zero.
+	elem, err = ds2.FindElementByTag(dicomtag.FileMetaInformationGroupLength)
+	require.NoError(t, err)
+	assert.NotEqual(t, uint32(0), elem.Value[0])
+
+	// SOP UIDs and WithTransferSyntax are used if given.
+	ds.Elements = append(ds.Elements, element.MustNewElement(dicomtag.SOPInstanceUID, "1.2.3.4"))
+	ds2 = mustRoundTrip(t, ds, write.WithDefaultMeta, write.ForceImplicitVR)
+	for tag, want := range map[dicomtag.Tag]string{
+		dicomtag.TransferSyntaxUID:          dicomuid.ImplicitVRLittleEndian,
+		dicomtag.MediaStorageSOPInstanceUID: "1.2.3.4",
+	} {
+		elem, err := ds2.FindElementByTag(tag)
+		require.NoError(t, err, dicomtag.DebugString(tag))
+		assert.Equal(t, want, elem.MustGetString(), dicomtag.DebugString(tag))
+	}
+
+	// Meta elements in the dataset aren't completed.
+	ds = newTestDataSet(dicomuid.ExplicitVRLittleEndian)
+	ds.Elements = ds.Elements[:1]
+	assert.Error(t, write.DataSet(&out, ds, write.WithDefaultMeta))
+}
+
+// openCounter is a LazyValue that counts how many times it's opened.
+type openCounter struct {
+	data  []byte
+	opens int
+}
+
+func (v *openCounter) Len() int64 { return int64(len(v.data)) }
+
+func (v *openCounter) Open() (io.Reader, error) {
+	v.opens++
+	return bytes.NewReader(v.data), nil
+}
+
+func TestLazyValue(t *testing.T) {
+	file := []byte("..hello, world..")
+	private := dicomtag.Tag{Group: 0x0009, Element: 0x1010}
+	group := dicomtag.Tag{Group: 0x0009, Element: 0x0000}
+	pixels := &openCounter{data: []byte{1, 0, 2, 0, 3, 0, 4, 0}}
+	counter := &openCounter{data: []byte{1, 2}}
+	ds := newNativePixelDataSet(2, 2, 16, [][]int{{1}, {2}, {3}, {4}})
+	want := ds.Elements[len(ds.Elements)-1].Value
+	ds.Elements[len(ds.Elements)-1] = element.MustNewElement(dicomtag.PixelData, pixels)
+	ds.Elements = append(ds.Elements,
+		&element.Element{Tag: group, VR: "UL", Value: []interface{}{uint32(0)}},
+		&element.Element{Tag: private, VR: "OB", Value: []interface{}{element.NewSectionValue(bytes.NewReader(file), 2, 12)}},
+		&element.Element{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1011}, VR: "OB", Value: []interface{}{counter}})
+	ds2 := mustRoundTrip(t, ds, write.WithGroupLengths)
+	// Values are streamed once, even though the group length is measured.
+	assert.Equal(t, 1, pixels.opens)
+	assert.Equal(t, 1, counter.opens)
+
+	elem, err := ds2.FindElementByTag(private)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("hello, world")}, elem.Value)
+	elem, err = ds2.FindElementByTag(group)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{uint32(12 + 12 + 12 + 2)}, elem.Value)
+	elem, err = ds2.FindElementByTag(dicomtag.PixelData)
+	require.NoError(t, err)
+	assert.Equal(t, "OW", elem.VR)
+	assert.Equal(t, want, elem.Value)
+
+	// An odd length is padded.
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: private, VR: "OB", Value: []interface{}{element.NewSectionValue(bytes.NewReader(file), 2, 5)}})
+	require.NoError(t, e.Error())
+	assert.Equal(t, append([]byte{0x09, 0x00, 0x10, 0x10, 'O', 'B', 0, 0, 6, 0, 0, 0}, "hello\x00"...), e.Bytes())
+
+	// Short reads are an error.
+	e = dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	write.Element(e, &element.Element{Tag: private, VR: "OB", Value: []interface{}{element.NewSectionValue(bytes.NewReader(file), 10, 12)}})
+	assert.Error(t, e.Error())
+}
+
+func TestWithUNResolution(t *testing.T) {
+	private := dicomtag.Tag{Group: 0x0009, Element: 0x1040}
+	count := dicomtag.Tag{Group: 0x0009, Element: 0x1041}
+	// Read from an implicit VR file, private elements are UN.
+	ds := mustRoundTrip(t, newTestDataSet(dicomuid.ImplicitVRLittleEndian,
+		&element.Element{Tag: private, VR: "DS", Value: []interface{}{"1.5", "2.5"}},
+		&element.Element{Tag: count, VR: "US", Value: []interface{}{uint16(3), uint16(0x5c01)}}))
+	elem, err := ds.FindElementByTag(private)
+	require.NoError(t, err)
+	require.Equal(t, "UN", elem.VR)
+
+	resolve := func(tag dicomtag.Tag) string {
+		switch tag {
+		case private:
+			return "DS"
+		case count:
+			return "US"
+		}
+		return ""
+	}
+	ds2 := mustRoundTrip(t, ds, write.WithTransferSyntax(dicomuid.ExplicitVRLittleEndian), write.WithUNResolution(resolve))
+	elem, err = ds2.FindElementByTag(private)
+	require.NoError(t, err)
+	assert.Equal(t, "DS", elem.VR)
+	assert.Equal(t, []interface{}{"1.5", "2.5"}, elem.Value)
+	// The second value has a backslash as its low byte.
+	elem, err = ds2.FindElementByTag(count)
+	require.NoError(t, err)
+	assert.Equal(t, "US", elem.VR)
+	assert.Equal(t, []interface{}{uint16(3), uint16(0x5c01)}, elem.Value)
+
+	// Without a resolution, UN stays.
+	ds2 = mustRoundTrip(t, ds, write.WithTransferSyntax(dicomuid.ExplicitVRLittleEndian))
+	elem, err = ds2.FindElementByTag(private)
+	require.NoError(t, err)
+	assert.Equal(t, "UN", elem.VR)
+
+	// Bytes that don't make values of the VR are an error.
+	var out bytes.Buffer
+	err = write.DataSet(&out, newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		&element.Element{Tag: count, VR: "UN", Value: []interface{}{[]byte{1, 2, 3}}}),
+		write.WithUNResolution(resolve))
+	assert.Error(t, err)
+}
+
+func TestOverlayRoundTrip(t *testing.T) {
+	// Two overlay planes, in groups 6000 and 6002, of 4x4 pixels stored one
+	// bit each.
+	var elems []*element.Element
+	for _, group := range []uint16{0x6000, 0x6002} {
+		tag := func(t dicomtag.Tag) dicomtag.Tag { return dicomtag.Tag{Group: group, Element: t.Element} }
+		elems = append(elems,
+			element.MustNewElement(tag(dicomtag.OverlayRows), uint16(4)),
+			element.MustNewElement(tag(dicomtag.OverlayColumns), uint16(4)),
+			element.MustNewElement(tag(dicomtag.OverlayType), "G"),
+			element.MustNewElement(tag(dicomtag.OverlayOrigin), int16(1), int16(1)),
+			element.MustNewElement(tag(dicomtag.OverlayBitsAllocated), uint16(1)),
+			element.MustNewElement(tag(dicomtag.OverlayBitPosition), uint16(0)),
+			element.MustNewElement(tag(dicomtag.OverlayData), []byte{0x0f, byte(group)}))
+	}
+	for _, uid := range []string{dicomuid.ExplicitVRLittleEndian, dicomuid.ImplicitVRLittleEndian} {
+		ds := newTestDataSet(uid, elems...)
+		ds2 := mustRoundTrip(t, ds)
+		for _, elem := range elems {
+			elem2, err := ds2.FindElementByTag(elem.Tag)
+			require.NoError(t, err, uid)
+			assert.True(t, elem.Equal(elem2), "%v: %v", uid, elem2)
+		}
+		elem, err := ds2.FindElementByTag(dicomtag.Tag{Group: 0x6002, Element: 0x3000})
+		require.NoError(t, err)
+		assert.Equal(t, "OW", elem.VR, uid)
+		assert.Equal(t, []interface{}{[]byte{0x0f, 0x02}}, elem.Value, uid)
+		elem, err = ds2.FindElementByTag(dicomtag.Tag{Group: 0x6002, Element: 0x0050})
+		require.NoError(t, err)
+		assert.Equal(t, "SS", elem.VR, uid)
+		assert.Equal(t, []interface{}{int16(1), int16(1)}, elem.Value, uid)
+	}
+}
+
+func TestNewSecondaryCaptureDataSet(t *testing.T) {
+	grayImage := image.NewGray(image.Rect(0, 0, 3, 2))
+	rgbImage := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		grayImage.SetGray(i%3, i/3, color.Gray{Y: uint8(i * 40)})
+		rgbImage.SetRGBA(i%3, i/3, color.RGBA{R: uint8(i), G: uint8(i * 2), B: 255, A: 255})
+	}
+	tests := []struct {
+		img         image.Image
+		photometric string
+		pixel       []int // The last one.
+	}{
+		{grayImage, "MONOCHROME2", []int{200}},
+		{rgbImage, "RGB", []int{5, 10, 255}},
+	}
+	dir, err := ioutil.TempDir("", "dicom")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, test := range tests {
+		ds, err := write.NewSecondaryCaptureDataSet(test.img)
+		require.NoError(t, err)
+		assert.Empty(t, ds.Validate(), test.photometric)
+		path := filepath.Join(dir, test.photometric+".dcm")
+		require.NoError(t, write.DataSetToFile(path, ds))
+		if dcmdump, err := exec.LookPath("dcmdump"); err == nil {
+			// -E reports parse errors in the exit status.
+			out, err := exec.Command(dcmdump, "-E", path).CombinedOutput()
+			assert.NoError(t, err, "%s", out)
+		}
+
+		p, err := dicom.NewParserFromFile(path, nil)
+		require.NoError(t, err)
+		ds2, err := p.Parse(dicom.ParseOptions{})
+		require.NoError(t, err)
+		for _, tag := range []dicomtag.Tag{
+			dicomtag.MediaStorageSOPClassUID,
+			dicomtag.SOPInstanceUID,
+			dicomtag.PatientName,
+			dicomtag.StudyInstanceUID,
+			dicomtag.SeriesInstanceUID,
+		} {
+			_, err := ds2.FindElementByTag(tag)
+			assert.NoError(t, err)
+		}
+		elem, err := ds2.FindElementByTag(dicomtag.PhotometricInterpretation)
+		require.NoError(t, err)
+		assert.Equal(t, test.photometric, elem.MustGetString())
+		elem, err = ds2.FindElementByTag(dicomtag.PixelData)
+		require.NoError(t, err)
+		native := elem.Value[0].(element.PixelDataInfo).Frames[0].NativeData
+		assert.Equal(t, []int{3, 2}, []int{native.Cols, native.Rows})
+		require.Len(t, native.Data, 6)
+		assert.Equal(t, test.pixel, native.Data[5], test.photometric)
+	}
+
+	_, err = write.NewSecondaryCaptureDataSet(image.NewGray(image.Rectangle{}))
+	assert.Error(t, err)
+}
+
+func TestSecondaryCaptureToImage(t *testing.T) {
+	// Images survive NewSecondaryCaptureDataSet, writing, parsing and
+	// ToImage.
+	grayImage := image.NewGray(image.Rect(0, 0, 3, 2))
+	rgbImage := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		grayImage.SetGray(i%3, i/3, color.Gray{Y: uint8(i * 40)})
+		rgbImage.SetRGBA(i%3, i/3, color.RGBA{R: uint8(i), G: uint8(i * 2), B: 255, A: 255})
+	}
+	for _, want := range []image.Image{grayImage, rgbImage} {
+		ds, err := write.NewSecondaryCaptureDataSet(want)
+		require.NoError(t, err)
+		img, err := mustRoundTrip(t, ds).ToImage(0)
+		require.NoError(t, err)
+		assert.Equal(t, want, img)
+	}
+}
+
+func TestPixelByteSwap(t *testing.T) {
+	// 16-bit samples 0x0001, 0x0002, ..., in little endian.
+	const n = 5000 // More samples than wordSwapReader reads at once.
+	le := make([]byte, 2*n)
+	be := make([]byte, 2*n)
+	var frame [][]int
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint16(le[2*i:], uint16(i+1))
+		binary.BigEndian.PutUint16(be[2*i:], uint16(i+1))
+		frame = append(frame, []int{i + 1})
+	}
+	pixelData := func(data [][]int, value interface{}) *element.DataSet {
+		ds := newNativePixelDataSet(1, n, 16, data)
+		if value != nil {
+			ds.Elements[len(ds.Elements)-1] = &element.Element{Tag: dicomtag.PixelData, VR: "OW", Value: []interface{}{value}}
+		}
+		return ds
+	}
+	lazy := func() interface{} { return element.NewSectionValue(bytes.NewReader(le), 0, int64(len(le))) }
+	stream := func() interface{} {
+		return element.PixelDataStream{Frames: []io.Reader{bytes.NewReader(le)}, FrameLength: len(le)}
+	}
+	toBigEndian := write.WithTransferSyntax(dicomuid.ExplicitVRBigEndian)
+	tests := []struct {
+		name string
+		ds   *element.DataSet
+		opts []write.Option
+		want []byte
+	}{
+		// Transcoding to big endian swaps the words, whether they are
+		// native samples or raw bytes.
+		{"native", pixelData(frame, nil), []write.Option{toBigEndian}, be},
+		{"lazy", pixelData(frame, lazy()), []write.Option{toBigEndian}, be},
+		{"stream", pixelData(frame, stream()), []write.Option{toBigEndian}, be},
+		// Unless disabled for raw bytes.
+		{"lazy, no swap", pixelData(frame, lazy()), []write.Option{toBigEndian, write.WithPixelByteSwap(false)}, le},
+		{"native, no swap", pixelData(frame, nil), []write.Option{toBigEndian, write.WithPixelByteSwap(false)}, be},
+		// Raw bytes are kept in the same byte order, unless swapped
+		// explicitly.
+		{"stream, same order", pixelData(frame, stream()), nil, le},
+		{"stream, forced swap", pixelData(frame, stream()), []write.Option{write.WithPixelByteSwap(true)}, be},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		require.NoError(t, write.DataSet(&out, test.ds, test.opts...), test.name)
+		data := out.Bytes()
+		require.True(t, len(data) > len(test.want), test.name)
+		assert.Equal(t, test.want, data[len(data)-len(test.want):], test.name)
+	}
+}
+
+func TestFaithfulCopyFallback(t *testing.T) {
+	// " 1.5" is written back as "1.5 " unless copied faithfully.
+	ds := newTestDataSet(dicomuid.ExplicitVRLittleEndian,
+		element.MustNewElement(dicomtag.PatientName, "Foo^Bar"),
+		element.MustNewElement(dicomtag.PatientWeight, " 1.5"),
+		element.MustNewElement(dicomtag.ReferencedImageSequence,
+			newItem(false,
+				element.MustNewElement(dicomtag.ReferencedSOPClassUID, "1.2.840.10008.5.1.4.1.1.7"),
+				element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3"))))
+	var orig bytes.Buffer
+	require.NoError(t, write.DataSet(&orig, ds, write.SkipVRVerification))
+	parse := func(data []byte) *element.DataSet {
+		p, err := dicom.NewParserFromBytes(data, nil)
+		require.NoError(t, err)
+		ds, err := p.Parse(dicom.ParseOptions{KeepRawBytes: true})
+		require.NoError(t, err)
+		return ds
+	}
+	find := func(ds *element.DataSet, tag dicomtag.Tag) *element.Element {
+		elem, err := ds.FindElementByTag(tag)
+		require.NoError(t, err)
+		return elem
+	}
+	ds2 := parse(orig.Bytes())
+	raw := find(ds2, dicomtag.PatientWeight).RawBytes
+	require.NotNil(t, raw)
+	var plain bytes.Buffer
+	require.NoError(t, write.DataSet(&plain, ds2))
+	assert.NotEqual(t, raw, find(parse(plain.Bytes()), dicomtag.PatientWeight).RawBytes)
+
+	// A modified element whose RawBytes were left stale is re-encoded.
+	find(ds2, dicomtag.PatientName).Value = []interface{}{"Doe^John^A"}
+	var out bytes.Buffer
+	require.NoError(t, write.DataSet(&out, ds2, write.WithFaithfulCopy))
+	ds3 := parse(out.Bytes())
+	assert.Equal(t, "Doe^John^A", find(ds3, dicomtag.PatientName).MustGetString())
+	assert.Equal(t, raw, find(ds3, dicomtag.PatientWeight).RawBytes)
+
+	// Even if the new value has the same length as the old one, in a
+	// sequence item too.
+	ds2 = parse(orig.Bytes())
+	find(ds2, dicomtag.PatientName).Value = []interface{}{"Foo^Baz"}
+	find(ds2, dicomtag.ReferencedImageSequence).Value[0].(*element.Element).Value[1].(*element.Element).Value = []interface{}{"1.2.4"}
+	out.Reset()
+	require.NoError(t, write.DataSet(&out, ds2, write.WithFaithfulCopy))
+	ds3 = parse(out.Bytes())
+	assert.Equal(t, "Foo^Baz", find(ds3, dicomtag.PatientName).MustGetString())
+	item := find(ds3, dicomtag.ReferencedImageSequence).Value[0].(*element.Element)
+	assert.Equal(t, "1.2.4", item.Value[1].(*element.Element).MustGetString())
+	assert.Equal(t, raw, find(ds3, dicomtag.PatientWeight).RawBytes)
+
+	// So is a sequence with elements filtered out of its items.
+	out.Reset()
+	require.NoError(t, write.DataSet(&out, ds2, write.WithFaithfulCopy, write.WithTagFilter(func(tag dicomtag.Tag) bool {
+		return tag != dicomtag.ReferencedSOPClassUID
+	})))
+	item = find(parse(out.Bytes()), dicomtag.ReferencedImageSequence).Value[0].(*element.Element)
+	require.Len(t, item.Value, 1)
+	assert.Equal(t, dicomtag.ReferencedSOPInstanceUID, item.Value[0].(*element.Element).Tag)
+}
+
+func TestErrorUnimplemented(t *testing.T) {
+	twelveBits := newNativePixelDataSet(1, 1, 12, [][]int{{1}})
+	tests := []struct {
+		elem *element.Element
+		msg  string
+	}{
+		{twelveBits.Elements[len(twelveBits.Elements)-1], "(7fe0,0010)[PixelData]: native pixel data of BitsPerSample 12"},
+		{&element.Element{Tag: dicomtag.LUTData, VR: "OW", UndefinedLength: true,
+			Value: []interface{}{element.NewSectionValue(bytes.NewReader([]byte{1, 2}), 0, 2)}},
+			"(0028,3006)[LUTData]: LazyValue of undefined length"},
+		{&element.Element{Tag: dicomtag.PixelData, VR: "OW", UndefinedLength: true,
+			Value: []interface{}{element.PixelDataStream{Frames: []io.Reader{bytes.NewReader([]byte{1, 2})}, FrameLength: 2}}},
+			"(7fe0,0010)[PixelData]: PixelDataStream of undefined length"},
+		{&element.Element{Tag: dicomtag.Rows, VR: "US", UndefinedLength: true, Value: []interface{}{uint16(1)}},
+			"(0028,0010)[Rows]: US element of undefined length"},
+	}
+	for _, test := range tests {
+		e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+		write.Element(e, test.elem)
+		assert.True(t, errors.Is(e.Error(), write.ErrorUnimplemented), "%v", e.Error())
+		assert.EqualError(t, e.Error(), test.msg+": not implemented")
+	}
+}
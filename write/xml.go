@@ -0,0 +1,167 @@
+package write
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/element"
+)
+
+// xmlModel is the root of the Native DICOM Model (P3.19 A.1).
+type xmlModel struct {
+	XMLName    xml.Name       `xml:"http://dicom.nema.org/PS3.19/models/NativeDICOM NativeDicomModel"`
+	Space      string         `xml:"xml:space,attr"`
+	Attributes []xmlAttribute `xml:"DicomAttribute"`
+}
+
+type xmlAttribute struct {
+	Tag            string          `xml:"tag,attr"`
+	VR             string          `xml:"vr,attr"`
+	Keyword        string          `xml:"keyword,attr,omitempty"`
+	PrivateCreator string          `xml:"privateCreator,attr,omitempty"`
+	Values         []xmlValue      `xml:"Value"`
+	PersonNames    []xmlPersonName `xml:"PersonName"`
+	Items          []xmlItem       `xml:"Item"`
+	InlineBinary   string          `xml:"InlineBinary,omitempty"`
+}
+
+type xmlValue struct {
+	Number int    `xml:"number,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type xmlItem struct {
+	Number     int            `xml:"number,attr"`
+	Attributes []xmlAttribute `xml:"DicomAttribute"`
+}
+
+type xmlPersonName struct {
+	Number      int      `xml:"number,attr"`
+	Alphabetic  *xmlName `xml:",omitempty"`
+	Ideographic *xmlName `xml:",omitempty"`
+	Phonetic    *xmlName `xml:",omitempty"`
+}
+
+type xmlName struct {
+	FamilyName string `xml:",omitempty"`
+	GivenName  string `xml:",omitempty"`
+	MiddleName string `xml:",omitempty"`
+	NamePrefix string `xml:",omitempty"`
+	NameSuffix string `xml:",omitempty"`
+}
+
+// DataSetXML writes "ds" to out in the Native DICOM Model XML (P3.19 Annex
+// A), with the elements in the order of their tags. Like DataSetJSON, binary
+// values are written inline in base64, and encapsulated pixel data is an
+// error.
+//
+//  err := write.DataSetXML(out, ds)
+func DataSetXML(out io.Writer, ds *element.DataSet) error {
+	attrs, err := xmlAttributes(ds.Elements)
+	if err != nil {
+		return fmt.Errorf("write.DataSetXML: %v", err)
+	}
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(xmlModel{Space: "preserve", Attributes: attrs}); err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "\n")
+	return err
+}
+
+// xmlAttributes converts a dataset or the contents of an item.
+func xmlAttributes(elems []*element.Element) ([]xmlAttribute, error) {
+	elems = append([]*element.Element(nil), elems...)
+	sort.SliceStable(elems, func(i, j int) bool {
+		return tagLess(elems[i].Tag, elems[j].Tag)
+	})
+	// Values of the private creator elements, keyed by their tag.
+	creators := map[dicomtag.Tag]string{}
+	var attrs []xmlAttribute
+	for _, elem := range elems {
+		attr, err := xmlElement(elem)
+		if err != nil {
+			return nil, err
+		}
+		if dicomtag.IsPrivateCreator(elem.Tag) {
+			creators[elem.Tag], _ = elem.GetString()
+		} else if dicomtag.IsPrivate(elem.Tag.Group) {
+			attr.PrivateCreator = creators[dicomtag.Tag{Group: elem.Tag.Group, Element: elem.Tag.Element >> 8}]
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+func xmlElement(elem *element.Element) (xmlAttribute, error) {
+	vr := modelVR(elem)
+	attr := xmlAttribute{Tag: fmt.Sprintf("%04X%04X", elem.Tag.Group, elem.Tag.Element), VR: vr}
+	if entry, err := dicomtag.Find(elem.Tag); err == nil {
+		attr.Keyword = entry.Name
+	}
+	if isBinaryVR(vr) {
+		if len(elem.Value) == 0 {
+			return attr, nil
+		}
+		var err error
+		attr.InlineBinary, err = inlineBinary(elem, vr)
+		return attr, err
+	}
+	for i, value := range elem.Value {
+		number := i + 1
+		switch vr {
+		case "SQ":
+			elems, err := itemElements(value)
+			if err != nil {
+				return attr, fmt.Errorf("%v: %v", dicomtag.DebugString(elem.Tag), err)
+			}
+			item := xmlItem{Number: number}
+			if item.Attributes, err = xmlAttributes(elems); err != nil {
+				return attr, err
+			}
+			attr.Items = append(attr.Items, item)
+		case "AT":
+			t, ok := value.(dicomtag.Tag)
+			if !ok {
+				return attr, fmt.Errorf("%v: expect Tag, but found %v", dicomtag.DebugString(elem.Tag), value)
+			}
+			attr.Values = append(attr.Values, xmlValue{number, fmt.Sprintf("%04X%04X", t.Group, t.Element)})
+		case "US", "UL", "SS", "SL", "FL", "FD":
+			attr.Values = append(attr.Values, xmlValue{number, fmt.Sprint(value)})
+		default:
+			s, err := stringValue(vr, value)
+			if err != nil {
+				return attr, fmt.Errorf("%v: %v", dicomtag.DebugString(elem.Tag), err)
+			}
+			if s == "" {
+				continue // Empty values are omitted, but still counted.
+			}
+			if vr == "PN" {
+				attr.PersonNames = append(attr.PersonNames, xmlPersonNameOf(number, s))
+			} else {
+				attr.Values = append(attr.Values, xmlValue{number, s})
+			}
+		}
+	}
+	return attr, nil
+}
+
+// xmlPersonNameOf splits a PN value into its component groups and components
+// (P3.5 6.2.1). Empty groups are left out.
+func xmlPersonNameOf(number int, s string) xmlPersonName {
+	name := element.ParsePersonName(s)
+	group := func(g element.PersonNameGroup) *xmlName {
+		if g == (element.PersonNameGroup{}) {
+			return nil
+		}
+		return &xmlName{g.FamilyName, g.GivenName, g.MiddleName, g.NamePrefix, g.NameSuffix}
+	}
+	return xmlPersonName{Number: number, Alphabetic: group(name.Alphabetic), Ideographic: group(name.Ideographic), Phonetic: group(name.Phonetic)}
+}
@@ -0,0 +1,62 @@
+package write_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suyashkumar/dicom/dicomtag"
+	"github.com/suyashkumar/dicom/element"
+	"github.com/suyashkumar/dicom/write"
+)
+
+func TestDataSetXML(t *testing.T) {
+	ds := &element.DataSet{Elements: []*element.Element{
+		element.MustNewElement(dicomtag.PatientName, "Yamada^Tarou=山田^太郎"),
+		element.MustNewElement(dicomtag.ImageType, "ORIGINAL", "", "AXIAL"),
+		element.MustNewElement(dicomtag.Rows, uint16(512)),
+		element.MustNewElement(dicomtag.ReferencedImageSequence,
+			newItem(true, element.MustNewElement(dicomtag.ReferencedSOPInstanceUID, "1.2.3"))),
+		{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x0010}, Value: []interface{}{"ACME 1.0"}},
+		{Tag: dicomtag.Tag{Group: 0x0009, Element: 0x1001}, VR: "OB", Value: []interface{}{[]byte{1, 2}}},
+	}}
+	var out bytes.Buffer
+	require.NoError(t, write.DataSetXML(&out, ds))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<NativeDicomModel xmlns="http://dicom.nema.org/PS3.19/models/NativeDICOM" xml:space="preserve">
+  <DicomAttribute tag="00080008" vr="CS" keyword="ImageType">
+    <Value number="1">ORIGINAL</Value>
+    <Value number="3">AXIAL</Value>
+  </DicomAttribute>
+  <DicomAttribute tag="00081140" vr="SQ" keyword="ReferencedImageSequence">
+    <Item number="1">
+      <DicomAttribute tag="00081155" vr="UI" keyword="ReferencedSOPInstanceUID">
+        <Value number="1">1.2.3</Value>
+      </DicomAttribute>
+    </Item>
+  </DicomAttribute>
+  <DicomAttribute tag="00090010" vr="LO">
+    <Value number="1">ACME 1.0</Value>
+  </DicomAttribute>
+  <DicomAttribute tag="00091001" vr="OB" privateCreator="ACME 1.0">
+    <InlineBinary>AQI=</InlineBinary>
+  </DicomAttribute>
+  <DicomAttribute tag="00100010" vr="PN" keyword="PatientName">
+    <PersonName number="1">
+      <Alphabetic>
+        <FamilyName>Yamada</FamilyName>
+        <GivenName>Tarou</GivenName>
+      </Alphabetic>
+      <Ideographic>
+        <FamilyName>山田</FamilyName>
+        <GivenName>太郎</GivenName>
+      </Ideographic>
+    </PersonName>
+  </DicomAttribute>
+  <DicomAttribute tag="00280010" vr="US" keyword="Rows">
+    <Value number="1">512</Value>
+  </DicomAttribute>
+</NativeDicomModel>
+`, out.String())
+}